@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/dxas90/scalebee/pkg/autoscaler"
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// cluster is one Swarm cluster autoscaled by this instance
+type cluster struct {
+	name   string
+	scaler *autoscaler.Autoscaler
+}
+
+// clusterConfigs returns the configuration of every cluster listed in
+// CLUSTERS, based on the shared configuration. Each cluster reads its Docker
+// endpoint, Prometheus URL and matchers from CLUSTER_<NAME>_DOCKER_HOST,
+// CLUSTER_<NAME>_PROMETHEUS_URL and CLUSTER_<NAME>_PROMETHEUS_MATCHERS.
+// Without CLUSTERS, the shared configuration is the only cluster. Names
+// appear in metric labels and API paths, so they are restricted to letters,
+// digits, '-' and '_', and must stay distinct as variable names.
+func clusterConfigs(base *autoscaler.Config) []*autoscaler.Config {
+	var configs []*autoscaler.Config
+	seen := make(map[string]string)
+	for _, name := range strings.Split(getEnv("CLUSTERS", ""), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !validClusterName(name) {
+			fatal("Invalid CLUSTERS: names may only contain letters, digits, '-' and '_'", "cluster", name)
+		}
+		if other, ok := seen[envName(name)]; ok {
+			fatal("Invalid CLUSTERS: names must be unique in their upper-cased form", "cluster", name, "conflicts_with", other)
+		}
+		seen[envName(name)] = name
+		prefix := "CLUSTER_" + envName(name) + "_"
+
+		config := *base
+		config.ClusterName = name
+		config.Docker = dockerConnection(prefix, base.Docker)
+		config.PrometheusURL = getEnv(prefix+"PROMETHEUS_URL", base.PrometheusURL)
+		config.PrometheusMatchers = getEnv(prefix+"PROMETHEUS_MATCHERS", base.PrometheusMatchers)
+		configs = append(configs, &config)
+	}
+	if len(configs) == 0 {
+		return []*autoscaler.Config{base}
+	}
+	return configs
+}
+
+// scopeConfig sets the services ScaleBee may touch, from AUTOSCALE_STACKS,
+// INCLUDE_SERVICES and EXCLUDE_SERVICES. Everything that scales services,
+// e.g. restore, must apply it.
+func scopeConfig(config *autoscaler.Config) error {
+	var err error
+	config.Stacks = getEnvList("AUTOSCALE_STACKS")
+	if config.IncludeServices, err = docker.ParseNamePatterns(getEnvList("INCLUDE_SERVICES")); err != nil {
+		return fmt.Errorf("INCLUDE_SERVICES: %w", err)
+	}
+	if config.ExcludeServices, err = docker.ParseNamePatterns(getEnvList("EXCLUDE_SERVICES")); err != nil {
+		return fmt.Errorf("EXCLUDE_SERVICES: %w", err)
+	}
+	return nil
+}
+
+// dockerConnection reads the Docker endpoint settings from the variables
+// with the given prefix, e.g. DOCKER_HOST and DOCKER_TLS_CA_FILE
+func dockerConnection(prefix string, defaults docker.Connection) docker.Connection {
+	return docker.Connection{
+		Host:     getEnv(prefix+"DOCKER_HOST", defaults.Host),
+		CAFile:   getEnv(prefix+"DOCKER_TLS_CA_FILE", defaults.CAFile),
+		CertFile: getEnv(prefix+"DOCKER_TLS_CERT_FILE", defaults.CertFile),
+		KeyFile:  getEnv(prefix+"DOCKER_TLS_KEY_FILE", defaults.KeyFile),
+	}
+}
+
+// validClusterName reports whether a cluster name is safe in URL paths
+func validClusterName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// envName converts a cluster name to the form used in variable names,
+// e.g. "eu-west" to "EU_WEST"
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// evaluate runs one autoscaling cycle on every cluster concurrently, so a
+// slow cluster doesn't delay the others. It returns the error of each
+// cluster, in the order of clusters.
+func evaluate(ctx context.Context, clusters []cluster, eval autoscaler.Evaluation, run string) []error {
+	errs := make([]error, len(clusters))
+	var wg sync.WaitGroup
+	for i, c := range clusters {
+		wg.Add(1)
+		go func(i int, c cluster) {
+			defer wg.Done()
+			if err := c.scaler.Evaluate(ctx, eval); err != nil {
+				errs[i] = err
+				logger := slog.Default()
+				if len(clusters) > 1 {
+					logger = logger.With("cluster", c.name)
+				}
+				logger.Error("Run failed", "run", run, "error", err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging configures the default logger from LOG_LEVEL (debug, info,
+// warn or error) and LOG_FORMAT (text or json). Records are written to
+// stderr; the standard log package is routed through the same handler.
+func setupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid LOG_LEVEL: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := getEnv("LOG_FORMAT", "text"); format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid LOG_FORMAT %q: must be text or json\n", format)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
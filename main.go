@@ -2,78 +2,307 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/dxas90/scalebee/pkg/api"
 	"github.com/dxas90/scalebee/pkg/autoscaler"
+	"github.com/dxas90/scalebee/pkg/backpressure"
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/events"
 	"github.com/dxas90/scalebee/pkg/metrics"
+	"github.com/dxas90/scalebee/pkg/notify"
+	"github.com/dxas90/scalebee/pkg/probe"
+	"github.com/dxas90/scalebee/pkg/prometheus"
+	"github.com/dxas90/scalebee/pkg/systemd"
+	"github.com/dxas90/scalebee/pkg/version"
 )
 
 func main() {
+	setupLogging()
+
+	if len(os.Args) > 1 && os.Args[1] == "recommend" {
+		os.Exit(runRecommend(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestore(os.Args[2:]))
+	}
+
+	// A one-shot run reports its outcome in the exit code. This is the
+	// first deferred call, so it exits after every other one has run.
+	exitCode := exitNoAction
+	defer func() {
+		if exitCode != exitNoAction {
+			os.Exit(exitCode)
+		}
+	}()
+
 	// Get configuration from environment variables
 	prometheusURL := getEnv("PROMETHEUS_URL", "http://prometheus:9090")
 	loopEnabled := getEnv("LOOP", "yes") == "yes"
 	intervalSeconds := getEnvInt("INTERVAL_SECONDS", 13)
+	scaleUpIntervalSeconds := getEnvInt("SCALE_UP_INTERVAL_SECONDS", intervalSeconds)
+	scaleDownIntervalSeconds := getEnvInt("SCALE_DOWN_INTERVAL_SECONDS", intervalSeconds)
 	metricsPort := getEnv("METRICS_PORT", "9090")
 	metricsEnabled := getEnv("METRICS_ENABLED", "yes") == "yes"
+	apiEnabled := getEnv("API_ENABLED", "yes") == "yes"
+	shutdownRestore := getEnv("SHUTDOWN_RESTORE", autoscaler.RestoreNone)
+	startupPolicy := getEnv("STARTUP_POLICY", "fail")
+	minTaskAge := getEnvDuration("METRIC_MIN_TASK_AGE", 0)
 
-	log.Printf("ScaleBee - Docker Swarm Autoscaler")
-	log.Printf("Prometheus URL: %s", prometheusURL)
-	log.Printf("Loop enabled: %v", loopEnabled)
-	log.Printf("Interval: %d seconds", intervalSeconds)
-	log.Printf("Metrics exporter enabled: %v", metricsEnabled)
-	if metricsEnabled {
-		log.Printf("Metrics port: %s", metricsPort)
+	switch startupPolicy {
+	case "fail", "degraded", "exporter-only":
+	default:
+		fatal("Invalid STARTUP_POLICY: must be fail, degraded, or exporter-only", "value", startupPolicy)
+	}
+
+	switch shutdownRestore {
+	case autoscaler.RestoreNone, autoscaler.RestoreMinimum, autoscaler.RestoreSnapshot:
+	default:
+		fatal("Invalid SHUTDOWN_RESTORE: must be none, minimum, or snapshot", "value", shutdownRestore)
 	}
 
-	// Setup signal handling for graceful shutdown
+	build := version.Get()
+	slog.Info("ScaleBee - Docker Swarm Autoscaler", "version", build.Version, "commit", build.Commit, "build_date", build.BuildDate)
+	slog.Info("Configuration", "prometheus_url", prometheusURL, "loop", loopEnabled,
+		"scale_up_interval_seconds", scaleUpIntervalSeconds, "scale_down_interval_seconds", scaleDownIntervalSeconds,
+		"startup_policy", startupPolicy, "metrics", metricsEnabled, "api", apiEnabled, "metrics_port", metricsPort)
+
+	// Setup signal handling for graceful shutdown. A signal stops the loop
+	// and the watchers, but runs have their own context, so the run in
+	// flight isn't cancelled mid-update. It is only cancelled when it hasn't
+	// finished within the drain timeout, or on a second signal.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	defer cancelRuns()
+	drainTimeout := getEnvDuration("SHUTDOWN_DRAIN_TIMEOUT", 30*time.Second)
+	drained := make(chan struct{})
 
-	sigChan := make(chan os.Signal, 1)
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-sigChan
-		log.Println("Received shutdown signal, stopping...")
+		slog.Info("Received shutdown signal, stopping after the current run", "drain_timeout", drainTimeout)
+		notifySystemd(systemd.Stopping)
 		cancel()
+		select {
+		case <-drained:
+			return
+		case <-sigChan:
+			slog.Warn("Received a second shutdown signal, cancelling the current run")
+		case <-time.After(drainTimeout):
+			slog.Warn("Current run did not finish within the drain timeout, cancelling it")
+		}
+		cancelRuns()
 	}()
 
+	defer setupTracing(ctx)()
+
+	// HTTP server shared by the metrics exporter and the API
+	mux := http.NewServeMux()
+	mux.Handle("/version", version.Handler())
+
+	// A run may take longer than the interval, so the loop only counts as
+	// stuck well after the next run is due
+	livenessTimeout := 3 * time.Duration(max(scaleUpIntervalSeconds, scaleDownIntervalSeconds)) * time.Second
+	health := &probes{timeout: getEnvDuration("LIVENESS_TIMEOUT", max(livenessTimeout, 5*time.Minute))}
+	mux.HandleFunc("/health", health.health)
+	mux.HandleFunc("/ready", health.ready)
+	mux.HandleFunc("/live", health.live)
+	// Under systemd, the watchdog is fed only while the loop is live. It
+	// outlives ctx, so it is still fed while the last run drains.
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		slog.Info("Sending systemd watchdog notifications", "interval", interval)
+		go health.watchdog(runCtx, interval)
+	}
+
+	// Profiles expose internals and cost CPU while captured, so they are
+	// only served on request
+	if getEnv("PPROF_ENABLED", "no") == "yes" {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		slog.Warn("Serving pprof profiles on /debug/pprof/, do not expose the metrics port publicly")
+	}
+
 	// Start metrics exporter if enabled
 	var metricsExporter *metrics.Exporter
 	if metricsEnabled {
 		var err error
-		metricsExporter, err = metrics.NewExporter(10 * time.Second)
+		metricsExporter, err = metrics.NewExporter(10*time.Second, dockerConnection("", docker.Connection{}))
 		if err != nil {
-			log.Fatalf("Failed to create metrics exporter: %v", err)
+			fatal("Failed to create metrics exporter", "error", err)
 		}
 		defer metricsExporter.Close()
 
+		switch cpuBasis := getEnv("CPU_PERCENT_BASIS", metrics.CPUBasisHost); cpuBasis {
+		case metrics.CPUBasisHost, metrics.CPUBasisLimit, metrics.CPUBasisReservation:
+			metricsExporter.SetCPUBasis(cpuBasis)
+		default:
+			fatal("Invalid CPU_PERCENT_BASIS: must be host, limit, or reservation", "value", cpuBasis)
+		}
+
+		metricsExporter.SetServiceMetrics(
+			getEnv("SERVICE_RESOURCE_METRICS", "no") == "yes",
+			getEnv("SERVICE_REPLICA_METRICS", "no") == "yes",
+		)
+
+		metricsExporter.SetMinTaskAge(minTaskAge)
+		metricsExporter.SetAutoscaledOnly(getEnv("METRICS_AUTOSCALED_ONLY", "no") == "yes")
+
+		include, err := metrics.ParseLabelSelectors(getEnv("METRICS_INCLUDE_LABELS", ""))
+		if err != nil {
+			fatal("Invalid METRICS_INCLUDE_LABELS", "error", err)
+		}
+		exclude, err := metrics.ParseLabelSelectors(getEnv("METRICS_EXCLUDE_LABELS", ""))
+		if err != nil {
+			fatal("Invalid METRICS_EXCLUDE_LABELS", "error", err)
+		}
+		metricsExporter.SetContainerFilter(include, exclude)
+
+		metricLabels, err := metrics.ParseMetricLabels(getEnv("METRIC_LABELS", ""))
+		if err != nil {
+			fatal("Invalid METRIC_LABELS", "error", err)
+		}
+		metricsExporter.SetMetricLabels(metricLabels)
+
+		metricsExporter.SetNodeMetrics(getEnv("NODE_METRICS", "no") == "yes", getEnv("HOST_PROC", "/proc"))
+
+		switch statsMode := getEnv("STATS_MODE", metrics.StatsModeStream); statsMode {
+		case metrics.StatsModeStream, metrics.StatsModePoll:
+			metricsExporter.SetStatsMode(statsMode)
+		default:
+			fatal("Invalid STATS_MODE: must be stream or poll", "value", statsMode)
+		}
+
+		switch pacing := getEnv("STATS_PACING", metrics.PacingNone); pacing {
+		case metrics.PacingNone, metrics.PacingFixed, metrics.PacingAdaptive:
+			metricsExporter.SetPacing(pacing, time.Duration(getEnvInt("STATS_PACING_DELAY_MS", 100))*time.Millisecond)
+		default:
+			fatal("Invalid STATS_PACING: must be none, fixed, or adaptive", "value", pacing)
+		}
+
+		statsWorkers := getEnvInt("STATS_WORKERS", metrics.DefaultStatsWorkers)
+		statsTimeout := time.Duration(getEnvInt("STATS_TIMEOUT_SECONDS", 5)) * time.Second
+		if statsWorkers < 1 || statsTimeout <= 0 {
+			fatal("STATS_WORKERS and STATS_TIMEOUT_SECONDS must be positive")
+		}
+		metricsExporter.SetWorkers(statsWorkers, statsTimeout)
+
+		// Pushed metrics are grouped by instance, which defaults to the
+		// container's hostname
+		hostname, _ := os.Hostname()
+
+		pushOnly := false
+		if pushURL := getEnv("PUSHGATEWAY_URL", ""); pushURL != "" {
+			instance := getEnv("PUSHGATEWAY_INSTANCE", hostname)
+			metricsExporter.SetPush(pushURL, getEnv("PUSHGATEWAY_JOB", "scalebee"), instance)
+			defer metricsExporter.DeletePush()
+			pushOnly = getEnv("PUSHGATEWAY_ONLY", "no") == "yes"
+			slog.Info("Pushing metrics", "url", pushURL, "instance", instance)
+		}
+
+		if remoteWriteURL := getEnv("REMOTE_WRITE_URL", ""); remoteWriteURL != "" {
+			metricsExporter.SetRemoteWrite(metrics.RemoteWriteConfig{
+				URL:         remoteWriteURL,
+				Job:         getEnv("REMOTE_WRITE_JOB", "scalebee"),
+				Instance:    getEnv("REMOTE_WRITE_INSTANCE", hostname),
+				Username:    getEnv("REMOTE_WRITE_USERNAME", ""),
+				Password:    getEnv("REMOTE_WRITE_PASSWORD", ""),
+				BearerToken: getEnv("REMOTE_WRITE_BEARER_TOKEN", ""),
+			})
+			slog.Info("Writing metrics with remote write", "url", remoteWriteURL)
+		}
+
+		otlpProtocol := getEnv("OTLP_METRICS", metrics.OTLPNone)
+		if err := metricsExporter.SetOTLP(ctx, otlpProtocol); err != nil {
+			fatal("Invalid OTLP_METRICS", "error", err)
+		}
+		if otlpProtocol != metrics.OTLPNone {
+			defer func() {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				metricsExporter.ShutdownOTLP(shutdownCtx)
+			}()
+			slog.Info("Exporting metrics over OTLP", "protocol", otlpProtocol)
+		}
+
 		// Start metrics collection in background
 		go metricsExporter.Start(ctx)
 
-		// Start HTTP server for metrics
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", metricsExporter)
-		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
-		})
+		if !pushOnly {
+			mux.Handle("/metrics", metricsExporter)
+		}
+	}
+
+	apiTokens, err := getAPITokens()
+	if err != nil {
+		fatal("Invalid API_TOKENS", "error", err)
+	}
 
+	if metricsEnabled || apiEnabled {
+		password, err := getEnvSecret("SERVER_PASSWORD")
+		if err != nil {
+			fatal("Invalid SERVER_PASSWORD_FILE", "error", err)
+		}
+		bearerToken, err := getEnvSecret("SERVER_BEARER_TOKEN")
+		if err != nil {
+			fatal("Invalid SERVER_BEARER_TOKEN_FILE", "error", err)
+		}
+		creds := api.Credentials{
+			Username:    getEnv("SERVER_USERNAME", ""),
+			Password:    password,
+			BearerToken: bearerToken,
+			Tokens:      apiTokens,
+		}
+		if (creds.Username == "") != (creds.Password == "") {
+			fatal("SERVER_USERNAME and SERVER_PASSWORD must be set together")
+		}
+
+		// The probes stay public, so healthchecks need no credentials
 		server := &http.Server{
 			Addr:    ":" + metricsPort,
-			Handler: mux,
+			Handler: api.Protect(mux, creds, "/health", "/ready", "/live"),
+		}
+
+		certFile, keyFile := getEnv("SERVER_TLS_CERT_FILE", ""), getEnv("SERVER_TLS_KEY_FILE", "")
+		if (certFile == "") != (keyFile == "") {
+			fatal("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+		}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				fatal("Failed to load the server certificate", "error", err)
+			}
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
 		}
 
 		go func() {
-			log.Printf("Starting metrics server on port %s", metricsPort)
-			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Printf("Metrics server error: %v", err)
+			slog.Info("Starting metrics server", "port", metricsPort, "tls", server.TLSConfig != nil,
+				"auth", creds.Username != "" || creds.BearerToken != "" || apiTokens.Allow(api.ScopeRead))
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("Metrics server failed", "error", err)
 			}
 		}()
 
@@ -83,63 +312,407 @@ func main() {
 			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer shutdownCancel()
 			if err := server.Shutdown(shutdownCtx); err != nil {
-				log.Printf("Error shutting down metrics server: %v", err)
+				slog.Error("Failed to shut down metrics server", "error", err)
 			}
 		}()
 	}
 
+	// Setup notification channels, one per webhook URL, each delivering
+	// from its own queue. Digests are flushed once the last run and the
+	// shutdown actions are done, so their notifications are included, and
+	// the queues are drained after that.
+	var notifiers notify.Multi
+	var queues, digests sync.WaitGroup
+	queueCtx, stopQueues := context.WithCancel(context.Background())
+	defer func() {
+		stopQueues()
+		queues.Wait()
+	}()
+	digestCtx, stopDigests := context.WithCancel(context.Background())
+	defer func() {
+		stopDigests()
+		digests.Wait()
+	}()
+	digestMinutes := getEnvInt("NOTIFY_DIGEST_MINUTES", 0)
+	var webhookTemplate *template.Template
+	if templateFile := getEnv("NOTIFY_WEBHOOK_TEMPLATE_FILE", ""); templateFile != "" {
+		tmpl, err := notify.LoadTemplate(templateFile)
+		if err != nil {
+			fatal("Invalid webhook template", "error", err)
+		}
+		webhookTemplate = tmpl
+	}
+	for _, webhookURL := range strings.Split(getEnv("NOTIFY_WEBHOOK_URLS", ""), ",") {
+		webhookURL = strings.TrimSpace(webhookURL)
+		if webhookURL == "" {
+			continue
+		}
+
+		webhook := notify.NewWebhookNotifier(webhookURL)
+		if webhookTemplate != nil {
+			webhook.SetTemplate(webhookTemplate, getEnv("NOTIFY_WEBHOOK_CONTENT_TYPE", "application/json"))
+		}
+
+		queue := notify.NewQueue(webhook)
+		queues.Add(1)
+		go func() {
+			defer queues.Done()
+			queue.Start(queueCtx)
+		}()
+
+		var notifier notify.Notifier = queue
+		if digestMinutes > 0 {
+			digest := notify.NewDigest(notifier, time.Duration(digestMinutes)*time.Minute)
+			digests.Add(1)
+			go func() {
+				defer digests.Done()
+				digest.Start(digestCtx)
+			}()
+			notifier = digest
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	// Grafana annotations are written from the event bus, never batched
+	// into digests
+	var grafana *notify.GrafanaNotifier
+	grafanaEvents := []string{events.TypeScaled}
+	if grafanaURL := getEnv("GRAFANA_URL", ""); grafanaURL != "" {
+		grafana = notify.NewGrafanaNotifier(grafanaURL, getEnv("GRAFANA_TOKEN", ""),
+			getEnv("GRAFANA_DASHBOARD_UID", ""), getEnvList("GRAFANA_TAGS"))
+		switch mode := getEnv("GRAFANA_EVENTS", "scaled"); mode {
+		case "scaled":
+		case "all":
+			grafanaEvents = append(grafanaEvents, events.TypeProposed, events.TypeNotice)
+		default:
+			fatal("Invalid GRAFANA_EVENTS: must be scaled or all", "value", mode)
+		}
+		slog.Info("Grafana annotations enabled", "url", grafanaURL)
+	}
+	if len(notifiers) > 0 {
+		slog.Info("Notifications enabled", "channels", len(notifiers), "digest_minutes", digestMinutes)
+	}
+
 	// Create autoscaler
 	config := &autoscaler.Config{
-		PrometheusURL:    prometheusURL,
+		PrometheusURL:             prometheusURL,
+		PrometheusEndpoints:       getEnvMap("PROMETHEUS_ENDPOINTS"),
+		PrometheusStackRoutes:     getEnvMap("PROMETHEUS_STACK_ROUTES"),
+		PrometheusServiceRoutes:   getEnvMap("PROMETHEUS_SERVICE_ROUTES"),
+		PrometheusMatchers:        getEnv("PROMETHEUS_MATCHERS", ""),
+		PrometheusCacheTTL:        getEnvDuration("PROMETHEUS_CACHE_TTL", 0),
+		PrometheusBreakerFailures: getEnvInt("PROMETHEUS_BREAKER_FAILURES", 5),
+		PrometheusBreakerCooldown: getEnvDuration("PROMETHEUS_BREAKER_COOLDOWN", autoscaler.PrometheusBreakerCooldown),
+		PrometheusHTTP: prometheus.HTTPConfig{
+			Username:        getEnv("PROMETHEUS_USERNAME", ""),
+			Password:        getEnv("PROMETHEUS_PASSWORD", ""),
+			PasswordFile:    getEnv("PROMETHEUS_PASSWORD_FILE", ""),
+			BearerToken:     getEnv("PROMETHEUS_BEARER_TOKEN", ""),
+			BearerTokenFile: getEnv("PROMETHEUS_BEARER_TOKEN_FILE", ""),
+			CertFile:        getEnv("PROMETHEUS_CERT_FILE", ""),
+			KeyFile:         getEnv("PROMETHEUS_KEY_FILE", ""),
+			CAFile:          getEnv("PROMETHEUS_CA_FILE", ""),
+
+			InsecureSkipVerify: getEnv("PROMETHEUS_INSECURE_SKIP_VERIFY", "no") == "yes",
+
+			Timeout:      time.Duration(getEnvInt("PROMETHEUS_TIMEOUT_SECONDS", 10)) * time.Second,
+			Retries:      getEnvInt("PROMETHEUS_RETRIES", 2),
+			RetryBackoff: time.Duration(getEnvInt("PROMETHEUS_RETRY_BACKOFF_MS", 500)) * time.Millisecond,
+		},
+
+		ClusterName: getEnv("CLUSTER_NAME", ""),
+		Docker:      dockerConnection("", docker.Connection{}),
+
 		CPUUpperLimit:    getEnvFloat("CPU_PERCENTAGE_UPPER_LIMIT", 75.0),
 		CPULowerLimit:    getEnvFloat("CPU_PERCENTAGE_LOWER_LIMIT", 20.0),
 		MemoryUpperLimit: getEnvFloat("MEMORY_PERCENTAGE_UPPER_LIMIT", 80.0),
 		MemoryLowerLimit: getEnvFloat("MEMORY_PERCENTAGE_LOWER_LIMIT", 20.0),
+
+		CPUCriticalLimit:    getEnvFloat("CPU_PERCENTAGE_CRITICAL_LIMIT", 95.0),
+		MemoryCriticalLimit: getEnvFloat("MEMORY_PERCENTAGE_CRITICAL_LIMIT", 95.0),
+
+		ContainerLabelFallback: getEnv("CONTAINER_LABEL_FALLBACK", "no") == "yes",
+		ServiceConfigCacheTTL:  getEnvDuration("SERVICE_CONFIG_CACHE_TTL", 5*time.Second),
+		ClusterCapacityCheck:   getEnv("CLUSTER_CAPACITY_CHECK", "yes") == "yes",
+		ScaleMetadataLabels:    getEnv("SCALE_METADATA_LABELS", "yes") == "yes",
+		EventHistorySize:       getEnvInt("EVENT_HISTORY_SIZE", events.DefaultHistorySize),
+		RunTimeout:             getEnvDuration("RUN_TIMEOUT", 2*time.Minute),
+		StaleAfter:             time.Duration(getEnvInt("STALE_RUN_INTERVALS", 10)*max(scaleUpIntervalSeconds, scaleDownIntervalSeconds)) * time.Second,
+
+		ConvergenceTimeout:  getEnvDuration("CONVERGENCE_TIMEOUT", 0),
+		ScaleDownMaxPercent: getEnvFloat("SCALE_DOWN_MAX_PERCENT", 0),
+		ScaleDownWindow:     time.Duration(getEnvInt("SCALE_DOWN_WINDOW_SECONDS", 300)) * time.Second,
+		RescheduleWindow:    getEnvDuration("RESCHEDULE_WINDOW", autoscaler.RescheduleWindow),
+
+		TolerancePercent: getEnvFloat("THRESHOLD_TOLERANCE_PERCENT", 0),
+		MetricJumpFactor: getEnvFloat("METRIC_JUMP_FACTOR", 0),
+
+		ExporterVersionCheck: getEnv("EXPORTER_VERSION_CHECK", "no") == "yes",
+		ExporterAutoUpdate:   getEnv("EXPORTER_AUTO_UPDATE", "no") == "yes",
+
+		NewServiceGracePeriod: time.Duration(getEnvInt("NEW_SERVICE_GRACE_SECONDS", 0)) * time.Second,
+		ContainerWarmup:       time.Duration(getEnvInt("CONTAINER_WARMUP_SECONDS", 0)) * time.Second,
+		MinTaskAge:            minTaskAge,
+
+		MemoryIncludeCache: getEnv("MEMORY_INCLUDE_CACHE", "no") == "yes",
+
+		CrashLoopFailures: getEnvInt("CRASHLOOP_FAILURES", 0),
+		CrashLoopWindow:   time.Duration(getEnvInt("CRASHLOOP_WINDOW_SECONDS", 600)) * time.Second,
+
+		ScaleDownStabilization: time.Duration(getEnvInt("SCALE_DOWN_STABILIZATION_SECONDS", 0)) * time.Second,
+		ScaleUpStabilization:   time.Duration(getEnvInt("SCALE_UP_STABILIZATION_SECONDS", 0)) * time.Second,
+
+		VerticalStepPercent: getEnvFloat("VERTICAL_STEP_PERCENT", 25.0),
+
+		ApprovalAboveReplicas:   getEnvInt("APPROVAL_ABOVE_REPLICAS", 0),
+		ApprovalScaleDownLabels: getEnvMap("APPROVAL_SCALE_DOWN_LABELS"),
+		ApprovalTTL:             time.Duration(getEnvInt("APPROVAL_TTL_SECONDS", 900)) * time.Second,
+
+		DisasterMinimumFactor: getEnvFloat("DISASTER_MINIMUM_FACTOR", autoscaler.DisasterMinimumFactor),
+		DisasterScaleDown:     getEnv("DISASTER_SCALE_DOWN", "no") == "yes",
+
+		GlobalPolicy: getEnv("GLOBAL_SERVICE_POLICY", autoscaler.GlobalPolicySkip),
+		OOMReaction:  getEnv("OOM_REACTION", autoscaler.OOMReactionNone),
+	}
+	if len(notifiers) > 0 {
+		config.Notifier = notifiers
+	}
+	if backpressureURL := getEnv("BACKPRESSURE_WEBHOOK_URL", ""); backpressureURL != "" {
+		config.Backpressure = backpressure.NewWebhookGateway(backpressureURL, getEnv("BACKPRESSURE_WEBHOOK_TOKEN", ""))
+		config.BackpressureRelease = time.Duration(getEnvInt("BACKPRESSURE_RELEASE_SECONDS", 300)) * time.Second
+		slog.Info("Backpressure enabled", "url", backpressureURL)
 	}
 
-	scaler, err := autoscaler.NewAutoscaler(config)
-	if err != nil {
-		log.Fatalf("Failed to create autoscaler: %v", err)
+	if config.PrometheusHTTP.InsecureSkipVerify {
+		slog.Warn("Prometheus server certificates are not verified")
+	}
+
+	switch config.GlobalPolicy {
+	case autoscaler.GlobalPolicySkip, autoscaler.GlobalPolicyPlacement:
+	default:
+		fatal("Invalid GLOBAL_SERVICE_POLICY: must be skip or placement", "value", config.GlobalPolicy)
+	}
+
+	switch config.OOMReaction {
+	case autoscaler.OOMReactionNone, autoscaler.OOMReactionNotify, autoscaler.OOMReactionScale, autoscaler.OOMReactionBoth:
+	default:
+		fatal("Invalid OOM_REACTION: must be none, notify, scale, or both", "value", config.OOMReaction)
+	}
+
+	if err := scopeConfig(config); err != nil {
+		fatal("Invalid service scope", "error", err)
+	}
+	if len(config.ExcludeServices) > 0 {
+		slog.Info("Never touching excluded services", "patterns", config.ExcludeServices)
+	}
+
+	var clusters []cluster
+	for _, clusterConfig := range clusterConfigs(config) {
+		scaler, err := autoscaler.NewAutoscaler(clusterConfig)
+		if err != nil {
+			fatal("Failed to create autoscaler", "error", err)
+		}
+		defer scaler.Close()
+		if grafana != nil {
+			scaler.Events().Subscribe(grafana.Annotate, grafanaEvents...)
+		}
+		clusters = append(clusters, cluster{name: clusterConfig.ClusterName, scaler: scaler})
+	}
+	health.setClusters(clusters)
+	multiCluster := len(clusters) > 1
+	if multiCluster {
+		names := make([]string, len(clusters))
+		for i, c := range clusters {
+			names[i] = c.name
+		}
+		slog.Info("Autoscaling several clusters", "clusters", strings.Join(names, ","))
+	}
+	// The first cluster is served at the API root and runs the load probe
+	scaler := clusters[0].scaler
+
+	if metricsExporter != nil {
+		for _, c := range clusters {
+			if multiCluster {
+				metricsExporter.RegisterWithLabels(map[string]string{"cluster": c.name}, c.scaler)
+			} else {
+				metricsExporter.Register(c.scaler)
+			}
+		}
+	}
+
+	// Runs requested with SIGUSR1 or the API are queued for the loop; more
+	// requests while one is queued are merged into it
+	reconcile := make(chan struct{}, 1)
+	triggerReconcile := func() bool {
+		select {
+		case reconcile <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			slog.Info("Received SIGUSR1, requesting a run", "queued", triggerReconcile())
+		}
+	}()
+
+	if scaler.ApprovalEnabled() {
+		// Proposals can only be approved through the API
+		if !apiEnabled || !apiTokens.Allow(api.ScopeApprove) {
+			fatal("Manual approval requires the API and a token with the approve scope, e.g. APPROVAL_TOKEN")
+		}
+		slog.Info("Manual approval enabled", "above_replicas", config.ApprovalAboveReplicas,
+			"scale_down_labels", config.ApprovalScaleDownLabels, "ttl", config.ApprovalTTL)
+	}
+
+	if apiEnabled {
+		var prober *probe.Probe
+		if probeService := getEnv("PROBE_SERVICE", ""); probeService != "" {
+			prober = probe.New(probe.Config{
+				Service:      probeService,
+				LoadDuration: time.Duration(getEnvInt("PROBE_LOAD_SECONDS", 300)) * time.Second,
+				Timeout:      time.Duration(getEnvInt("PROBE_TIMEOUT_SECONDS", 600)) * time.Second,
+			}, scaler.ServiceManager())
+			// A running probe stops on shutdown
+			context.AfterFunc(ctx, prober.Close)
+			slog.Info("Synthetic load probe enabled", "service", probeService)
+		}
+		for i, c := range clusters {
+			var clusterProber *probe.Probe
+			if i == 0 {
+				clusterProber = prober
+			}
+			server := api.NewServer(c.scaler, clusterProber)
+			server.SetTokens(apiTokens)
+			server.SetReconcile(triggerReconcile)
+			if i == 0 {
+				server.Register(mux)
+			}
+			// Every cluster's API is also served under /clusters/<name>
+			if multiCluster {
+				clusterMux := http.NewServeMux()
+				server.Register(clusterMux)
+				mux.Handle("/clusters/"+c.name+"/", http.StripPrefix("/clusters/"+c.name, clusterMux))
+			}
+		}
+	}
+
+	// Watchers stop on the shutdown signal, but like runs, their actions
+	// are only cancelled after the drain timeout
+	var watchers sync.WaitGroup
+	watch := func(w func(ctx, actionCtx context.Context)) {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			w(ctx, runCtx)
+		}()
+	}
+	for _, c := range clusters {
+		watch(c.scaler.WatchOOMKills)
+		if getEnv("SERVICE_EVENTS", "yes") == "yes" {
+			watch(c.scaler.WatchServices)
+		}
 	}
-	defer scaler.Close()
 
 	// Wait for Prometheus to be ready (up to 10 retries with exponential backoff)
-	if err := scaler.PrometheusClient().WaitForPrometheus(ctx, 10); err != nil {
-		log.Fatalf("Failed to connect to Prometheus: %v", err)
+	for _, c := range clusters {
+		err := c.scaler.PrometheusClient().WaitForPrometheus(ctx, 10)
+		if err == nil {
+			continue
+		}
+		switch startupPolicy {
+		case "degraded":
+			c.scaler.EnterDegraded(ctx, err)
+		case "exporter-only":
+			slog.Warn("Prometheus not ready, only exporting metrics until it is", "error", err)
+			for err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				err = c.scaler.PrometheusClient().WaitForPrometheus(ctx, 10)
+			}
+		default:
+			fatal("Failed to connect to Prometheus", "error", err)
+		}
 	}
 
-	log.Printf("CPU Upper Limit: %.0f%%", config.CPUUpperLimit)
-	log.Printf("CPU Lower Limit: %.0f%%", config.CPULowerLimit)
-	log.Printf("Memory Upper Limit: %.0f%%", config.MemoryUpperLimit)
-	log.Printf("Memory Lower Limit: %.0f%%", config.MemoryLowerLimit)
+	slog.Info("Thresholds", "cpu_upper_limit", config.CPUUpperLimit, "cpu_lower_limit", config.CPULowerLimit,
+		"memory_upper_limit", config.MemoryUpperLimit, "memory_lower_limit", config.MemoryLowerLimit,
+		"tolerance_percent", config.TolerancePercent)
 
 	// Run the autoscaler
-	log.Println("Starting autoscaler...")
+	slog.Info("Starting autoscaler")
 
 	// First run
-	if err := scaler.Run(ctx); err != nil {
-		log.Printf("Error during autoscaling run: %v", err)
+	health.start()
+	notifySystemd(systemd.Ready)
+	var summary *runSummary
+	if !loopEnabled {
+		summary = newRunSummary(clusters)
 	}
+	errs := evaluate(runCtx, clusters, autoscaler.Evaluation{ScaleUp: true, ScaleDown: true}, "autoscaling run")
 
 	if !loopEnabled {
-		log.Println("Loop disabled, exiting after one run")
+		exitCode = summary.finish(clusters, errs)
+		slog.Info("Loop disabled, exiting after one run", "result", summary.Result, "exit_code", exitCode)
+		if err := summary.print(os.Stdout); err != nil {
+			slog.Error("Failed to print the run summary", "error", err)
+		}
 		return
 	}
 
-	// Continuous loop
-	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	// Continuous loop. Scale-up runs on the main ticker; when the scale-down
+	// interval differs, scale-down gets its own ticker.
+	ticker := time.NewTicker(time.Duration(scaleUpIntervalSeconds) * time.Second)
 	defer ticker.Stop()
 
+	var scaleDownTick <-chan time.Time
+	if scaleDownIntervalSeconds != scaleUpIntervalSeconds {
+		scaleDownTicker := time.NewTicker(time.Duration(scaleDownIntervalSeconds) * time.Second)
+		defer scaleDownTicker.Stop()
+		scaleDownTick = scaleDownTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Shutting down autoscaler")
+			watchers.Wait()
+			close(drained)
+			slog.Info("Shutting down autoscaler")
+			for _, c := range clusters {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				c.scaler.ReleaseBackpressure(releaseCtx)
+				cancel()
+				if shutdownRestore != autoscaler.RestoreNone {
+					restoreCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					if err := c.scaler.Restore(restoreCtx, shutdownRestore); err != nil {
+						c.scaler.Logger().Error("Failed to restore services on shutdown", "error", err)
+					}
+					cancel()
+				}
+			}
 			return
 		case <-ticker.C:
-			log.Printf("Waiting %d seconds for the next check...", intervalSeconds)
-			if err := scaler.Run(ctx); err != nil {
-				log.Printf("Error during autoscaling run: %v", err)
+			// select picks randomly when a tick and the shutdown coincide
+			if ctx.Err() != nil {
+				continue
 			}
+			slog.Debug("Starting the next check", "interval_seconds", scaleUpIntervalSeconds)
+			eval := autoscaler.Evaluation{ScaleUp: true, ScaleDown: scaleDownTick == nil}
+			evaluate(runCtx, clusters, eval, "autoscaling run")
+		case <-scaleDownTick:
+			if ctx.Err() != nil {
+				continue
+			}
+			evaluate(runCtx, clusters, autoscaler.Evaluation{ScaleDown: true}, "scale-down run")
+		case <-reconcile:
+			if ctx.Err() != nil {
+				continue
+			}
+			slog.Info("Starting a requested run")
+			evaluate(runCtx, clusters, autoscaler.Evaluation{ScaleUp: true, ScaleDown: true}, "requested run")
 		}
 	}
 }
@@ -173,3 +746,81 @@ func getEnvFloat(key string, defaultValue float64) float64 {
 	}
 	return defaultValue
 }
+
+// getEnvDuration gets a duration environment variable such as "30s" or "2m"
+// with a default value. Plain numbers are interpreted as seconds.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvSecret gets a credential from an environment variable, or from the
+// file named by the variable with the _FILE suffix, e.g. a Docker secret
+func getEnvSecret(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getAPITokens reads the API tokens from API_TOKENS, which grant scopes,
+// e.g. read for dashboards and approve for on-call tooling.
+// APPROVAL_TOKEN, DISASTER_TOKEN, RECONCILE_TOKEN and PROBE_TOKEN are
+// tokens with a single scope.
+func getAPITokens() (api.Tokens, error) {
+	spec, err := getEnvSecret("API_TOKENS")
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := api.ParseTokens(spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, single := range []struct{ env, scope string }{
+		{"APPROVAL_TOKEN", api.ScopeApprove},
+		{"DISASTER_TOKEN", api.ScopeDisaster},
+		{"RECONCILE_TOKEN", api.ScopeReconcile},
+		{"PROBE_TOKEN", api.ScopeProbe},
+	} {
+		if value := getEnv(single.env, ""); value != "" {
+			tokens = append(tokens, api.Token{Name: single.env, Value: value, Scopes: []string{single.scope}})
+		}
+	}
+	return tokens, nil
+}
+
+// getEnvList parses a comma-separated list, dropping empty entries
+func getEnvList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap parses a comma-separated list of key=value pairs
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			continue
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result
+}
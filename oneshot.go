@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/dxas90/scalebee/pkg/events"
+)
+
+// Exit codes of a one-shot run, with LOOP=no. Failures before the run, e.g.
+// an invalid configuration, exit with exitErrors as well.
+const (
+	exitNoAction = 0
+	exitErrors   = 1
+	exitScaled   = 2
+)
+
+// Results of a one-shot run, matching the exit codes
+const (
+	resultNoAction = "no_action"
+	resultScaled   = "scaled"
+	resultErrors   = "errors"
+)
+
+// runSummary is the outcome of a one-shot run, printed as JSON to stdout
+type runSummary struct {
+	Result   string         `json:"result"`
+	Services int            `json:"services"`
+	Actions  []events.Event `json:"actions"`
+	Skipped  int            `json:"skipped"`
+	Errors   []summaryError `json:"errors"`
+
+	mu sync.Mutex
+}
+
+// summaryError is an error of a one-shot run
+type summaryError struct {
+	Cluster string `json:"cluster,omitempty"`
+	Service string `json:"service,omitempty"`
+	Error   string `json:"error"`
+}
+
+// newRunSummary creates a summary fed by the events of every cluster
+func newRunSummary(clusters []cluster) *runSummary {
+	s := &runSummary{Actions: []events.Event{}, Errors: []summaryError{}}
+	for _, c := range clusters {
+		c.scaler.Events().Subscribe(s.record, events.TypeScaled, events.TypeSkipped, events.TypeError)
+	}
+	return s
+}
+
+// record adds an event to the summary. Events of the watchers belong to no
+// run and are left out.
+func (s *runSummary) record(ctx context.Context, e events.Event) {
+	if e.RunID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch e.Type {
+	case events.TypeScaled:
+		s.Actions = append(s.Actions, e)
+	case events.TypeSkipped:
+		s.Skipped++
+	case events.TypeError:
+		s.Errors = append(s.Errors, summaryError{Cluster: e.Cluster, Service: e.Service, Error: e.Error})
+	}
+}
+
+// finish completes the summary with the evaluated services and the run
+// errors returned by evaluate, and returns the exit code
+func (s *runSummary) finish(clusters []cluster, errs []error) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, c := range clusters {
+		s.Services += c.scaler.Services()
+		// Most run errors were published as events already
+		if errs[i] != nil && !s.hasError(c.name, errs[i].Error()) {
+			s.Errors = append(s.Errors, summaryError{Cluster: c.name, Error: errs[i].Error()})
+		}
+	}
+
+	switch {
+	case len(s.Errors) > 0:
+		s.Result = resultErrors
+		return exitErrors
+	case len(s.Actions) > 0:
+		s.Result = resultScaled
+		return exitScaled
+	default:
+		s.Result = resultNoAction
+		return exitNoAction
+	}
+}
+
+// hasError reports whether the summary has an error of a cluster with the
+// given message; s.mu must be held
+func (s *runSummary) hasError(cluster, message string) bool {
+	for _, e := range s.Errors {
+		if e.Cluster == cluster && e.Error == message {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes the summary as a single line of JSON
+func (s *runSummary) print(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(w).Encode(s)
+}
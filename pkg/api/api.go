@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/autoscaler"
+	"github.com/dxas90/scalebee/pkg/events"
+	"github.com/dxas90/scalebee/pkg/probe"
+)
+
+// Server exposes the autoscaler state over a JSON HTTP API
+type Server struct {
+	scaler *autoscaler.Autoscaler
+	probe  *probe.Probe
+
+	// tokens authorize the endpoints that change the autoscaler
+	tokens Tokens
+	// reconcile requests a run and reports whether it was queued
+	reconcile func() bool
+}
+
+// NewServer creates a new API server for the given autoscaler. The probe is
+// optional and may be nil.
+func NewServer(scaler *autoscaler.Autoscaler, prober *probe.Probe) *Server {
+	return &Server{
+		scaler: scaler,
+		probe:  prober,
+	}
+}
+
+// SetTokens sets the bearer tokens that authorize changes. Approvals,
+// disaster mode changes, manual runs and probes are disabled without a
+// token granting their scope.
+func (s *Server) SetTokens(tokens Tokens) {
+	s.tokens = tokens
+}
+
+// SetReconcile enables manual runs. trigger requests a run and reports
+// false when one is already queued.
+func (s *Server) SetReconcile(trigger func() bool) {
+	s.reconcile = trigger
+}
+
+// Register mounts the API routes on the given mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/skips", s.handleSkips)
+	mux.HandleFunc("GET /api/v1/events", s.handleEvents)
+	mux.HandleFunc("GET /api/v1/prometheus", s.handlePrometheus)
+	mux.HandleFunc("POST /api/v1/validate", s.handleValidate)
+	mux.HandleFunc("GET /api/v1/recommendations", s.handleRecommendations)
+	mux.HandleFunc("GET /api/v1/probe", s.handleProbeResult)
+	mux.HandleFunc("POST /api/v1/probe", s.handleProbeStart)
+	mux.HandleFunc("GET /api/v1/approvals", s.handleApprovals)
+	mux.HandleFunc("POST /api/v1/approvals/{id}/approve", s.handleApprove)
+	mux.HandleFunc("POST /api/v1/approvals/{id}/deny", s.handleDeny)
+	mux.HandleFunc("GET /api/v1/disaster", s.handleDisaster)
+	mux.HandleFunc("POST /api/v1/disaster", s.handleDisasterSet)
+	mux.HandleFunc("DELETE /api/v1/disaster", s.handleDisasterSet)
+	mux.HandleFunc("POST /api/v1/reconcile", s.handleReconcile)
+}
+
+// handleSkips lists the labeled services skipped in the last cycle and why
+func (s *Server) handleSkips(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"skips": s.scaler.Skips(),
+	})
+}
+
+// handleEvents lists the latest events, newest first, optionally filtered
+// by ?service=, ?type= and capped by ?limit=
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := events.Filter{Service: query.Get("service"), Type: query.Get("type")}
+	if val := query.Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": s.scaler.EventHistory(filter),
+	})
+}
+
+// handlePrometheus reports the health of every Prometheus endpoint
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"endpoints": s.scaler.PrometheusHealth(),
+	})
+}
+
+// handleRecommendations suggests reservations and replica bounds from the
+// usage observed over ?window= (default 24h)
+func (s *Server) handleRecommendations(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if val := r.URL.Query().Get("window"); val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < time.Minute {
+			writeError(w, http.StatusBadRequest, "window must be a duration of at least 1m, e.g. 24h")
+			return
+		}
+		window = parsed
+	}
+
+	recommendations, err := s.scaler.Recommendations(r.Context(), window)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recommendations": recommendations,
+	})
+}
+
+// handleProbeResult reports the current or last synthetic load probe result
+func (s *Server) handleProbeResult(w http.ResponseWriter, r *http.Request) {
+	if s.probe == nil {
+		writeError(w, http.StatusNotFound, "probe is not configured")
+		return
+	}
+
+	result := s.probe.Result()
+	if result == nil {
+		writeError(w, http.StatusNotFound, "no probe has run yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleProbeStart starts a synthetic load probe
+func (s *Server) handleProbeStart(w http.ResponseWriter, r *http.Request) {
+	if s.probe == nil {
+		writeError(w, http.StatusNotFound, "probe is not configured")
+		return
+	}
+	if !s.authorize(w, r, ScopeProbe, "probes") {
+		return
+	}
+
+	// The probe outlives the request and runs until it is closed
+	if err := s.probe.Start(r.Context()); err != nil {
+		if errors.Is(err, probe.ErrRunning) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, s.probe.Result())
+}
+
+// handleApprovals lists pending and recently decided scaling proposals
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"proposals": s.scaler.Proposals(),
+	})
+}
+
+// handleApprove executes a pending scaling proposal
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ScopeApprove, "approvals") {
+		return
+	}
+
+	// The scale action should not be aborted halfway if the caller disconnects
+	proposal, err := s.scaler.Approve(context.WithoutCancel(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeProposalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, proposal)
+}
+
+// handleDeny rejects a pending scaling proposal
+func (s *Server) handleDeny(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ScopeApprove, "approvals") {
+		return
+	}
+
+	proposal, err := s.scaler.Deny(r.PathValue("id"))
+	if err != nil {
+		writeProposalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, proposal)
+}
+
+// handleDisaster reports whether disaster mode is active
+func (s *Server) handleDisaster(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scaler.Disaster())
+}
+
+// handleDisasterSet activates (POST) or clears (DELETE) disaster mode. The
+// optional JSON body {"reason": "..."} is recorded with the transition.
+func (s *Server) handleDisasterSet(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ScopeDisaster, "disaster mode changes") {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	token, _ := s.tokens.lookup(r)
+	if body.Reason == "" {
+		body.Reason = "requested from " + r.RemoteAddr
+	}
+
+	active := r.Method == http.MethodPost
+	status := s.scaler.SetDisaster(context.WithoutCancel(r.Context()), active, autoscaler.DisasterSourceAPI, token.Name, body.Reason)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleReconcile requests a run outside the interval, e.g. right after
+// deploying label changes. The run starts asynchronously.
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if s.reconcile == nil {
+		writeError(w, http.StatusNotFound, "manual runs are not configured")
+		return
+	}
+	if !s.authorize(w, r, ScopeReconcile, "manual runs") {
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]bool{"queued": s.reconcile()})
+}
+
+// authorize checks that the bearer token of a request that changes the
+// autoscaler grants the scope. The feature is reported as not configured
+// without a token granting it.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope, feature string) bool {
+	if !s.tokens.Allow(scope) {
+		writeError(w, http.StatusNotFound, feature+" are not configured")
+		return false
+	}
+
+	token, ok := s.tokens.lookup(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return false
+	}
+	if !token.Allows(scope) {
+		slog.Warn("API token lacks the scope of the request", "token", token.Name, "scope", scope, "path", r.URL.Path)
+		writeError(w, http.StatusForbidden, "token "+token.Name+" lacks the "+scope+" scope")
+		return false
+	}
+	return true
+}
+
+// writeProposalError maps approval errors to HTTP status codes
+func writeProposalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, autoscaler.ErrProposalNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, autoscaler.ErrProposalDecided), errors.Is(err, autoscaler.ErrProposalMoot):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write API response", "error", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
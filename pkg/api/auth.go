@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scopes of API tokens
+const (
+	// ScopeRead allows the metrics, /version and every GET endpoint
+	ScopeRead = "read"
+	// ScopeApprove allows approving and denying proposals
+	ScopeApprove = "approve"
+	// ScopeReconcile allows requesting manual runs
+	ScopeReconcile = "reconcile"
+	// ScopeProbe allows starting synthetic load probes
+	ScopeProbe = "probe"
+	// ScopeDisaster allows activating and clearing disaster mode
+	ScopeDisaster = "disaster"
+	// ScopeAdmin allows everything
+	ScopeAdmin = "admin"
+)
+
+var scopes = []string{ScopeRead, ScopeApprove, ScopeReconcile, ScopeProbe, ScopeDisaster, ScopeAdmin}
+
+// Token is a bearer token with the scopes it grants. The name identifies
+// the holder in logs and recorded reasons.
+type Token struct {
+	Name   string
+	Value  string
+	Scopes []string
+}
+
+// Allows reports whether the token grants a scope
+func (t Token) Allows(scope string) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
+
+// Tokens are the API tokens of a server
+type Tokens []Token
+
+// ParseTokens parses tokens separated by commas or newlines, each in the
+// form name:scope+scope:token, e.g. "grafana:read:s3cr3t"
+func ParseTokens(spec string) (Tokens, error) {
+	var tokens Tokens
+	for i, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		// The entry isn't quoted, it may be a bare token
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid token %d: must be name:scopes:token", i+1)
+		}
+		token := Token{Name: parts[0], Value: parts[2], Scopes: strings.Split(parts[1], "+")}
+		for _, scope := range token.Scopes {
+			if !slices.Contains(scopes, scope) {
+				return nil, fmt.Errorf("invalid scope %q of token %s: must be one of %s", scope, token.Name, strings.Join(scopes, ", "))
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Allow reports whether any token grants a scope
+func (ts Tokens) Allow(scope string) bool {
+	return slices.ContainsFunc(ts, func(t Token) bool { return t.Allows(scope) })
+}
+
+// lookup returns the token a request carries as bearer token
+func (ts Tokens) lookup(r *http.Request) (Token, bool) {
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Token{}, false
+	}
+	for _, t := range ts {
+		if equal(value, t.Value) {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// Credentials protect the HTTP server. A request authenticates with basic
+// auth when Username is set, or with BearerToken or one of Tokens.
+type Credentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+	Tokens      Tokens
+}
+
+// Protect requires credentials for every request to next, except for the
+// public paths, once a username, a bearer token or a token with the read
+// scope is set. Reading takes the read scope, which the username and
+// bearer token grant; other requests pass on to the API, which checks the
+// scope of the endpoint.
+func Protect(next http.Handler, creds Credentials, public ...string) http.Handler {
+	if creds.Username == "" && creds.BearerToken == "" && !creds.Tokens.Allow(ScopeRead) {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := creds.authenticate(r)
+		if !ok {
+			if creds.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="ScaleBee"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !token.Allows(ScopeRead) {
+			writeError(w, http.StatusForbidden, "token "+token.Name+" lacks the read scope")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the token of a request. Basic auth and the bearer
+// token grant the read scope.
+func (c Credentials) authenticate(r *http.Request) (Token, bool) {
+	server := Token{Name: "server", Scopes: []string{ScopeRead}}
+	if user, password, ok := r.BasicAuth(); ok {
+		return server, c.Username != "" && equal(user, c.Username) && equal(password, c.Password)
+	}
+
+	if token, ok := c.Tokens.lookup(r); ok {
+		return token, true
+	}
+	if c.BearerToken != "" {
+		server.Value = c.BearerToken
+		return Tokens{server}.lookup(r)
+	}
+	return Token{}, false
+}
+
+// equal compares credentials in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
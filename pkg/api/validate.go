@@ -0,0 +1,215 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// maxStackFileSize bounds the size of stack files accepted for validation
+const maxStackFileSize = 1 << 20
+
+// stackFile is the subset of a compose/stack file relevant to autoscaling
+type stackFile struct {
+	Services map[string]struct {
+		Labels interface{} `yaml:"labels"`
+		Deploy struct {
+			Mode     string      `yaml:"mode"`
+			Replicas *int        `yaml:"replicas"`
+			Labels   interface{} `yaml:"labels"`
+		} `yaml:"deploy"`
+	} `yaml:"services"`
+}
+
+// ValidationIssue is a problem with the labels of one service
+type ValidationIssue struct {
+	Service string `json:"service"`
+	docker.LabelIssue
+}
+
+// ValidationResult is the response of the validation endpoint
+type ValidationResult struct {
+	Valid    bool              `json:"valid"`
+	Errors   []ValidationIssue `json:"errors"`
+	Warnings []ValidationIssue `json:"warnings"`
+}
+
+// handleValidate validates the swarm.autoscaler.* labels of a compose/stack
+// file, and the services against the policy of this instance, so CI
+// pipelines can reject it before docker stack deploy. ?stack= names the
+// stack it will be deployed as.
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStackFileSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to read request body: %v", err))
+		return
+	}
+
+	var stack stackFile
+	if err := yaml.Unmarshal(body, &stack); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse stack file: %v", err))
+		return
+	}
+
+	result := s.validateStack(stack, r.URL.Query().Get("stack"))
+
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
+
+// validateStack checks every service of a stack file, deployed as the named
+// stack when it is set
+func (s *Server) validateStack(stack stackFile, stackName string) ValidationResult {
+	result := ValidationResult{
+		Errors:   []ValidationIssue{},
+		Warnings: []ValidationIssue{},
+	}
+
+	names := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc := stack.Services[name]
+		addError := func(label, format string, args ...interface{}) {
+			result.Errors = append(result.Errors, ValidationIssue{name, docker.LabelIssue{Label: label, Message: fmt.Sprintf(format, args...)}})
+		}
+		addWarning := func(label, format string, args ...interface{}) {
+			result.Warnings = append(result.Warnings, ValidationIssue{name, docker.LabelIssue{Label: label, Message: fmt.Sprintf(format, args...)}})
+		}
+
+		deployLabels, err := parseLabels(svc.Deploy.Labels)
+		if err != nil {
+			addError("", "invalid deploy.labels: %v", err)
+			continue
+		}
+		containerLabels, err := parseLabels(svc.Labels)
+		if err != nil {
+			addError("", "invalid labels: %v", err)
+			continue
+		}
+
+		// Labels set only on containers are ignored unless the fallback is on
+		labels := deployLabels
+		for k, v := range containerLabels {
+			if !strings.HasPrefix(k, docker.LabelPrefix) {
+				continue
+			}
+			if _, ok := deployLabels[k]; ok {
+				if deployLabels[k] != v {
+					addWarning(k, "container label %q differs from deploy label %q, the deploy label wins", v, deployLabels[k])
+				}
+				continue
+			}
+			if !s.scaler.ContainerLabelFallback() {
+				addError(k, "set as a container label, but ScaleBee only reads deploy.labels (CONTAINER_LABEL_FALLBACK is disabled)")
+				continue
+			}
+			addWarning(k, "set as a container label, move it to deploy.labels")
+			labels[k] = v
+		}
+
+		for _, issue := range docker.ValidateLabels(labels) {
+			result.Errors = append(result.Errors, ValidationIssue{name, issue})
+		}
+
+		if labels[docker.LabelPrefix] != "true" {
+			continue
+		}
+
+		// The scope matches the names Swarm gives the services of a stack,
+		// <stack>_<service>, so it needs the stack name
+		if stackName != "" {
+			if serviceName := stackName + "_" + name; !s.scaler.InScope(serviceName, stackName) {
+				addError("", "service %s is outside the scope of this instance (AUTOSCALE_STACKS, INCLUDE_SERVICES, EXCLUDE_SERVICES) and won't be autoscaled", serviceName)
+			}
+		} else if s.scaler.Scoped() {
+			addWarning("", "autoscaling is limited by AUTOSCALE_STACKS, INCLUDE_SERVICES or EXCLUDE_SERVICES, pass ?stack= to check the service")
+		}
+		if approval := s.scaler.ApprovalAboveReplicas(); approval > 0 {
+			if max, ok := intValue(labels, docker.LabelPrefix+".maximum"); ok && max > approval {
+				addWarning(docker.LabelPrefix+".maximum", "scale-ups beyond %d replicas wait for manual approval (APPROVAL_ABOVE_REPLICAS)", approval)
+			}
+		}
+
+		// Jobs are scaled by their backlog and global services by labelling
+		// nodes, so both need the labels that drive them
+		switch svc.Deploy.Mode {
+		case "", "replicated":
+		case "replicated-job":
+			if labels[docker.LabelPrefix+".job.query"] == "" {
+				addError(docker.LabelPrefix+".job.query", "required to autoscale a replicated job")
+			}
+		case "global":
+			if labels[docker.LabelPrefix+".global.node_label"] == "" {
+				addError(docker.LabelPrefix+".global.node_label", "required to autoscale a global service")
+			}
+		default:
+			addError("", "autoscaling requires replicated, replicated-job or global mode, got %q", svc.Deploy.Mode)
+		}
+
+		if svc.Deploy.Replicas != nil {
+			replicas := *svc.Deploy.Replicas
+			if min, ok := intValue(labels, docker.LabelPrefix+".minimum"); ok && replicas < min {
+				addWarning("", "deploy.replicas %d is below the minimum %d and will be raised", replicas, min)
+			}
+			if max, ok := intValue(labels, docker.LabelPrefix+".maximum"); ok && max > 0 && replicas > max {
+				addWarning("", "deploy.replicas %d is above the maximum %d and will be lowered", replicas, max)
+			}
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// parseLabels converts compose labels, either a list of "key=value" strings
+// or a mapping, into a map
+func parseLabels(raw interface{}) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	switch v := raw.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("label %v is not a string", item)
+			}
+			key, value, _ := strings.Cut(str, "=")
+			labels[key] = value
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == nil {
+				labels[key] = ""
+				continue
+			}
+			labels[key] = fmt.Sprint(value)
+		}
+	default:
+		return nil, fmt.Errorf("labels must be a list or a mapping")
+	}
+
+	return labels, nil
+}
+
+// intValue returns the integer value of a label if it is set and valid
+func intValue(labels map[string]string, key string) (int, bool) {
+	var n int
+	if _, err := fmt.Sscanf(labels[key], "%d", &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,248 @@
+package autoscaler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/events"
+)
+
+// Proposal statuses
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalDenied   = "denied"
+	ProposalExpired  = "expired"
+	ProposalFailed   = "failed"
+)
+
+// Errors returned when deciding on a proposal
+var (
+	ErrProposalNotFound = errors.New("proposal not found")
+	ErrProposalDecided  = errors.New("proposal is no longer pending")
+	// ErrProposalMoot is returned when the service was scaled past the
+	// proposed replicas since, so the action would go the other way
+	ErrProposalMoot = errors.New("proposal no longer applies")
+)
+
+// Proposal is a scaling action waiting for manual approval
+type Proposal struct {
+	ID           string    `json:"id"`
+	Service      string    `json:"service"`
+	Direction    string    `json:"direction"`
+	Reason       string    `json:"reason"`
+	FromReplicas int       `json:"from_replicas"`
+	ToReplicas   int       `json:"to_replicas"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+
+	serviceID string
+}
+
+// ApprovalEnabled reports whether any scaling action can require approval
+func (a *Autoscaler) ApprovalEnabled() bool {
+	return a.config.ApprovalAboveReplicas > 0 || len(a.config.ApprovalScaleDownLabels) > 0
+}
+
+// needsApproval reports whether an action has enough impact to require
+// approval: scaling beyond ApprovalAboveReplicas, or scaling down a service
+// matching ApprovalScaleDownLabels
+func (a *Autoscaler) needsApproval(config *docker.ServiceConfig, direction string, newReplicas int) bool {
+	if direction == DirectionUp {
+		return a.config.ApprovalAboveReplicas > 0 && newReplicas > a.config.ApprovalAboveReplicas
+	}
+
+	if len(a.config.ApprovalScaleDownLabels) == 0 {
+		return false
+	}
+	for key, value := range a.config.ApprovalScaleDownLabels {
+		if config.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// propose records a pending proposal for an action and sends it to the
+// notifiers, unless one is already pending for the service in that direction
+func (a *Autoscaler) propose(ctx context.Context, config *docker.ServiceConfig, direction, reason string, from, to int) {
+	now := time.Now()
+
+	a.mu.Lock()
+	a.expireProposals(now)
+	for _, p := range a.proposals {
+		if p.serviceID == config.ID && p.Status == ProposalPending {
+			if p.Direction == direction {
+				a.mu.Unlock()
+				a.skip(ctx, config.Name, SkipAwaitingApproval, "proposal %s expires in %v", p.ID, p.ExpiresAt.Sub(now).Round(time.Second))
+				return
+			}
+			// The load changed direction, so the old proposal is moot
+			p.Status = ProposalExpired
+		}
+	}
+
+	p := &Proposal{
+		ID:           newProposalID(),
+		Service:      config.Name,
+		Direction:    direction,
+		Reason:       reason,
+		FromReplicas: from,
+		ToReplicas:   to,
+		Status:       ProposalPending,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(a.config.ApprovalTTL),
+		serviceID:    config.ID,
+	}
+	a.proposals[p.ID] = p
+	a.mu.Unlock()
+
+	a.log.InfoContext(ctx, "Scaling requires approval", "service", config.Name, "direction", direction, "from", from, "to", to, "proposal", p.ID)
+	a.skip(ctx, config.Name, SkipAwaitingApproval, "proposal %s created", p.ID)
+
+	// Proposals are critical so they bypass digests and arrive before expiring
+	a.publish(ctx, events.Event{
+		Type:    events.TypeProposed,
+		Service: config.Name,
+		Message: fmt.Sprintf("Approval required to scale %s service %s from %d to %d replicas (proposal %s, expires in %v)",
+			direction, config.Name, from, to, p.ID, a.config.ApprovalTTL),
+		Critical:     true,
+		Reason:       reason,
+		Direction:    direction,
+		FromReplicas: from,
+		ToReplicas:   to,
+		ProposalID:   p.ID,
+	})
+}
+
+// Proposals returns all proposals that are pending or were decided within
+// the last TTL, newest first
+func (a *Autoscaler) Proposals() []Proposal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.expireProposals(time.Now())
+
+	proposals := make([]Proposal, 0, len(a.proposals))
+	for _, p := range a.proposals {
+		proposals = append(proposals, *p)
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].CreatedAt.After(proposals[j].CreatedAt)
+	})
+	return proposals
+}
+
+// Approve executes a pending proposal. The action is re-checked against the
+// service's current bounds, and fails if the service was recreated.
+func (a *Autoscaler) Approve(ctx context.Context, id string) (Proposal, error) {
+	p, err := a.decide(id, ProposalApproved)
+	if err != nil {
+		return Proposal{}, err
+	}
+
+	if err := a.executeProposal(ctx, &p); err != nil {
+		a.log.ErrorContext(ctx, "Failed to execute approved proposal", "proposal", id, "error", err)
+		a.mu.Lock()
+		a.proposals[id].Status = ProposalFailed
+		a.proposals[id].Error = err.Error()
+		p = *a.proposals[id]
+		a.mu.Unlock()
+		return p, err
+	}
+
+	return p, nil
+}
+
+// Deny rejects a pending proposal
+func (a *Autoscaler) Deny(id string) (Proposal, error) {
+	p, err := a.decide(id, ProposalDenied)
+	if err == nil {
+		a.log.Info("Proposal denied", "proposal", id, "service", p.Service, "direction", p.Direction)
+	}
+	return p, err
+}
+
+// decide moves a pending proposal to a final status
+func (a *Autoscaler) decide(id, status string) (Proposal, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.expireProposals(time.Now())
+
+	p, ok := a.proposals[id]
+	if !ok {
+		return Proposal{}, ErrProposalNotFound
+	}
+	if p.Status != ProposalPending {
+		return *p, ErrProposalDecided
+	}
+	p.Status = status
+	return *p, nil
+}
+
+// executeProposal applies an approved proposal
+func (a *Autoscaler) executeProposal(ctx context.Context, p *Proposal) error {
+	config, err := a.serviceConfig(ctx, p.Service)
+	if err != nil {
+		return err
+	}
+	if config.ID != p.serviceID {
+		return fmt.Errorf("service %s was recreated after the proposal", p.Service)
+	}
+	if config.Updating {
+		return fmt.Errorf("service %s has a rolling update in progress", p.Service)
+	}
+	if p.Direction == DirectionDown && a.scaleDownBlocked() {
+		return fmt.Errorf("scale-downs of service %s are disabled in disaster mode", p.Service)
+	}
+
+	to := p.ToReplicas
+	if config.MaxReplicas > 0 && to > config.MaxReplicas {
+		to = config.MaxReplicas
+	}
+	if to < config.MinReplicas {
+		to = config.MinReplicas
+	}
+
+	from := int(config.DesiredReplicas)
+	if to == from {
+		return nil
+	}
+	if (p.Direction == DirectionUp) != (to > from) {
+		return fmt.Errorf("%w: service %s has %d replicas now, proposed scale %s to %d",
+			ErrProposalMoot, p.Service, from, p.Direction, to)
+	}
+
+	a.log.InfoContext(ctx, "Proposal approved, scaling", "proposal", p.ID, "service", p.Service, "direction", p.Direction, "from", from, "to", to)
+	return a.applyScale(ctx, config, p.Direction, p.Reason, from, to)
+}
+
+// expireProposals marks pending proposals past their TTL as expired and
+// forgets decided ones after another TTL. Callers must hold a.mu.
+func (a *Autoscaler) expireProposals(now time.Time) {
+	for id, p := range a.proposals {
+		if p.Status == ProposalPending && now.After(p.ExpiresAt) {
+			a.log.Info("Proposal expired", "proposal", id, "service", p.Service, "direction", p.Direction)
+			p.Status = ProposalExpired
+		}
+		if p.Status != ProposalPending && now.After(p.ExpiresAt.Add(a.config.ApprovalTTL)) {
+			delete(a.proposals, id)
+		}
+	}
+}
+
+// newProposalID returns a random proposal ID
+func newProposalID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,224 @@
+package autoscaler
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// appMember is a service of an application with its metrics of this cycle
+type appMember struct {
+	config *docker.ServiceConfig
+	// tasks is the number of tasks the service's averages are taken over
+	tasks  int
+	cpu    float64
+	memory float64
+	// max is the replica cap during this cycle (0 for none)
+	max int
+}
+
+// evaluateApps scales the services of each application
+// (swarm.autoscaler.app) together
+func (a *Autoscaler) evaluateApps(ctx context.Context, eval Evaluation, apps map[string][]*appMember) {
+	for app, members := range apps {
+		a.evaluateApp(ctx, eval, app, members)
+	}
+}
+
+// evaluateApp combines the metrics of an application's services into one
+// scaling decision, and distributes the resulting replicas across the
+// services in proportion to their weights
+func (a *Autoscaler) evaluateApp(ctx context.Context, eval Evaluation, app string, members []*appMember) {
+	var tasks, total, step int
+	var cpu, memory float64
+	for _, m := range members {
+		tasks += m.tasks
+		cpu += m.cpu * float64(m.tasks)
+		memory += m.memory * float64(m.tasks)
+		total += int(m.config.DesiredReplicas)
+		step += m.config.StepSize()
+	}
+	// Weigh each service's averages by its tasks, as if it were one service
+	cpu /= float64(tasks)
+	memory /= float64(tasks)
+
+	a.log.DebugContext(ctx, "App usage", "app", app, "services", len(members), "replicas", total, "cpu_percent", cpu, "memory_percent", memory)
+
+	var direction, reason string
+	var target int
+	cpuHigh := a.aboveUpper(cpu, a.config.CPUUpperLimit)
+	memoryHigh := a.aboveUpper(memory, a.config.MemoryUpperLimit)
+	switch {
+	case cpuHigh || memoryHigh:
+		if !eval.ScaleUp {
+			return
+		}
+		direction, target = DirectionUp, total+step
+		switch {
+		case cpuHigh && memoryHigh:
+			reason = "cpu_and_memory"
+		case cpuHigh:
+			reason = "cpu"
+		default:
+			reason = "memory"
+		}
+	case a.belowLower(cpu, a.config.CPULowerLimit) && a.belowLower(memory, a.config.MemoryLowerLimit):
+		if !eval.ScaleDown {
+			return
+		}
+		direction, reason, target = DirectionDown, "low_utilization", total-step
+	default:
+		for _, m := range members {
+			a.relieveBackpressure(ctx, m.config)
+		}
+		return
+	}
+	if direction == DirectionDown {
+		for _, m := range members {
+			a.relieveBackpressure(ctx, m.config)
+		}
+		if a.scaleDownBlocked() {
+			for _, m := range members {
+				a.skip(ctx, m.config.Name, SkipDisaster, "scale-downs of app %s are disabled in disaster mode", app)
+			}
+			return
+		}
+	}
+
+	if direction == DirectionUp && appSaturated(members) {
+		a.log.InfoContext(ctx, "App is saturated at the maximum replicas of all its services", "app", app)
+		for _, m := range members {
+			a.skip(ctx, m.config.Name, SkipAtMaximum, "%d replicas, app %s is saturated", m.config.MaxReplicas, app)
+			a.engageBackpressure(ctx, m.config, reason)
+		}
+		return
+	}
+
+	critical := cpu > a.config.CPUCriticalLimit || memory > a.config.MemoryCriticalLimit
+	for _, m := range members {
+		m.max = m.config.MaxReplicas
+		if soft := m.config.SoftMaxReplicas; soft > 0 && !critical && (m.max == 0 || soft < m.max) {
+			m.max = soft
+		}
+	}
+
+	targets := distribute(members, target)
+	a.log.InfoContext(ctx, "Scaling app", "app", app, "direction", direction, "from", total, "to", target, "targets", targets)
+
+	for i, m := range members {
+		from, to := int(m.config.DesiredReplicas), targets[i]
+		// Only move services in the app's direction, so a skewed split is
+		// corrected gradually instead of shuffling replicas between services
+		if (direction == DirectionUp && to <= from) || (direction == DirectionDown && to >= from) {
+			continue
+		}
+		if err := a.scaleMember(ctx, m, direction, reason, from, to, cpu, memory); err != nil {
+			a.log.ErrorContext(ctx, "Failed to scale service of app", "service", m.config.Name, "app", app, "direction", direction, "error", err)
+			a.notify(ctx, m.config.Name, true, "Failed to scale %s service %s: %v", direction, m.config.Name, err)
+			a.fireError(ctx, m.config.Name, err)
+		}
+	}
+}
+
+// scaleMember applies an application's plan to one of its services, subject
+// to the same guards as services scaled on their own
+func (a *Autoscaler) scaleMember(ctx context.Context, m *appMember, direction, reason string, from, to int, cpu, memory float64) error {
+	config := m.config
+
+	if !a.allowDecision(ctx, Decision{
+		Service: config.Name, Direction: direction, Reason: reason,
+		CPUPercent: cpu, MemoryPercent: memory, Replicas: config.DesiredReplicas,
+	}) {
+		a.skip(ctx, config.Name, SkipVetoed, "scale-%s vetoed by a decision hook", direction)
+		return nil
+	}
+
+	to, ok := a.guardScale(ctx, config, direction, from, to)
+	if !ok {
+		return nil
+	}
+
+	if a.needsApproval(config, direction, to) {
+		a.propose(ctx, config, direction, reason, from, to)
+		return nil
+	}
+
+	a.log.InfoContext(ctx, "Scaling service", "service", config.Name, "direction", direction, "from", from, "to", to)
+	return a.applyScale(ctx, config, direction, reason, from, to)
+}
+
+// appSaturated reports whether every service of an application is at its
+// maximum replicas
+func appSaturated(members []*appMember) bool {
+	for _, m := range members {
+		if m.config.MaxReplicas == 0 || int(m.config.DesiredReplicas) < m.config.MaxReplicas {
+			return false
+		}
+	}
+	return true
+}
+
+// distribute splits total replicas across an application's services in
+// proportion to their weights. Services whose share falls outside their
+// bounds are pinned to the bound and the rest is split among the others;
+// fractions go to the services with the largest remainders.
+func distribute(members []*appMember, total int) []int {
+	targets := make([]int, len(members))
+	pinned := make([]bool, len(members))
+
+	for {
+		remaining := total
+		var weight float64
+		for i, m := range members {
+			if pinned[i] {
+				remaining -= targets[i]
+			} else {
+				weight += m.config.AppWeight
+			}
+		}
+		if weight == 0 {
+			return targets
+		}
+
+		changed := false
+		for i, m := range members {
+			if pinned[i] {
+				continue
+			}
+			share := float64(remaining) * m.config.AppWeight / weight
+			if share < float64(m.config.MinReplicas) {
+				targets[i], pinned[i], changed = m.config.MinReplicas, true, true
+			} else if m.max > 0 && share > float64(m.max) {
+				targets[i], pinned[i], changed = m.max, true, true
+			}
+		}
+		if changed {
+			continue
+		}
+
+		type remainder struct {
+			index    int
+			fraction float64
+		}
+		var remainders []remainder
+		assigned := 0
+		for i, m := range members {
+			if pinned[i] {
+				continue
+			}
+			share := float64(remaining) * m.config.AppWeight / weight
+			targets[i] = int(math.Floor(share))
+			assigned += targets[i]
+			remainders = append(remainders, remainder{i, share - math.Floor(share)})
+		}
+		sort.SliceStable(remainders, func(i, j int) bool {
+			return remainders[i].fraction > remainders[j].fraction
+		})
+		for k := 0; k < remaining-assigned && k < len(remainders); k++ {
+			targets[remainders[k].index]++
+		}
+		return targets
+	}
+}
@@ -2,11 +2,20 @@ package autoscaler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/dxas90/scalebee/pkg/backpressure"
 	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/events"
+	"github.com/dxas90/scalebee/pkg/notify"
 	"github.com/dxas90/scalebee/pkg/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -18,22 +27,255 @@ const (
 	MemoryUpperLimit = 80.0
 	// MemoryLowerLimit is the memory percentage threshold for scaling down
 	MemoryLowerLimit = 20.0
+	// CPUCriticalLimit is the CPU percentage that allows scaling past a soft maximum
+	CPUCriticalLimit = 95.0
+	// MemoryCriticalLimit is the memory percentage that allows scaling past a soft maximum
+	MemoryCriticalLimit = 95.0
+	// BackpressureRelease is the default time a service's load must stay
+	// below the scale-up thresholds before its backpressure is released
+	BackpressureRelease = 5 * time.Minute
+
+	// ApprovalTTL is the default time a proposal can be approved
+	ApprovalTTL = 15 * time.Minute
+
+	// ScaleDownWindow is the default window for the scale-down rate limit
+	ScaleDownWindow = 5 * time.Minute
 )
 
 // Config holds the autoscaler configuration
 type Config struct {
-	PrometheusURL    string
+	PrometheusURL string
+	// PrometheusEndpoints are additional named Prometheus servers,
+	// PrometheusStackRoutes maps stack namespaces and
+	// PrometheusServiceRoutes individual services to those names
+	PrometheusEndpoints     map[string]string
+	PrometheusStackRoutes   map[string]string
+	PrometheusServiceRoutes map[string]string
+	// PrometheusMatchers are label matchers added to every query, e.g.
+	// cluster="prod"
+	PrometheusMatchers string
+	// PrometheusHTTP holds the authentication and TLS settings used for all
+	// Prometheus endpoints
+	PrometheusHTTP prometheus.HTTPConfig
+	// PrometheusCacheTTL caches query results for this long (0 disables it)
+	PrometheusCacheTTL time.Duration
+	// PrometheusBreakerFailures consecutive failed queries pause querying an
+	// endpoint for PrometheusBreakerCooldown (0 disables the breaker)
+	PrometheusBreakerFailures int
+	PrometheusBreakerCooldown time.Duration
+
 	CPUUpperLimit    float64
 	CPULowerLimit    float64
 	MemoryUpperLimit float64
 	MemoryLowerLimit float64
+
+	// Critical limits allow scaling beyond swarm.autoscaler.maximum.soft
+	CPUCriticalLimit    float64
+	MemoryCriticalLimit float64
+
+	// Docker selects the Docker endpoint of the cluster, by default the one
+	// of DOCKER_HOST
+	Docker docker.Connection
+
+	// Stacks restricts autoscaling to the services of these stack
+	// namespaces (all stacks when empty)
+	Stacks []string
+	// IncludeServices and ExcludeServices restrict autoscaling by service
+	// name; excluded services are never touched
+	IncludeServices []docker.NamePattern
+	ExcludeServices []docker.NamePattern
+
+	// ScaleMetadataLabels writes the time and reason of every scale action
+	// to the service labels
+	ScaleMetadataLabels bool
+
+	// ContainerLabelFallback reads autoscaler labels from container labels
+	// when they are not set on the service itself
+	ContainerLabelFallback bool
+	// ServiceConfigCacheTTL caches service configurations between Docker
+	// API calls (0 disables the cache)
+	ServiceConfigCacheTTL time.Duration
+
+	// ClusterCapacityCheck caps scale-ups of services with reservations to
+	// the resources left on the nodes
+	ClusterCapacityCheck bool
+
+	// RescheduleWindow blocks scale-downs of services this long after their
+	// tasks were moved off a drained or down node
+	RescheduleWindow time.Duration
+
+	// ConvergenceTimeout, when set, waits up to this long after a scale
+	// action for the new replica count to run before the service is
+	// scaled again
+	ConvergenceTimeout time.Duration
+
+	// ScaleDownMaxPercent caps the percentage of replicas that can be removed
+	// from a service within ScaleDownWindow (0 disables the limit)
+	ScaleDownMaxPercent float64
+	ScaleDownWindow     time.Duration
+
+	// TolerancePercent is a deadband around the thresholds: values must exceed
+	// a limit by more than this percentage of the limit to trigger scaling
+	TolerancePercent float64
+
+	// NewServiceGracePeriod skips metric-driven scaling for services created
+	// less than this long ago, since warm-up metrics are not representative
+	NewServiceGracePeriod time.Duration
+
+	// ContainerWarmup excludes containers younger than this from the
+	// service averages
+	ContainerWarmup time.Duration
+	// MinTaskAge also excludes younger tasks from the service averages; the
+	// exporter leaves them out of its usage metrics as well
+	MinTaskAge time.Duration
+
+	// CrashLoopFailures suspends metric-driven scaling of a service with at
+	// least this many failed tasks within CrashLoopWindow (0 disables it)
+	CrashLoopFailures int
+	CrashLoopWindow   time.Duration
+
+	// ExporterVersionCheck compares the image versions of exporter tasks
+	// every cycle; ExporterAutoUpdate updates services on older images
+	ExporterVersionCheck bool
+	ExporterAutoUpdate   bool
+
+	// MetricJumpFactor discards a service's metrics for one cycle when they
+	// grow by more than this factor since the last cycle (0 disables it)
+	MetricJumpFactor float64
+
+	// Backpressure is signalled for services saturated at their maximum
+	// replicas, and released once their load stayed below the scale-up
+	// thresholds for BackpressureRelease
+	Backpressure        backpressure.Gateway
+	BackpressureRelease time.Duration
+
+	// ApprovalAboveReplicas requires manual approval to scale a service
+	// beyond this many replicas (0 disables it)
+	ApprovalAboveReplicas int
+	// ApprovalScaleDownLabels requires manual approval to scale down
+	// services that have all of these labels
+	ApprovalScaleDownLabels map[string]string
+	// ApprovalTTL is how long a proposal can be approved
+	ApprovalTTL time.Duration
+
+	// DisasterMinimumFactor multiplies the minimum replicas of every service
+	// while disaster mode is active; DisasterScaleDown still allows
+	// scale-downs during it
+	DisasterMinimumFactor float64
+	DisasterScaleDown     bool
+
+	// MemoryIncludeCache scales on raw memory usage including page cache
+	// instead of the working set
+	MemoryIncludeCache bool
+
+	// ScaleDownStabilization forbids scaling down this long after a scale-up,
+	// ScaleUpStabilization forbids scaling up this long after a scale-down
+	ScaleDownStabilization time.Duration
+	ScaleUpStabilization   time.Duration
+
+	// VerticalStepPercent is how much resource limits change per vertical
+	// scale action
+	VerticalStepPercent float64
+
+	// GlobalPolicy is how to handle services in global mode: skip, or
+	// placement to scale them through a node label
+	GlobalPolicy string
+
+	// OOMReaction is how to react to OOM-killed tasks: none, notify, scale, or both
+	OOMReaction string
+
+	// ClusterName identifies this cluster in notifications
+	ClusterName string
+
+	// Notifier receives scaling actions, proposals and notices (optional)
+	Notifier notify.Notifier
+
+	// EventHistorySize is the number of events kept for the API
+	EventHistorySize int
+
+	// RunTimeout bounds every run, so a hung Docker or Prometheus call
+	// can't block the loop (0 disables the deadline)
+	RunTimeout time.Duration
+
+	// StaleAfter is how long the autoscaler may go without a successful
+	// run before it reports itself as stale (0 disables the check)
+	StaleAfter time.Duration
+
+	// Logger receives the log records (default: slog.Default())
+	Logger *slog.Logger
 }
 
 // Autoscaler manages the autoscaling logic
 type Autoscaler struct {
 	config         *Config
 	promClient     *prometheus.Client
+	promRouter     *prometheus.Router
 	serviceManager *docker.ServiceManager
+	// log adds the cluster name to every record when one is set, so the
+	// logs of several clusters autoscaled by one instance can be told apart
+	log *slog.Logger
+
+	mu       sync.Mutex
+	events   map[string]scalingEvent
+	states   map[string]*serviceState
+	headroom map[string]headroom
+	degraded bool
+	// openCircuits are the endpoints whose circuit breaker was open at the
+	// end of the last cycle
+	openCircuits map[string]bool
+	// disaster is the state of the alternative policy for major incidents
+	disaster DisasterStatus
+	// snapshot holds the declared replicas of each service when first seen
+	snapshot map[string]uint64
+	// serviceIDs maps service names to the ID they currently refer to.
+	// Per-service state is keyed by ID.
+	serviceIDs map[string]string
+	hooks      hooks
+	// bus carries every decision as an event, history keeps the latest
+	bus     *events.Bus
+	history *events.History
+	// self counts the decisions, errors and runs of the autoscaler
+	self *selfMetrics
+	// firstRun is when the first run started; lastRun and lastSuccess are
+	// when the last run and the last successful run completed
+	firstRun    time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	// proposals are actions waiting for approval, by ID
+	proposals map[string]*Proposal
+	// exporterVersions and versionSkew are the result of the last version check
+	exporterVersions []exporterVersion
+	versionSkew      int
+	// clusterFull is set while scale-ups are blocked because the nodes have
+	// no resources left, clusterFullTotal counts the blocked scale-ups.
+	// cycleFull is the first service blocked in the current cycle, and
+	// cycleRoom is set when a check of the cycle found room.
+	clusterFull      bool
+	clusterFullTotal int
+	cycleFull        string
+	cycleRoom        bool
+	// capacity is the cluster capacity read once per cycle, with the
+	// replicas granted since; capacityMu guards it and serializes the
+	// capacity checks
+	capacityMu sync.Mutex
+	capacity   *docker.ClusterCapacity
+	// unavailableNodes and rescheduling are the result of the last node
+	// availability check; rescheduling counts moving tasks by service ID
+	unavailableNodes int
+	rescheduling     map[string]int
+	// globalServices is the number of autoscaled global services seen in
+	// the last cycle, services the number of all autoscaled services
+	globalServices int
+	services       int
+
+	// lifetime is cancelled by Close. Background work started by a run,
+	// e.g. waiting for Prometheus to recover, outlives the run on it.
+	lifetime context.Context
+	stop     context.CancelFunc
+
+	// skips of the last completed cycle and of the cycle in progress
+	skips      []Skip
+	cycleSkips []Skip
 }
 
 // NewAutoscaler creates a new autoscaler instance
@@ -50,41 +292,348 @@ func NewAutoscaler(config *Config) (*Autoscaler, error) {
 	if config.MemoryLowerLimit == 0 {
 		config.MemoryLowerLimit = MemoryLowerLimit
 	}
+	if config.CPUCriticalLimit == 0 {
+		config.CPUCriticalLimit = CPUCriticalLimit
+	}
+	if config.MemoryCriticalLimit == 0 {
+		config.MemoryCriticalLimit = MemoryCriticalLimit
+	}
+	if config.VerticalStepPercent == 0 {
+		config.VerticalStepPercent = VerticalStepPercent
+	}
+	if config.BackpressureRelease == 0 {
+		config.BackpressureRelease = BackpressureRelease
+	}
+	if config.ApprovalTTL == 0 {
+		config.ApprovalTTL = ApprovalTTL
+	}
+	if config.DisasterMinimumFactor == 0 {
+		config.DisasterMinimumFactor = DisasterMinimumFactor
+	}
+	if config.RescheduleWindow == 0 {
+		config.RescheduleWindow = RescheduleWindow
+	}
+	if config.ScaleDownWindow == 0 {
+		config.ScaleDownWindow = ScaleDownWindow
+	}
+	if config.PrometheusBreakerCooldown == 0 {
+		config.PrometheusBreakerCooldown = PrometheusBreakerCooldown
+	}
 
-	promClient := prometheus.NewClient(config.PrometheusURL)
+	memoryMetric := prometheus.MemoryWorkingSet
+	if config.MemoryIncludeCache {
+		memoryMetric = prometheus.MemoryUsage
+	}
 
-	serviceManager, err := docker.NewServiceManager()
+	// Both exclude young tasks with the same clause, the longer one wins
+	warmup := max(config.ContainerWarmup, config.MinTaskAge)
+
+	newClient := func(url string) (*prometheus.Client, error) {
+		client := prometheus.NewClient(url)
+		client.SetWarmup(warmup)
+		client.SetMemoryMetric(memoryMetric)
+		client.SetCacheTTL(config.PrometheusCacheTTL)
+		client.SetCircuitBreaker(config.PrometheusBreakerFailures, config.PrometheusBreakerCooldown)
+		if err := client.SetMatchers(config.PrometheusMatchers); err != nil {
+			return nil, fmt.Errorf("invalid Prometheus client configuration: %w", err)
+		}
+		if err := client.SetHTTPConfig(config.PrometheusHTTP); err != nil {
+			return nil, fmt.Errorf("invalid Prometheus client configuration: %w", err)
+		}
+		return client, nil
+	}
+
+	promClient, err := newClient(config.PrometheusURL)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]*prometheus.Client, len(config.PrometheusEndpoints))
+	for name, url := range config.PrometheusEndpoints {
+		if endpoints[name], err = newClient(url); err != nil {
+			return nil, err
+		}
+	}
+	promRouter, err := prometheus.NewRouter(promClient, endpoints, config.PrometheusStackRoutes, config.PrometheusServiceRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus endpoint configuration: %w", err)
+	}
+
+	serviceManager, err := docker.NewServiceManager(docker.Options{
+		ContainerLabelFallback: config.ContainerLabelFallback,
+		ConfigCacheTTL:         config.ServiceConfigCacheTTL,
+		Connection:             config.Docker,
+		Stacks:                 config.Stacks,
+		IncludeServices:        config.IncludeServices,
+		ExcludeServices:        config.ExcludeServices,
+		ScaleMetadataLabels:    config.ScaleMetadataLabels,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create service manager: %w", err)
 	}
 
-	return &Autoscaler{
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = slog.New(runHandler{logger.Handler()})
+	if config.ClusterName != "" {
+		logger = logger.With("cluster", config.ClusterName)
+	}
+
+	a := &Autoscaler{
 		config:         config,
+		log:            logger,
 		promClient:     promClient,
+		promRouter:     promRouter,
 		serviceManager: serviceManager,
-	}, nil
+		events:         make(map[string]scalingEvent),
+		states:         make(map[string]*serviceState),
+		headroom:       make(map[string]headroom),
+		snapshot:       make(map[string]uint64),
+		serviceIDs:     make(map[string]string),
+		proposals:      make(map[string]*Proposal),
+		hooks:          hooks{metrics: promRouter.GetServiceMetrics},
+		bus:            events.NewBus(),
+		history:        events.NewHistory(config.EventHistorySize),
+		self:           newSelfMetrics(),
+	}
+	a.lifetime, a.stop = context.WithCancel(context.Background())
+	a.bus.Subscribe(a.self.count, events.TypeScaled, events.TypeSkipped, events.TypeError)
+	a.bus.Subscribe(a.history.Record, events.TypeScaled, events.TypeProposed, events.TypeNotice, events.TypeError)
+	if config.Notifier != nil {
+		a.bus.Subscribe(a.deliver, events.TypeScaled, events.TypeProposed, events.TypeNotice)
+	}
+	return a, nil
 }
 
 // Close releases resources used by the autoscaler
 func (a *Autoscaler) Close() error {
+	a.stop()
 	return a.serviceManager.Close()
 }
 
-// PrometheusClient returns the Prometheus client for direct access
+// LastRun returns when the last run completed, whether it succeeded or
+// not. It is zero before the first run.
+func (a *Autoscaler) LastRun() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastRun
+}
+
+// Services returns the number of autoscaled services the last run
+// evaluated
+func (a *Autoscaler) Services() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.services
+}
+
+// Stale reports whether no run succeeded for longer than StaleAfter, and
+// how long ago the last one did. Before the first run, e.g. while waiting
+// for Prometheus, the autoscaler is never stale.
+func (a *Autoscaler) Stale() (bool, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stale()
+}
+
+// stale implements Stale; a.mu must be held
+func (a *Autoscaler) stale() (bool, time.Duration) {
+	if a.config.StaleAfter <= 0 || a.firstRun.IsZero() {
+		return false, 0
+	}
+	since := a.firstRun
+	if a.lastSuccess.After(since) {
+		since = a.lastSuccess
+	}
+	age := time.Since(since)
+	return age > a.config.StaleAfter, age
+}
+
+// Ready checks that Docker and every Prometheus endpoint respond
+func (a *Autoscaler) Ready(ctx context.Context) error {
+	if err := a.serviceManager.Ping(ctx); err != nil {
+		return err
+	}
+	return a.promRouter.Ready(ctx)
+}
+
+// Logger returns the logger of the autoscaler, which names its cluster
+func (a *Autoscaler) Logger() *slog.Logger {
+	return a.log
+}
+
+// ContainerLabelFallback reports whether autoscaler labels are also read
+// from container labels
+func (a *Autoscaler) ContainerLabelFallback() bool {
+	return a.config.ContainerLabelFallback
+}
+
+// InScope reports whether a service of the given name and stack may be
+// autoscaled by this instance
+func (a *Autoscaler) InScope(name, stack string) bool {
+	return a.serviceManager.InScope(name, stack)
+}
+
+// Scoped reports whether autoscaling is restricted by stack or service name
+func (a *Autoscaler) Scoped() bool {
+	return len(a.config.Stacks) > 0 || len(a.config.IncludeServices) > 0 || len(a.config.ExcludeServices) > 0
+}
+
+// ApprovalAboveReplicas returns the replicas beyond which scale-ups need
+// approval, or 0
+func (a *Autoscaler) ApprovalAboveReplicas() int {
+	return a.config.ApprovalAboveReplicas
+}
+
+// PrometheusHealth returns the health of every configured Prometheus endpoint
+func (a *Autoscaler) PrometheusHealth() []prometheus.EndpointHealth {
+	return a.promRouter.Health()
+}
+
+// ServiceManager returns the Docker service manager for direct access
+func (a *Autoscaler) ServiceManager() *docker.ServiceManager {
+	return a.serviceManager
+}
+
+// PrometheusClient returns the default Prometheus client for direct access
 func (a *Autoscaler) PrometheusClient() *prometheus.Client {
 	return a.promClient
 }
 
+// routeServices routes services with a Prometheus label to that endpoint,
+// and the services of a stack by its stack label
+func (a *Autoscaler) routeServices(configs []*docker.ServiceConfig) {
+	if !a.promRouter.Routing() {
+		return
+	}
+
+	routes := make(map[string]string)
+	stacks := make(map[string]string)
+	for _, config := range configs {
+		if config.PrometheusEndpoint != "" {
+			routes[config.Name] = config.PrometheusEndpoint
+		}
+		if config.Stack != "" {
+			stacks[config.Name] = config.Stack
+		}
+	}
+	a.promRouter.SetLabelRoutes(routes)
+	a.promRouter.SetStacks(stacks)
+}
+
+// Evaluation selects which scaling directions a run considers. Bounds
+// enforcement always runs regardless of the selection.
+type Evaluation struct {
+	ScaleUp   bool
+	ScaleDown bool
+}
+
 // Run executes one iteration of the autoscaling loop
 func (a *Autoscaler) Run(ctx context.Context) error {
+	return a.Evaluate(ctx, Evaluation{ScaleUp: true, ScaleDown: true})
+}
+
+// Evaluate executes one iteration of the autoscaling loop for the selected
+// scaling directions
+func (a *Autoscaler) Evaluate(ctx context.Context, eval Evaluation) error {
+	if RunID(ctx) == "" {
+		ctx = WithRunID(ctx, newRunID())
+	}
+	start := time.Now()
+	a.log.DebugContext(ctx, "Run started", "scale_up", eval.ScaleUp, "scale_down", eval.ScaleDown)
+	a.mu.Lock()
+	if a.firstRun.IsZero() {
+		a.firstRun = start
+	}
+	a.mu.Unlock()
+
+	ctx, span := tracer.Start(ctx, "reconcile", trace.WithAttributes(
+		attribute.String("run_id", RunID(ctx)),
+		attribute.String("cluster", a.config.ClusterName),
+		attribute.Bool("scale_up", eval.ScaleUp),
+		attribute.Bool("scale_down", eval.ScaleDown),
+	))
+	defer span.End()
+
+	runCtx := ctx
+	if a.config.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, a.config.RunTimeout)
+		defer cancel()
+	}
+
+	err := a.evaluate(runCtx, eval)
+	// Parts of a run give up quietly on a cancelled context, so a timeout
+	// is reported here whatever evaluate returned
+	if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		a.log.WarnContext(ctx, "Run exceeded its deadline and was cancelled", "timeout", a.config.RunTimeout, "error", err)
+		a.self.runTimeouts.Inc()
+		err = fmt.Errorf("run exceeded its deadline of %v", a.config.RunTimeout)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	a.self.observeRun(start, err)
+	a.mu.Lock()
+	a.lastRun = time.Now()
+	if err == nil {
+		a.lastSuccess = a.lastRun
+	}
+	a.mu.Unlock()
+	a.log.DebugContext(ctx, "Run finished", "duration", time.Since(start))
+	return err
+}
+
+// evaluate executes one iteration of the autoscaling loop
+func (a *Autoscaler) evaluate(ctx context.Context, eval Evaluation) error {
+	a.beginCycle()
+	a.dropCapacity()
+	defer a.endCycle()
+	defer a.checkCircuits(ctx)
+	defer a.settleClusterFull(ctx)
+	defer a.dropCapacity()
+
+	if a.config.ExporterVersionCheck {
+		a.checkVersionSkew(ctx)
+	}
+
+	a.checkDisasterSignal(ctx)
+
+	if a.Degraded() {
+		return a.enforceBounds(ctx)
+	}
+
+	// Every labelled service is reconciled, whether or not it has metrics,
+	// so services without running tasks are still brought to their minimum
+	configs, err := a.autoscaledServices(ctx)
+	if err != nil {
+		a.log.ErrorContext(ctx, "Failed to list autoscaled services", "error", err)
+		a.fireError(ctx, "", err)
+		return err
+	}
+
+	a.routeServices(configs)
+	a.countGlobal(configs)
+	a.checkNodeAvailability(ctx)
+
 	// Get both CPU and memory metrics concurrently for faster response
-	cpuMetrics, memoryMetrics, err := a.promClient.GetServiceMetrics(ctx)
+	queryCtx, querySpan := tracer.Start(ctx, "query_metrics")
+	cpuMetrics, memoryMetrics, err := a.getServiceMetrics(queryCtx)
+	querySpan.End()
 	if err != nil {
-		log.Printf("Error: failed to get metrics: %v", err)
-		return nil
+		a.log.ErrorContext(ctx, "Failed to get metrics", "error", err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		a.fireError(ctx, "", err)
+		a.EnterDegraded(ctx, err)
+		return a.enforceBounds(ctx)
 	}
 
-	log.Printf("Retrieved %d service CPU metrics from Prometheus", len(cpuMetrics))
+	a.log.DebugContext(ctx, "Retrieved service CPU metrics from Prometheus", "metrics", len(cpuMetrics))
 
 	// Group CPU metrics by service name (aggregate multiple instances)
 	serviceCPUMetrics := make(map[string][]float64)
@@ -92,153 +641,487 @@ func (a *Autoscaler) Run(ctx context.Context) error {
 		serviceCPUMetrics[m.ServiceName] = append(serviceCPUMetrics[m.ServiceName], m.CPUPercent)
 	}
 
+	// Headroom is rebuilt every run so removed services stop being exported
+	newHeadroom := make(map[string]headroom)
+	defer func() {
+		a.mu.Lock()
+		a.headroom = newHeadroom
+		a.mu.Unlock()
+	}()
+
+	// Services of an application are collected and scaled together
+	apps := make(map[string][]*appMember)
+
 	// Process each service
-	for serviceName, cpuValues := range serviceCPUMetrics {
-		// Calculate average CPU
-		var totalCPU float64
-		for _, cpu := range cpuValues {
-			totalCPU += cpu
-		}
-		avgCPU := totalCPU / float64(len(cpuValues))
+	for _, config := range configs {
+		// Each service is evaluated in its own span
+		func() {
+			ctx, span := tracer.Start(ctx, "evaluate_service", trace.WithAttributes(attribute.String("service", config.Name)))
+			defer span.End()
 
-		// Get memory percentage for this service
-		avgMemory := memoryMetrics[serviceName]
+			serviceName := config.Name
 
-		log.Printf("Service: %s, Avg CPU: %.2f%%, Avg Memory: %.2f%%", serviceName, avgCPU, avgMemory)
+			if config.Global {
+				cpuValues, ok := serviceCPUMetrics[serviceName]
+				var avgCPU float64
+				for _, cpu := range cpuValues {
+					avgCPU += cpu / float64(len(cpuValues))
+				}
+				a.evaluateGlobal(ctx, eval, config, avgCPU, memoryMetrics[serviceName], ok)
+				return
+			}
 
-		// Get service configuration
-		config, err := a.serviceManager.GetServiceConfig(ctx, serviceName)
-		if err != nil {
-			log.Printf("Warning: failed to get config for service %s: %v", serviceName, err)
-			continue
-		}
+			if config.Job {
+				a.evaluateJob(ctx, eval, config)
+				return
+			}
 
-		if !config.AutoscaleEnabled {
-			log.Printf("Service %s does not have autoscale label", serviceName)
-			continue
-		}
+			if !config.Replicated {
+				a.log.DebugContext(ctx, "Service is not in replicated mode", "service", serviceName)
+				a.skip(ctx, serviceName, SkipNotReplicated, "only replicated services can be scaled")
+				return
+			}
 
-		log.Printf("Service %s has autoscale label", serviceName)
+			// Changing replicas mid-rollout interferes with Swarm's update
+			// orchestration, so not even the bounds are enforced
+			if config.Updating {
+				a.log.InfoContext(ctx, "Service has a rolling update in progress, deferring scaling", "service", serviceName)
+				a.skip(ctx, serviceName, SkipRollingUpdate, "update in progress")
+				return
+			}
 
-		// Apply default scaling (ensure within min/max bounds)
-		if err := a.defaultScale(ctx, config); err != nil {
-			log.Printf("Error during default scale for %s: %v", serviceName, err)
-		}
+			cpuValues, ok := serviceCPUMetrics[serviceName]
+			if !ok {
+				// Without metrics, e.g. when no task is running, only the
+				// bounds can be enforced
+				if err := a.defaultScale(ctx, config); err != nil {
+					a.log.ErrorContext(ctx, "Failed to enforce replica bounds", "service", serviceName, "error", err)
+				}
+				a.skip(ctx, serviceName, SkipNoMetrics, "no CPU metrics returned by Prometheus")
+				return
+			}
+
+			// Calculate average CPU
+			var totalCPU float64
+			for _, cpu := range cpuValues {
+				totalCPU += cpu
+			}
+			avgCPU := totalCPU / float64(len(cpuValues))
 
-		// Check if we need to scale based on CPU or Memory
-		// Scale up if EITHER CPU or Memory exceeds upper threshold
-		shouldScaleUp := false
-		scaleUpReason := ""
+			// Get memory percentage for this service
+			avgMemory := memoryMetrics[serviceName]
 
-		if avgCPU > a.config.CPUUpperLimit {
-			shouldScaleUp = true
-			scaleUpReason = fmt.Sprintf("CPU %.2f%% > %.0f%%", avgCPU, a.config.CPUUpperLimit)
-		}
+			a.log.DebugContext(ctx, "Service usage", "service", serviceName, "replicas", config.CurrentReplicas, "cpu_percent", avgCPU, "memory_percent", avgMemory)
+			newHeadroom[serviceName] = a.serviceHeadroom(config, avgCPU, avgMemory)
+			plausible, implausibleReason := a.checkPlausible(config, avgCPU, avgMemory)
+			if plausible {
+				a.recordUsage(config, avgCPU, avgMemory)
+			}
 
-		if avgMemory > a.config.MemoryUpperLimit {
-			shouldScaleUp = true
-			if scaleUpReason != "" {
-				scaleUpReason += fmt.Sprintf(" and Memory %.2f%% > %.0f%%", avgMemory, a.config.MemoryUpperLimit)
-			} else {
-				scaleUpReason = fmt.Sprintf("Memory %.2f%% > %.0f%%", avgMemory, a.config.MemoryUpperLimit)
+			// Apply default scaling (ensure within min/max bounds)
+			if err := a.defaultScale(ctx, config); err != nil {
+				a.log.ErrorContext(ctx, "Failed to enforce replica bounds", "service", serviceName, "error", err)
 			}
-		}
 
-		if shouldScaleUp {
-			log.Printf("Service %s is above threshold: %s", serviceName, scaleUpReason)
-			if err := a.scaleUp(ctx, serviceName); err != nil {
-				log.Printf("Error scaling up %s: %v", serviceName, err)
+			// Samples distorted by an exporter restart must not trigger scaling
+			if !plausible {
+				a.log.WarnContext(ctx, "Discarding implausible metrics for this cycle", "service", serviceName, "reason", implausibleReason)
+				a.skip(ctx, serviceName, SkipImplausible, "%s", implausibleReason)
+				a.notify(ctx, serviceName, false, "Discarded implausible metrics of service %s: %s", serviceName, implausibleReason)
+				return
 			}
-			continue // Don't check scale down if we're scaling up
-		}
 
-		// Scale down only if BOTH CPU and Memory are below lower threshold
-		if avgCPU < a.config.CPULowerLimit && avgMemory < a.config.MemoryLowerLimit {
-			log.Printf("Service %s is below threshold: CPU %.2f%% < %.0f%% and Memory %.2f%% < %.0f%%",
-				serviceName, avgCPU, a.config.CPULowerLimit, avgMemory, a.config.MemoryLowerLimit)
-			if err := a.scaleDown(ctx, serviceName); err != nil {
-				log.Printf("Error scaling down %s: %v", serviceName, err)
+			if age := time.Since(config.CreatedAt); a.config.NewServiceGracePeriod > 0 && age < a.config.NewServiceGracePeriod {
+				a.log.InfoContext(ctx, "Service is in its grace period, skipping scaling",
+					"service", serviceName, "age", age.Round(time.Second), "grace_period", a.config.NewServiceGracePeriod)
+				a.skip(ctx, serviceName, SkipGracePeriod, "created %v ago", age.Round(time.Second))
+				return
 			}
-		}
+
+			// Metrics of crash-looping tasks don't reflect the load
+			if a.config.CrashLoopFailures > 0 {
+				failures, err := a.serviceManager.RecentTaskFailures(ctx, config.ID, time.Now().Add(-a.config.CrashLoopWindow))
+				if err != nil {
+					a.log.WarnContext(ctx, "Failed to check for a crash loop", "service", serviceName, "error", err)
+				} else if failures >= a.config.CrashLoopFailures {
+					a.log.WarnContext(ctx, "Service is crash-looping, skipping scaling", "service", serviceName, "failed_tasks", failures, "window", a.config.CrashLoopWindow)
+					a.skip(ctx, serviceName, SkipCrashLoop, "%d failed tasks in the last %v", failures, a.config.CrashLoopWindow)
+					return
+				}
+			}
+
+			// Vertical scaling is per service, so only horizontal members are
+			// scaled as part of their application
+			if config.App != "" && config.Mode == docker.ModeHorizontal {
+				apps[config.App] = append(apps[config.App], &appMember{
+					config: config,
+					tasks:  len(cpuValues),
+					cpu:    avgCPU,
+					memory: avgMemory,
+				})
+				return
+			}
+
+			// Check if we need to scale based on CPU or Memory
+			// Scale up if EITHER CPU or Memory exceeds upper threshold
+			shouldScaleUp := false
+			scaleUpReason := ""
+			reasonCode := ""
+			cpuHigh := a.aboveUpper(avgCPU, a.config.CPUUpperLimit)
+			memoryHigh := a.aboveUpper(avgMemory, a.config.MemoryUpperLimit)
+
+			if cpuHigh {
+				shouldScaleUp = true
+				scaleUpReason = fmt.Sprintf("CPU %.2f%% > %.0f%%", avgCPU, a.config.CPUUpperLimit)
+				reasonCode = "cpu"
+			}
+
+			if memoryHigh {
+				shouldScaleUp = true
+				if scaleUpReason != "" {
+					scaleUpReason += fmt.Sprintf(" and Memory %.2f%% > %.0f%%", avgMemory, a.config.MemoryUpperLimit)
+					reasonCode = "cpu_and_memory"
+				} else {
+					scaleUpReason = fmt.Sprintf("Memory %.2f%% > %.0f%%", avgMemory, a.config.MemoryUpperLimit)
+					reasonCode = "memory"
+				}
+			}
+
+			if shouldScaleUp {
+				if !eval.ScaleUp {
+					return
+				}
+				a.log.InfoContext(ctx, "Service is above threshold", "service", serviceName, "replicas", config.CurrentReplicas, "reason", scaleUpReason)
+				if !a.allowDecision(ctx, Decision{
+					Service: serviceName, Direction: DirectionUp, Reason: reasonCode,
+					CPUPercent: avgCPU, MemoryPercent: avgMemory, Replicas: config.DesiredReplicas,
+				}) {
+					a.skip(ctx, serviceName, SkipVetoed, "scale-up vetoed by a decision hook")
+					return
+				}
+
+				// Vertical mode grows resources; "both" grows them only once the
+				// service is at its maximum replicas
+				atMax := config.MaxReplicas > 0 && int(config.CurrentReplicas) >= config.MaxReplicas
+				if config.Mode == docker.ModeVertical || (config.Mode == docker.ModeBoth && atMax) {
+					if _, err := a.scaleVertical(ctx, config, DirectionUp, reasonCode, cpuHigh, memoryHigh); err != nil {
+						a.log.ErrorContext(ctx, "Failed to scale service vertically", "service", serviceName, "error", err)
+						a.notify(ctx, serviceName, true, "Failed to scale up service %s vertically: %v", serviceName, err)
+						a.fireError(ctx, serviceName, err)
+					}
+					return
+				}
+
+				critical := avgCPU > a.config.CPUCriticalLimit || avgMemory > a.config.MemoryCriticalLimit
+				if err := a.scaleUp(ctx, config, reasonCode, critical); err != nil {
+					a.log.ErrorContext(ctx, "Failed to scale up service", "service", serviceName, "error", err)
+					a.notify(ctx, serviceName, true, "Failed to scale up service %s: %v", serviceName, err)
+					a.fireError(ctx, serviceName, err)
+				}
+				return // Don't check scale down if we're scaling up
+			}
+
+			a.relieveBackpressure(ctx, config)
+
+			if !eval.ScaleDown {
+				return
+			}
+
+			// Scale down only if BOTH CPU and Memory are below lower threshold
+			if a.belowLower(avgCPU, a.config.CPULowerLimit) && a.belowLower(avgMemory, a.config.MemoryLowerLimit) {
+				a.log.InfoContext(ctx, "Service is below threshold", "service", serviceName, "replicas", config.CurrentReplicas,
+					"cpu_percent", avgCPU, "cpu_limit", a.config.CPULowerLimit, "memory_percent", avgMemory, "memory_limit", a.config.MemoryLowerLimit)
+				if a.scaleDownBlocked() {
+					a.skip(ctx, serviceName, SkipDisaster, "scale-downs are disabled in disaster mode")
+					return
+				}
+				// Checked before the hooks, as it applies to vertical scaling too
+				if moving := a.reschedulingTasks(config.ID); moving > 0 {
+					a.log.InfoContext(ctx, "Service has tasks moving off unavailable nodes, not scaling down", "service", serviceName, "moving_tasks", moving)
+					a.skip(ctx, serviceName, SkipRescheduling, "%d tasks moving off unavailable nodes", moving)
+					return
+				}
+				if !a.allowDecision(ctx, Decision{
+					Service: serviceName, Direction: DirectionDown, Reason: "low_utilization",
+					CPUPercent: avgCPU, MemoryPercent: avgMemory, Replicas: config.DesiredReplicas,
+				}) {
+					a.skip(ctx, serviceName, SkipVetoed, "scale-down vetoed by a decision hook")
+					return
+				}
+
+				// Vertical mode shrinks resources; "both" shrinks them only once the
+				// service is down to its minimum replicas
+				atMin := int(config.CurrentReplicas) <= config.MinReplicas
+				if config.Mode == docker.ModeVertical || (config.Mode == docker.ModeBoth && atMin) {
+					if _, err := a.scaleVertical(ctx, config, DirectionDown, "low_utilization", true, true); err != nil {
+						a.log.ErrorContext(ctx, "Failed to scale service vertically", "service", serviceName, "error", err)
+						a.notify(ctx, serviceName, true, "Failed to scale down service %s vertically: %v", serviceName, err)
+						a.fireError(ctx, serviceName, err)
+					}
+					return
+				}
+
+				if err := a.scaleDown(ctx, config, "low_utilization"); err != nil {
+					a.log.ErrorContext(ctx, "Failed to scale down service", "service", serviceName, "error", err)
+					a.notify(ctx, serviceName, true, "Failed to scale down service %s: %v", serviceName, err)
+					a.fireError(ctx, serviceName, err)
+				}
+			}
+		}()
 	}
 
+	a.evaluateApps(ctx, eval, apps)
+
 	return nil
 }
 
-// defaultScale ensures a service is within its min/max replica bounds
+// aboveUpper reports whether a value exceeds an upper limit beyond the tolerance band
+func (a *Autoscaler) aboveUpper(value, limit float64) bool {
+	return value > limit*(1+a.config.TolerancePercent/100)
+}
+
+// belowLower reports whether a value is under a lower limit beyond the tolerance band
+func (a *Autoscaler) belowLower(value, limit float64) bool {
+	return value < limit*(1-a.config.TolerancePercent/100)
+}
+
+// defaultScale ensures a service is within its min/max replica bounds.
+// Bounds apply to the declared replicas, not to the tasks currently running.
+// The declared replicas of config are updated, so later decisions in the
+// same cycle see the new count.
 func (a *Autoscaler) defaultScale(ctx context.Context, config *docker.ServiceConfig) error {
-	currentReplicas := int(config.CurrentReplicas)
+	a.recordSnapshot(config)
+
+	currentReplicas := int(config.DesiredReplicas)
 
 	if config.MinReplicas > 0 && currentReplicas < config.MinReplicas {
-		log.Printf("Service %s is below the minimum. Scaling to the minimum of %d",
-			config.Name, config.MinReplicas)
-		return a.serviceManager.ScaleService(ctx, config.Name, uint64(config.MinReplicas))
+		a.log.InfoContext(ctx, "Service is below the minimum, scaling to the minimum",
+			"service", config.Name, "from", currentReplicas, "to", config.MinReplicas)
+		if err := a.serviceManager.ScaleService(ctx, config.ID, uint64(config.MinReplicas), "below_minimum"); err != nil {
+			return err
+		}
+		config.DesiredReplicas = uint64(config.MinReplicas)
+		a.recordEvent(config, DirectionUp, "below_minimum")
+		a.fireAction(ctx, Action{Service: config.Name, Direction: DirectionUp, Reason: "below_minimum",
+			FromReplicas: currentReplicas, ToReplicas: config.MinReplicas})
+		a.publish(ctx, events.Event{Type: events.TypeScaled, Service: config.Name,
+			Message:   fmt.Sprintf("Service %s scaled to its minimum of %d replicas", config.Name, config.MinReplicas),
+			Direction: DirectionUp, Reason: "below_minimum", FromReplicas: currentReplicas, ToReplicas: config.MinReplicas})
+		return nil
 	}
 
 	if config.MaxReplicas > 0 && currentReplicas > config.MaxReplicas {
-		log.Printf("Service %s is above the maximum. Scaling to the maximum of %d",
-			config.Name, config.MaxReplicas)
-		return a.serviceManager.ScaleService(ctx, config.Name, uint64(config.MaxReplicas))
+		a.log.InfoContext(ctx, "Service is above the maximum, scaling to the maximum",
+			"service", config.Name, "from", currentReplicas, "to", config.MaxReplicas)
+		if err := a.serviceManager.ScaleService(ctx, config.ID, uint64(config.MaxReplicas), "above_maximum"); err != nil {
+			return err
+		}
+		config.DesiredReplicas = uint64(config.MaxReplicas)
+		a.recordEvent(config, DirectionDown, "above_maximum")
+		a.fireAction(ctx, Action{Service: config.Name, Direction: DirectionDown, Reason: "above_maximum",
+			FromReplicas: currentReplicas, ToReplicas: config.MaxReplicas})
+		a.publish(ctx, events.Event{Type: events.TypeScaled, Service: config.Name,
+			Message:   fmt.Sprintf("Service %s scaled to its maximum of %d replicas", config.Name, config.MaxReplicas),
+			Direction: DirectionDown, Reason: "above_maximum", FromReplicas: currentReplicas, ToReplicas: config.MaxReplicas})
+		return nil
 	}
 
 	return nil
 }
 
-// scaleUp increases the replica count by 1 if within limits
-func (a *Autoscaler) scaleUp(ctx context.Context, serviceName string) error {
-	config, err := a.serviceManager.GetServiceConfig(ctx, serviceName)
-	if err != nil {
-		return err
-	}
-
-	if !config.AutoscaleEnabled {
-		return nil
-	}
-
+// scaleUp increases the replica count by the service step if within limits.
+// The soft maximum can only be exceeded when the load is critical.
+func (a *Autoscaler) scaleUp(ctx context.Context, config *docker.ServiceConfig, reason string, critical bool) error {
+	serviceName := config.Name
 	currentReplicas := int(config.CurrentReplicas)
-	newReplicas := currentReplicas + 1
+	newReplicas := currentReplicas + config.StepSize()
 
 	if config.MaxReplicas > 0 && currentReplicas >= config.MaxReplicas {
-		log.Printf("Service %s already has the maximum of %d replicas",
-			serviceName, config.MaxReplicas)
+		a.log.InfoContext(ctx, "Service already has the maximum replicas", "service", serviceName, "replicas", config.MaxReplicas)
+		a.skip(ctx, serviceName, SkipAtMaximum, "%d replicas", config.MaxReplicas)
+		if a.saturate(config.ID) {
+			a.notify(ctx, serviceName, false, "Service %s is saturated at its maximum of %d replicas", serviceName, config.MaxReplicas)
+		}
+		a.engageBackpressure(ctx, config, reason)
 		return nil
 	}
 
+	if config.SoftMaxReplicas > 0 && newReplicas > config.SoftMaxReplicas && !critical {
+		if currentReplicas >= config.SoftMaxReplicas {
+			a.log.InfoContext(ctx, "Service is at its soft maximum and load is not critical",
+				"service", serviceName, "replicas", config.SoftMaxReplicas)
+			a.skip(ctx, serviceName, SkipAtSoftMaximum, "%d replicas, load is not critical", config.SoftMaxReplicas)
+			return nil
+		}
+		a.log.InfoContext(ctx, "Service would exceed its soft maximum, capping",
+			"service", serviceName, "replicas", config.SoftMaxReplicas)
+		newReplicas = config.SoftMaxReplicas
+	}
+
 	if config.MaxReplicas > 0 && newReplicas > config.MaxReplicas {
-		log.Printf("Service %s would exceed maximum. Capping at %d replicas",
-			serviceName, config.MaxReplicas)
+		a.log.InfoContext(ctx, "Service would exceed its maximum, capping",
+			"service", serviceName, "replicas", config.MaxReplicas)
 		newReplicas = config.MaxReplicas
 	}
 
-	log.Printf("Scaling up service %s to %d", serviceName, newReplicas)
-	return a.serviceManager.ScaleService(ctx, serviceName, uint64(newReplicas))
-}
+	newReplicas, ok := a.guardScale(ctx, config, DirectionUp, currentReplicas, newReplicas)
+	if !ok {
+		return nil
+	}
 
-// scaleDown decreases the replica count by 1 if within limits
-func (a *Autoscaler) scaleDown(ctx context.Context, serviceName string) error {
-	config, err := a.serviceManager.GetServiceConfig(ctx, serviceName)
-	if err != nil {
+	if a.needsApproval(config, DirectionUp, newReplicas) {
+		a.propose(ctx, config, DirectionUp, reason, currentReplicas, newReplicas)
+		return nil
+	}
+
+	a.log.InfoContext(ctx, "Scaling up service", "service", serviceName, "from", currentReplicas, "to", newReplicas)
+	if err := a.applyScale(ctx, config, DirectionUp, reason, currentReplicas, newReplicas); err != nil {
 		return err
 	}
+	if config.SoftMaxReplicas > 0 && newReplicas > config.SoftMaxReplicas {
+		a.notify(ctx, serviceName, true, "Service %s exceeded its soft maximum of %d replicas under critical load (now %d)",
+			serviceName, config.SoftMaxReplicas, newReplicas)
+	}
+	return nil
+}
 
-	if !config.AutoscaleEnabled {
+// scaleDown decreases the replica count by the service step if within limits
+func (a *Autoscaler) scaleDown(ctx context.Context, config *docker.ServiceConfig, reason string) error {
+	serviceName := config.Name
+	currentReplicas := int(config.CurrentReplicas)
+	newReplicas := currentReplicas - config.StepSize()
+
+	if currentReplicas <= config.MinReplicas || currentReplicas == 0 {
+		a.log.InfoContext(ctx, "Service has the minimum replicas", "service", serviceName, "replicas", config.MinReplicas)
+		a.skip(ctx, serviceName, SkipAtMinimum, "%d replicas", config.MinReplicas)
 		return nil
 	}
 
-	currentReplicas := int(config.CurrentReplicas)
-	newReplicas := currentReplicas - 1
+	if newReplicas < config.MinReplicas {
+		a.log.InfoContext(ctx, "Service would drop below its minimum, capping",
+			"service", serviceName, "replicas", config.MinReplicas)
+		newReplicas = config.MinReplicas
+	}
 
-	if config.MinReplicas > 0 && newReplicas < config.MinReplicas {
-		log.Printf("Service %s has the minimum number of replicas (%d)",
-			serviceName, config.MinReplicas)
+	if newReplicas < 0 {
+		newReplicas = 0
+	}
+
+	newReplicas, ok := a.guardScale(ctx, config, DirectionDown, currentReplicas, newReplicas)
+	if !ok {
 		return nil
 	}
 
-	if currentReplicas == config.MinReplicas {
-		log.Printf("Service %s has the minimum number of replicas", serviceName)
+	if a.needsApproval(config, DirectionDown, newReplicas) {
+		a.propose(ctx, config, DirectionDown, reason, currentReplicas, newReplicas)
 		return nil
 	}
 
-	log.Printf("Scaling down service %s to %d", serviceName, newReplicas)
-	return a.serviceManager.ScaleService(ctx, serviceName, uint64(newReplicas))
+	a.log.InfoContext(ctx, "Scaling down service", "service", serviceName, "from", currentReplicas, "to", newReplicas)
+	return a.applyScale(ctx, config, DirectionDown, reason, currentReplicas, newReplicas)
+}
+
+// guardScale applies the checks every scale action of a service passes,
+// whether the service is scaled on its own or as part of an application:
+// pending tasks, convergence, cooldown and stabilization, then the placement
+// limit and cluster capacity for scale-ups, or rescheduling tasks and the
+// scale-down limit for scale-downs. It returns the replicas the action may
+// scale to, and false when the service is not to be scaled this cycle.
+func (a *Autoscaler) guardScale(ctx context.Context, config *docker.ServiceConfig, direction string, from, to int) (int, bool) {
+	serviceName := config.Name
+
+	// Scale-ups wait while the declared replicas already cover the step.
+	// Scale-downs wait for any pending tasks, e.g. during an image pull: the
+	// step is taken from the running tasks, so it would remove the pending
+	// ones from the declared replicas as well.
+	if pending := config.CurrentReplicas < config.DesiredReplicas; (direction == DirectionUp && to <= int(config.DesiredReplicas)) ||
+		(direction == DirectionDown && pending) {
+		a.log.InfoContext(ctx, "Service has pending tasks, waiting", "service", serviceName, "direction", direction,
+			"replicas", config.CurrentReplicas, "desired", config.DesiredReplicas)
+		a.skip(ctx, serviceName, SkipPendingTasks, "%d of %d replicas running", config.CurrentReplicas, config.DesiredReplicas)
+		return 0, false
+	}
+
+	if converging, target := a.converging(config.ID); converging {
+		a.log.InfoContext(ctx, "Service is still converging, not scaling", "service", serviceName, "direction", direction, "target", target)
+		a.skip(ctx, serviceName, SkipConverging, "waiting for %d replicas to run", target)
+		return 0, false
+	}
+
+	cooldown := config.CooldownUp
+	if direction == DirectionDown {
+		cooldown = config.CooldownDown
+	}
+	if cooling, remaining := a.inCooldown(config.ID, cooldown); cooling {
+		a.log.InfoContext(ctx, "Service is in cooldown", "service", serviceName, "direction", direction, "remaining", remaining.Round(time.Second))
+		a.skip(ctx, serviceName, SkipCooldown, "scale-%s cooldown, %v remaining", direction, remaining.Round(time.Second))
+		return 0, false
+	}
+
+	if blocked, phase := a.dampened(config.ID, direction); blocked {
+		a.log.InfoContext(ctx, "Service is in the stabilization window, not scaling", "service", serviceName, "direction", direction, "phase", phase)
+		a.skip(ctx, serviceName, SkipStabilization, "scale-%s blocked, service was %s recently", direction, phase)
+		return 0, false
+	}
+
+	if direction == DirectionUp {
+		// Replicas beyond what the nodes can take would stay pending forever
+		if capacity, limited := a.placementCapacity(ctx, config); limited && to > capacity {
+			if int(config.DesiredReplicas) >= capacity {
+				a.log.InfoContext(ctx, "Service already has the replicas its eligible nodes can place", "service", serviceName, "replicas", capacity)
+				a.skip(ctx, serviceName, SkipPlacementLimit, "%d replicas fit on the eligible nodes", capacity)
+				return 0, false
+			}
+			a.log.InfoContext(ctx, "Service would exceed its placement limit, capping", "service", serviceName, "replicas", capacity)
+			to = capacity
+		}
+		return a.fitCluster(ctx, config, int(config.DesiredReplicas), to)
+	}
+
+	if moving := a.reschedulingTasks(config.ID); moving > 0 {
+		a.log.InfoContext(ctx, "Service has tasks moving off unavailable nodes, not scaling down", "service", serviceName, "moving_tasks", moving)
+		a.skip(ctx, serviceName, SkipRescheduling, "%d tasks moving off unavailable nodes", moving)
+		return 0, false
+	}
+	if budget, limited := a.scaleDownBudget(config.ID, from); limited {
+		if budget == 0 {
+			a.log.InfoContext(ctx, "Service reached its scale-down limit, skipping",
+				"service", serviceName, "max_percent", a.config.ScaleDownMaxPercent, "window", a.config.ScaleDownWindow)
+			a.skip(ctx, serviceName, SkipScaleDownLimit, "%.0f%% per %v", a.config.ScaleDownMaxPercent, a.config.ScaleDownWindow)
+			return 0, false
+		}
+		if from-to > budget {
+			a.log.InfoContext(ctx, "Service scale-down limited this window", "service", serviceName, "replicas", budget)
+			to = from - budget
+		}
+	}
+	return to, true
+}
+
+// applyScale sets the replicas of a service and records the action
+func (a *Autoscaler) applyScale(ctx context.Context, config *docker.ServiceConfig, direction, reason string, from, to int) error {
+	if err := a.serviceManager.ScaleService(ctx, config.ID, uint64(to), reason); err != nil {
+		return err
+	}
+	a.recordScaled(config.ID, direction)
+	if direction == DirectionDown {
+		a.recordScaleDown(config.ID, from-to)
+	}
+	a.recordEvent(config, direction, reason)
+	a.fireAction(ctx, Action{Service: config.Name, Direction: direction, Reason: reason,
+		FromReplicas: from, ToReplicas: to})
+	a.notifyScaled(ctx, config.Name, direction, reason, from, to)
+	a.awaitConvergence(ctx, config, to)
+	return nil
+}
+
+// placementCapacity returns how many replicas of a service its eligible
+// nodes can place. limited is false when that is unlimited or unknown.
+func (a *Autoscaler) placementCapacity(ctx context.Context, config *docker.ServiceConfig) (capacity int, limited bool) {
+	capacity, limited, err := a.serviceManager.PlacementCapacity(ctx, config)
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to check the placement limit", "service", config.Name, "error", err)
+		return 0, false
+	}
+	return capacity, limited
 }
@@ -0,0 +1,34 @@
+package autoscaler
+
+import (
+	"context"
+	"time"
+)
+
+// RescheduleWindow is the default time after tasks were moved off a drained
+// or down node during which their service isn't scaled down
+const RescheduleWindow = 2 * time.Minute
+
+// checkNodeAvailability finds the services whose tasks are being moved off
+// drained or down nodes. Their averages drop while the moved tasks restart
+// elsewhere, which must not be mistaken for low load.
+func (a *Autoscaler) checkNodeAvailability(ctx context.Context) {
+	availability, err := a.serviceManager.NodeAvailability(ctx, time.Now().Add(-a.config.RescheduleWindow))
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to check node availability", "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.unavailableNodes = availability.Unavailable
+	a.rescheduling = availability.Rescheduling
+}
+
+// reschedulingTasks returns how many tasks of a service are being moved off
+// drained or down nodes
+func (a *Autoscaler) reschedulingTasks(serviceID string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rescheduling[serviceID]
+}
@@ -0,0 +1,131 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/backpressure"
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// engageBackpressure asks the gateway to shed load for a service that is
+// saturated at its maximum replicas. It is sent once until released.
+func (a *Autoscaler) engageBackpressure(ctx context.Context, config *docker.ServiceConfig, reason string) {
+	if a.config.Backpressure == nil {
+		return
+	}
+
+	a.mu.Lock()
+	st := a.state(config.ID)
+	st.calmSince = time.Time{}
+	engaged := st.backpressure
+	a.mu.Unlock()
+	if engaged {
+		return
+	}
+
+	if err := a.signalBackpressure(ctx, config.Name, backpressure.ActionEngage, reason, config.DesiredReplicas); err != nil {
+		a.log.ErrorContext(ctx, "Failed to engage backpressure", "service", config.Name, "error", err)
+		a.fireError(ctx, config.Name, err)
+		return
+	}
+
+	a.mu.Lock()
+	a.state(config.ID).backpressure = true
+	a.mu.Unlock()
+
+	a.log.InfoContext(ctx, "Engaged backpressure", "service", config.Name, "replicas", config.MaxReplicas)
+	a.notify(ctx, config.Name, true, "Engaged backpressure for service %s, saturated at its maximum of %d replicas",
+		config.Name, config.MaxReplicas)
+}
+
+// relieveBackpressure releases the backpressure of a service once its load
+// has stayed below the scale-up thresholds for BackpressureRelease
+func (a *Autoscaler) relieveBackpressure(ctx context.Context, config *docker.ServiceConfig) {
+	if a.config.Backpressure == nil {
+		return
+	}
+
+	a.mu.Lock()
+	st := a.state(config.ID)
+	if !st.backpressure {
+		a.mu.Unlock()
+		return
+	}
+	if st.calmSince.IsZero() {
+		st.calmSince = time.Now()
+	}
+	calm := time.Since(st.calmSince)
+	a.mu.Unlock()
+
+	if calm < a.config.BackpressureRelease {
+		return
+	}
+
+	if err := a.signalBackpressure(ctx, config.Name, backpressure.ActionRelease, "pressure_subsided", config.DesiredReplicas); err != nil {
+		a.log.ErrorContext(ctx, "Failed to release backpressure", "service", config.Name, "error", err)
+		a.fireError(ctx, config.Name, err)
+		return
+	}
+
+	a.mu.Lock()
+	st.backpressure = false
+	st.calmSince = time.Time{}
+	a.mu.Unlock()
+
+	a.log.InfoContext(ctx, "Released backpressure", "service", config.Name)
+	a.notify(ctx, config.Name, false, "Released backpressure for service %s", config.Name)
+}
+
+// ReleaseBackpressure releases the backpressure of every service, so load
+// isn't shed after ScaleBee stops
+func (a *Autoscaler) ReleaseBackpressure(ctx context.Context) {
+	if a.config.Backpressure == nil {
+		return
+	}
+
+	a.mu.Lock()
+	engaged := make(map[string]*serviceState)
+	for name, id := range a.serviceIDs {
+		if st, ok := a.states[id]; ok && st.backpressure {
+			engaged[name] = st
+		}
+	}
+	a.mu.Unlock()
+
+	for name, st := range engaged {
+		if err := a.signalBackpressure(ctx, name, backpressure.ActionRelease, "shutdown", 0); err != nil {
+			a.log.ErrorContext(ctx, "Failed to release backpressure", "service", name, "error", err)
+			continue
+		}
+		a.mu.Lock()
+		st.backpressure = false
+		a.mu.Unlock()
+		a.log.InfoContext(ctx, "Released backpressure", "service", name)
+	}
+}
+
+// signalBackpressure sends a signal with the latest metrics of the service
+func (a *Autoscaler) signalBackpressure(ctx context.Context, serviceName, action, reason string, replicas uint64) error {
+	signal := backpressure.Signal{
+		Service:  serviceName,
+		Action:   action,
+		Reason:   reason,
+		Replicas: replicas,
+		Cluster:  a.config.ClusterName,
+		Time:     time.Now(),
+	}
+
+	a.mu.Lock()
+	if st, ok := a.states[a.serviceIDs[serviceName]]; ok {
+		signal.CPUPercent = st.cpuPercent
+		signal.MemoryPercent = st.memoryPercent
+	}
+	a.mu.Unlock()
+
+	if err := a.config.Backpressure.Signal(ctx, signal); err != nil {
+		return fmt.Errorf("failed to %s backpressure: %w", action, err)
+	}
+	return nil
+}
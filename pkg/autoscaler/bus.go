@@ -0,0 +1,85 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dxas90/scalebee/pkg/events"
+	"github.com/dxas90/scalebee/pkg/notify"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Events returns the bus every scaling decision is published on, so
+// programs embedding the autoscaler can consume them
+func (a *Autoscaler) Events() *events.Bus {
+	return a.bus
+}
+
+// EventHistory returns the latest events matching the filter, newest
+// first. Skipped services aren't kept; Skips reports the last cycle's.
+func (a *Autoscaler) EventHistory(filter events.Filter) []events.Event {
+	return a.history.Events(filter)
+}
+
+// publish fills in the common event fields and publishes the event
+func (a *Autoscaler) publish(ctx context.Context, event events.Event) {
+	event.Cluster = a.config.ClusterName
+	event.RunID = RunID(ctx)
+	if event.Service != "" {
+		a.mu.Lock()
+		if st, ok := a.states[a.serviceIDs[event.Service]]; ok {
+			event.CPUPercent = st.cpuPercent
+			event.MemoryPercent = st.memoryPercent
+		}
+		a.mu.Unlock()
+	}
+	traceEvent(trace.SpanFromContext(ctx), event)
+	a.bus.Publish(ctx, event)
+}
+
+// notify publishes a notice about a service, or about ScaleBee itself when
+// serviceName is empty
+func (a *Autoscaler) notify(ctx context.Context, serviceName string, critical bool, format string, args ...interface{}) {
+	a.publish(ctx, events.Event{
+		Type:     events.TypeNotice,
+		Service:  serviceName,
+		Message:  fmt.Sprintf(format, args...),
+		Critical: critical,
+	})
+}
+
+// notifyScaled publishes a replica change with its details
+func (a *Autoscaler) notifyScaled(ctx context.Context, serviceName, direction, reason string, from, to int) {
+	a.publish(ctx, events.Event{
+		Type:         events.TypeScaled,
+		Service:      serviceName,
+		Message:      fmt.Sprintf("Scaled %s service %s from %d to %d replicas", direction, serviceName, from, to),
+		Direction:    direction,
+		Reason:       reason,
+		FromReplicas: from,
+		ToReplicas:   to,
+	})
+}
+
+// deliver hands an event to the configured notifier, whose channels queue
+// it, so the run doesn't wait for slow webhooks
+func (a *Autoscaler) deliver(ctx context.Context, event events.Event) {
+	err := a.config.Notifier.Notify(ctx, notify.Event{
+		Service:       event.Service,
+		Message:       event.Message,
+		Critical:      event.Critical,
+		Time:          event.Time,
+		Reason:        event.Reason,
+		Direction:     event.Direction,
+		FromReplicas:  uint64(event.FromReplicas),
+		ToReplicas:    uint64(event.ToReplicas),
+		CPUPercent:    event.CPUPercent,
+		MemoryPercent: event.MemoryPercent,
+		Cluster:       event.Cluster,
+		ProposalID:    event.ProposalID,
+		RunID:         event.RunID,
+	})
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to send notification", "service", event.Service, "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package autoscaler
+
+import (
+	"context"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// fitCluster caps a scale-up of a service to the replicas its reservations
+// leave room for in the cluster. The capacity is read once per cycle. It returns false when not even one more
+// replica fits; the cluster is then reported as full at the end of the
+// cycle, until a cycle finds room for every service again.
+func (a *Autoscaler) fitCluster(ctx context.Context, config *docker.ServiceConfig, from, to int) (int, bool) {
+	if !a.config.ClusterCapacityCheck {
+		return to, true
+	}
+	if config.Resources.CPUReservation <= 0 && config.Resources.MemoryReservation <= 0 {
+		// Without reservations the scheduler places tasks anywhere
+		return to, true
+	}
+
+	a.capacityMu.Lock()
+	defer a.capacityMu.Unlock()
+	if a.capacity == nil {
+		capacity, err := a.serviceManager.ClusterCapacity(ctx)
+		if err != nil {
+			a.log.WarnContext(ctx, "Failed to check the cluster capacity", "error", err)
+			return to, true
+		}
+		a.capacity = &capacity
+	}
+
+	free := a.capacity.FreeReplicas(config.Resources)
+	if free > 0 {
+		a.mu.Lock()
+		a.cycleRoom = true
+		a.mu.Unlock()
+		if to-from > free {
+			a.log.InfoContext(ctx, "Cluster has room for fewer replicas, capping",
+				"service", config.Name, "free", free, "replicas", from+free)
+			to = from + free
+		}
+		// Later checks of the cycle see the granted replicas as reserved
+		a.capacity.Reserve(config.Resources, to-from)
+		return to, true
+	}
+
+	a.log.WarnContext(ctx, "Cluster is full, service can't get more replicas", "service", config.Name)
+	a.skip(ctx, config.Name, SkipClusterFull, "no node resources left for the reservations of another replica")
+	a.mu.Lock()
+	a.clusterFullTotal++
+	if a.cycleFull == "" {
+		a.cycleFull = config.Name
+	}
+	a.mu.Unlock()
+	return from, false
+}
+
+// dropCapacity forgets the capacity read so far, so the next cycle reads
+// it again
+func (a *Autoscaler) dropCapacity() {
+	a.capacityMu.Lock()
+	defer a.capacityMu.Unlock()
+	a.capacity = nil
+}
+
+// settleClusterFull decides once per cycle whether the cluster is full, so
+// services with different reservations don't toggle it within a cycle.
+// It is full when a scale-up didn't fit, and has room again when every
+// check found room; without checks it stays as it is. Operators are
+// notified when that changes, so they add nodes before tasks pile up
+// pending.
+func (a *Autoscaler) settleClusterFull(ctx context.Context) {
+	a.mu.Lock()
+	serviceName, room := a.cycleFull, a.cycleRoom
+	a.cycleFull, a.cycleRoom = "", false
+	full := serviceName != ""
+	if !full && !room {
+		a.mu.Unlock()
+		return
+	}
+	changed := a.clusterFull != full
+	a.clusterFull = full
+	a.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if full {
+		a.notify(ctx, serviceName, true, "Cluster is full: service %s can't be scaled up, add nodes or free resources", serviceName)
+	} else {
+		a.notify(ctx, "", false, "Cluster has room for scale-ups again")
+	}
+}
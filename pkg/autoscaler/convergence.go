@@ -0,0 +1,104 @@
+package autoscaler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// Convergence outcomes
+const (
+	ConvergenceConverged = "converged"
+	ConvergenceTimeout   = "timeout"
+)
+
+// convergencePollInterval is how often the running tasks are checked while
+// waiting for convergence
+const convergencePollInterval = 2 * time.Second
+
+// convergence tracks whether a service runs the replicas it was scaled to
+type convergence struct {
+	active   bool
+	target   int
+	since    time.Time
+	outcomes map[string]int
+	// duration is how long the last completed wait took
+	duration time.Duration
+}
+
+// awaitConvergence waits in the background until a scaled service runs the
+// target number of tasks or ConvergenceTimeout passes. Further scale actions
+// for the service are skipped meanwhile.
+func (a *Autoscaler) awaitConvergence(ctx context.Context, config *docker.ServiceConfig, target int) {
+	if a.config.ConvergenceTimeout <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	c := &a.state(config.ID).convergence
+	c.active = true
+	c.target = target
+	c.since = time.Now()
+	a.mu.Unlock()
+
+	// The wait outlives API requests that approved the action
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.config.ConvergenceTimeout)
+	go func() {
+		defer cancel()
+
+		ticker := time.NewTicker(convergencePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				a.finishConvergence(ctx, config, target, ConvergenceTimeout)
+				return
+			case <-ticker.C:
+				running, err := a.serviceManager.RunningReplicas(ctx, config.ID)
+				if err != nil {
+					if ctx.Err() == nil {
+						a.log.WarnContext(ctx, "Failed to check convergence", "service", config.Name, "error", err)
+					}
+					continue
+				}
+				if int(running) == target {
+					a.finishConvergence(ctx, config, target, ConvergenceConverged)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// finishConvergence records the outcome of a wait for convergence
+func (a *Autoscaler) finishConvergence(ctx context.Context, config *docker.ServiceConfig, target int, outcome string) {
+	a.mu.Lock()
+	c := &a.state(config.ID).convergence
+	c.active = false
+	c.duration = time.Since(c.since)
+	if c.outcomes == nil {
+		c.outcomes = make(map[string]int)
+	}
+	c.outcomes[outcome]++
+	duration := c.duration.Round(time.Second)
+	a.mu.Unlock()
+
+	if outcome == ConvergenceConverged {
+		a.log.InfoContext(ctx, "Service converged", "service", config.Name, "replicas", target, "duration", duration)
+		return
+	}
+	a.log.WarnContext(ctx, "Service did not converge", "service", config.Name, "replicas", target, "duration", duration)
+	a.notify(context.WithoutCancel(ctx), config.Name, true, "Service %s did not reach %d running replicas within %v", config.Name, target, duration)
+}
+
+// converging reports whether a service is still converging and to which
+// replica count
+func (a *Autoscaler) converging(serviceID string) (bool, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c := a.state(serviceID).convergence
+	return c.active, c.target
+}
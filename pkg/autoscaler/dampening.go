@@ -0,0 +1,91 @@
+package autoscaler
+
+import "time"
+
+// dampeningPhase is the state of a service's replica change dampening
+type dampeningPhase int
+
+const (
+	// phaseStable allows scaling in both directions
+	phaseStable dampeningPhase = iota
+	// phaseScaledUp forbids scale-down until the scale-down window expires
+	phaseScaledUp
+	// phaseScaledDown forbids scale-up until the scale-up window expires
+	phaseScaledDown
+)
+
+// String returns the phase name used in logs
+func (p dampeningPhase) String() string {
+	switch p {
+	case phaseScaledUp:
+		return "scaled-up"
+	case phaseScaledDown:
+		return "scaled-down"
+	default:
+		return "stable"
+	}
+}
+
+// dampener is a per-service state machine that prevents a scale action from
+// being reversed shortly after it happened:
+//
+//	stable      --scale up-->   scaled-up   --downWindow elapsed--> stable
+//	stable      --scale down--> scaled-down --upWindow elapsed-->   stable
+//	scaled-up   --scale up-->   scaled-up   (window restarts)
+//	scaled-down --scale down--> scaled-down (window restarts)
+//
+// Reversals are rejected by allow, so there is no direct transition between
+// scaled-up and scaled-down.
+type dampener struct {
+	phase dampeningPhase
+	since time.Time
+}
+
+// settle moves the dampener back to stable once its window has elapsed
+func (d *dampener) settle(now time.Time, upWindow, downWindow time.Duration) {
+	switch d.phase {
+	case phaseScaledUp:
+		if now.Sub(d.since) >= downWindow {
+			d.phase = phaseStable
+		}
+	case phaseScaledDown:
+		if now.Sub(d.since) >= upWindow {
+			d.phase = phaseStable
+		}
+	}
+}
+
+// allow reports whether a scale action in the given direction may proceed
+func (d *dampener) allow(direction string, now time.Time, upWindow, downWindow time.Duration) bool {
+	d.settle(now, upWindow, downWindow)
+
+	switch d.phase {
+	case phaseScaledUp:
+		return direction != DirectionDown
+	case phaseScaledDown:
+		return direction != DirectionUp
+	default:
+		return true
+	}
+}
+
+// record transitions the dampener after a scale action
+func (d *dampener) record(direction string, now time.Time) {
+	if direction == DirectionUp {
+		d.phase = phaseScaledUp
+	} else {
+		d.phase = phaseScaledDown
+	}
+	d.since = now
+}
+
+// dampened reports whether a scale action is forbidden because it would
+// reverse a recent action, returning the phase that blocks it
+func (a *Autoscaler) dampened(serviceID, direction string) (bool, dampeningPhase) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	d := &a.state(serviceID).dampener
+	allowed := d.allow(direction, time.Now(), a.config.ScaleUpStabilization, a.config.ScaleDownStabilization)
+	return !allowed, d.phase
+}
@@ -0,0 +1,141 @@
+package autoscaler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDampener(t *testing.T) {
+	// step records a scale action at the offset, or checks whether one
+	// would be allowed and the phase afterwards
+	type step struct {
+		at        time.Duration
+		record    bool
+		direction string
+		allowed   bool
+		phase     dampeningPhase
+	}
+
+	tests := []struct {
+		name       string
+		upWindow   time.Duration
+		downWindow time.Duration
+		steps      []step
+	}{
+		{
+			name:       "stable allows both directions",
+			upWindow:   time.Minute,
+			downWindow: 5 * time.Minute,
+			steps: []step{
+				{at: 0, direction: DirectionUp, allowed: true, phase: phaseStable},
+				{at: 0, direction: DirectionDown, allowed: true, phase: phaseStable},
+			},
+		},
+		{
+			name:       "scaled up settles after the down window",
+			upWindow:   time.Minute,
+			downWindow: 5 * time.Minute,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: 4 * time.Minute, direction: DirectionDown, allowed: false, phase: phaseScaledUp},
+				{at: 5 * time.Minute, direction: DirectionDown, allowed: true, phase: phaseStable},
+			},
+		},
+		{
+			name:       "scaled down settles after the up window",
+			upWindow:   time.Minute,
+			downWindow: 5 * time.Minute,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionDown, phase: phaseScaledDown},
+				{at: 30 * time.Second, direction: DirectionUp, allowed: false, phase: phaseScaledDown},
+				{at: time.Minute, direction: DirectionUp, allowed: true, phase: phaseStable},
+			},
+		},
+		{
+			name:       "same direction is allowed inside the window",
+			upWindow:   time.Minute,
+			downWindow: 5 * time.Minute,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: time.Minute, direction: DirectionUp, allowed: true, phase: phaseScaledUp},
+			},
+		},
+		{
+			name:       "same direction action restarts the window",
+			upWindow:   time.Minute,
+			downWindow: 5 * time.Minute,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: 4 * time.Minute, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: 6 * time.Minute, direction: DirectionDown, allowed: false, phase: phaseScaledUp},
+				{at: 9 * time.Minute, direction: DirectionDown, allowed: true, phase: phaseStable},
+			},
+		},
+		{
+			name:       "zero windows never block",
+			upWindow:   0,
+			downWindow: 0,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: 0, direction: DirectionDown, allowed: true, phase: phaseStable},
+				{at: 0, record: true, direction: DirectionDown, phase: phaseScaledDown},
+				{at: 0, direction: DirectionUp, allowed: true, phase: phaseStable},
+			},
+		},
+		{
+			name:       "zero down window only releases scale-ups",
+			upWindow:   time.Minute,
+			downWindow: 0,
+			steps: []step{
+				{at: 0, record: true, direction: DirectionUp, phase: phaseScaledUp},
+				{at: 0, direction: DirectionDown, allowed: true, phase: phaseStable},
+				{at: 0, record: true, direction: DirectionDown, phase: phaseScaledDown},
+				{at: 0, direction: DirectionUp, allowed: false, phase: phaseScaledDown},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			var d dampener
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				if s.record {
+					d.record(s.direction, now)
+				} else if allowed := d.allow(s.direction, now, tt.upWindow, tt.downWindow); allowed != s.allowed {
+					t.Errorf("step %d: allow(%s) = %v, want %v", i, s.direction, allowed, s.allowed)
+				}
+				if d.phase != s.phase {
+					t.Errorf("step %d: phase = %v, want %v", i, d.phase, s.phase)
+				}
+			}
+		})
+	}
+}
+
+func TestDampenerSettle(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name  string
+		phase dampeningPhase
+		after time.Duration
+		want  dampeningPhase
+	}{
+		{name: "stable stays stable", phase: phaseStable, after: time.Hour, want: phaseStable},
+		{name: "scaled up inside the down window", phase: phaseScaledUp, after: time.Minute, want: phaseScaledUp},
+		{name: "scaled up at the end of the down window", phase: phaseScaledUp, after: 2 * time.Minute, want: phaseStable},
+		{name: "scaled down inside the up window", phase: phaseScaledDown, after: 30 * time.Second, want: phaseScaledDown},
+		{name: "scaled down after the up window", phase: phaseScaledDown, after: 2 * time.Minute, want: phaseStable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dampener{phase: tt.phase, since: start}
+			d.settle(start.Add(tt.after), time.Minute, 2*time.Minute)
+			if d.phase != tt.want {
+				t.Errorf("phase = %v, want %v", d.phase, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package autoscaler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/prometheus"
+)
+
+// PrometheusBreakerCooldown is the default time queries to a failing
+// Prometheus endpoint are paused
+const PrometheusBreakerCooldown = time.Minute
+
+// Degraded reports whether Prometheus is unavailable and metric-driven
+// scaling is suspended
+func (a *Autoscaler) Degraded() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.degraded
+}
+
+// EnterDegraded suspends metric-driven scaling and starts waiting for
+// Prometheus to recover in the background
+func (a *Autoscaler) EnterDegraded(ctx context.Context, cause error) {
+	a.mu.Lock()
+	if a.degraded {
+		a.mu.Unlock()
+		return
+	}
+	a.degraded = true
+	a.mu.Unlock()
+
+	a.log.WarnContext(ctx, "Prometheus unavailable, entering degraded mode: only min/max bounds are enforced", "error", cause)
+	a.notify(ctx, "", true, "ScaleBee lost Prometheus (%v), metric-driven scaling is suspended", cause)
+
+	// ctx may be a run's, which is cancelled as soon as the run returns
+	recoverCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(a.lifetime, cancel)
+	go func() {
+		defer stop()
+		defer cancel()
+		a.recoverPrometheus(recoverCtx)
+	}()
+}
+
+// recoverPrometheus waits for Prometheus to become ready again and clears
+// the degraded flag
+func (a *Autoscaler) recoverPrometheus(ctx context.Context) {
+	for {
+		err := a.promClient.WaitForPrometheus(ctx, 10)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		a.log.WarnContext(ctx, "Prometheus still unavailable", "error", err)
+	}
+
+	a.mu.Lock()
+	a.degraded = false
+	a.mu.Unlock()
+
+	a.log.InfoContext(ctx, "Prometheus recovered, leaving degraded mode")
+	a.notify(ctx, "", false, "ScaleBee reconnected to Prometheus, metric-driven scaling resumed")
+}
+
+// enforceBounds keeps every autoscaled service within its min/max replicas
+// without looking at metrics
+func (a *Autoscaler) enforceBounds(ctx context.Context) error {
+	configs, err := a.autoscaledServices(ctx)
+	if err != nil {
+		return err
+	}
+	a.countGlobal(configs)
+
+	for _, config := range configs {
+		if config.Global {
+			a.evaluateGlobal(ctx, Evaluation{}, config, 0, 0, false)
+			continue
+		}
+		if config.Updating {
+			a.skip(ctx, config.Name, SkipRollingUpdate, "update in progress")
+			continue
+		}
+		a.skip(ctx, config.Name, SkipDegraded, "Prometheus unavailable, only bounds are enforced")
+		if config.Job {
+			continue
+		}
+		if err := a.defaultScale(ctx, config); err != nil {
+			a.log.ErrorContext(ctx, "Failed to enforce replica bounds", "service", config.Name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// checkCircuits notifies when the circuit breaker of a Prometheus endpoint
+// opens or closes
+func (a *Autoscaler) checkCircuits(ctx context.Context) {
+	open := make(map[string]bool)
+	for _, h := range a.promRouter.Health() {
+		if h.Circuit.State == prometheus.CircuitOpen {
+			open[h.Name] = true
+		}
+	}
+
+	a.mu.Lock()
+	previous := a.openCircuits
+	a.openCircuits = open
+	a.mu.Unlock()
+
+	for name := range open {
+		if !previous[name] {
+			a.notify(ctx, "", true, "Prometheus endpoint %s keeps failing, queries are paused", name)
+		}
+	}
+	for name := range previous {
+		if !open[name] {
+			a.notify(ctx, "", false, "Prometheus endpoint %s answers again, queries resumed", name)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package autoscaler
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// DisasterMinimumFactor is the default factor applied to the minimum
+// replicas of every service in disaster mode
+const DisasterMinimumFactor = 2.0
+
+// Sources that can activate disaster mode
+const (
+	DisasterSourceAPI  = "api"
+	DisasterSourceNode = "node_label"
+)
+
+// DisasterStatus describes whether disaster mode is active and who
+// activated it: the source, and for the API the name of the token
+type DisasterStatus struct {
+	Active bool      `json:"active"`
+	Source string    `json:"source,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+
+	// Policy applied while active
+	MinimumFactor    float64 `json:"minimum_factor"`
+	ScaleDownAllowed bool    `json:"scale_down_allowed"`
+}
+
+// Disaster returns the current disaster mode status
+func (a *Autoscaler) Disaster() DisasterStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := a.disaster
+	status.MinimumFactor = a.config.DisasterMinimumFactor
+	status.ScaleDownAllowed = a.config.DisasterScaleDown
+	return status
+}
+
+// SetDisaster activates or clears disaster mode. While active, the minimum
+// replicas of every service are multiplied by DisasterMinimumFactor and
+// scale-downs are blocked unless DisasterScaleDown is set. Both transitions
+// are logged and sent as critical notifications, naming the source and, when
+// set, who requested the transition.
+func (a *Autoscaler) SetDisaster(ctx context.Context, active bool, source, by, reason string) DisasterStatus {
+	a.mu.Lock()
+	if a.disaster.Active == active {
+		a.mu.Unlock()
+		return a.Disaster()
+	}
+	previous := a.disaster
+	if active {
+		a.disaster = DisasterStatus{Active: true, Source: source, By: by, Reason: reason, Since: time.Now()}
+	} else {
+		a.disaster = DisasterStatus{}
+	}
+	a.mu.Unlock()
+
+	origin := source
+	if by != "" {
+		origin += " (" + by + ")"
+	}
+	if active {
+		a.log.WarnContext(ctx, "Disaster mode activated", "source", source, "by", by, "reason", reason,
+			"minimum_factor", a.config.DisasterMinimumFactor, "scale_down_allowed", a.config.DisasterScaleDown)
+		a.notify(ctx, "", true, "Disaster mode activated by %s: %s", origin, reason)
+	} else {
+		a.log.InfoContext(ctx, "Disaster mode cleared, normal policy restored", "source", source, "by", by, "reason", reason,
+			"duration", time.Since(previous.Since).Round(time.Second))
+		a.notify(ctx, "", true, "Disaster mode cleared by %s: %s", origin, reason)
+	}
+	return a.Disaster()
+}
+
+// checkDisasterSignal follows the disaster label on the swarm nodes. Mode
+// activated through the API is only cleared through the API.
+func (a *Autoscaler) checkDisasterSignal(ctx context.Context) {
+	node, signalled, err := a.serviceManager.DisasterSignal(ctx)
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to check the disaster signal", "error", err)
+		return
+	}
+
+	status := a.Disaster()
+	switch {
+	case signalled && !status.Active:
+		a.SetDisaster(ctx, true, DisasterSourceNode, node, "label "+docker.DisasterLabel+" on node "+node)
+	case !signalled && status.Active && status.Source == DisasterSourceNode:
+		a.SetDisaster(ctx, false, DisasterSourceNode, "", "label "+docker.DisasterLabel+" removed")
+	}
+}
+
+// serviceConfig fetches the configuration of a service with the active
+// policy applied
+func (a *Autoscaler) serviceConfig(ctx context.Context, serviceName string) (*docker.ServiceConfig, error) {
+	config, err := a.serviceManager.GetServiceConfig(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	a.applyPolicy(config)
+	return config, nil
+}
+
+// autoscaledServices lists the autoscaled services with the active policy
+// applied
+func (a *Autoscaler) autoscaledServices(ctx context.Context) ([]*docker.ServiceConfig, error) {
+	configs, err := a.serviceManager.ListAutoscaledServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		a.applyPolicy(config)
+	}
+
+	a.mu.Lock()
+	a.services = len(configs)
+	a.mu.Unlock()
+	return configs, nil
+}
+
+// applyPolicy raises the minimum replicas of a service in disaster mode,
+// never beyond its maximum
+func (a *Autoscaler) applyPolicy(config *docker.ServiceConfig) {
+	if !a.Disaster().Active || config.MinReplicas <= 0 {
+		return
+	}
+
+	min := int(math.Ceil(float64(config.MinReplicas) * a.config.DisasterMinimumFactor))
+	if config.MaxReplicas > 0 && min > config.MaxReplicas {
+		min = config.MaxReplicas
+	}
+	if min > config.MinReplicas {
+		config.MinReplicas = min
+	}
+}
+
+// scaleDownBlocked reports whether disaster mode forbids scaling down
+func (a *Autoscaler) scaleDownBlocked() bool {
+	return a.Disaster().Active && !a.config.DisasterScaleDown
+}
@@ -0,0 +1,54 @@
+package autoscaler
+
+import (
+	"context"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// WatchServices reacts to Docker service events until the context is
+// cancelled: created or relabelled services are brought within their bounds
+// right away instead of at the next interval, removed services are
+// forgotten, and cached configs and query results are dropped. Scaling
+// decisions still follow the intervals. Like WatchOOMKills, it stops on ctx
+// and acts on actionCtx.
+func (a *Autoscaler) WatchServices(ctx, actionCtx context.Context) {
+	a.log.InfoContext(ctx, "Watching Docker service events")
+	a.serviceManager.WatchServiceEvents(ctx, func(event docker.ServiceEvent) {
+		a.handleServiceEvent(actionCtx, event)
+	})
+}
+
+// handleServiceEvent applies a single service event
+func (a *Autoscaler) handleServiceEvent(ctx context.Context, event docker.ServiceEvent) {
+	// Cached configs and results may lack a new service or include failed
+	// tasks
+	a.serviceManager.InvalidateService(event.ServiceID)
+	a.promRouter.ClearCache()
+
+	switch event.Action {
+	case docker.ServiceRemoved:
+		a.forgetService(event.ServiceID)
+	case docker.ServiceCreated, docker.ServiceUpdated:
+		// Scaling actions, including ScaleBee's own, are left to the loop
+		if !event.ReplicasOnly {
+			a.reconcileService(ctx, event.ServiceName)
+		}
+	}
+}
+
+// reconcileService enforces the bounds of a single service
+func (a *Autoscaler) reconcileService(ctx context.Context, serviceName string) {
+	config, err := a.serviceConfig(ctx, serviceName)
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to get config for changed service", "service", serviceName, "error", err)
+		return
+	}
+	if !config.AutoscaleEnabled || !config.Replicated || config.Updating {
+		return
+	}
+
+	if err := a.defaultScale(ctx, config); err != nil {
+		a.log.ErrorContext(ctx, "Failed to enforce replica bounds", "service", serviceName, "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// Policies for services in global mode
+const (
+	// GlobalPolicySkip leaves global services alone
+	GlobalPolicySkip = "skip"
+	// GlobalPolicyPlacement scales global services by adding or removing
+	// the node label their placement constraint requires
+	GlobalPolicyPlacement = "placement"
+)
+
+// countGlobal remembers how many autoscaled services are in global mode
+func (a *Autoscaler) countGlobal(configs []*docker.ServiceConfig) {
+	count := 0
+	for _, config := range configs {
+		if config.Global {
+			count++
+		}
+	}
+
+	a.mu.Lock()
+	a.globalServices = count
+	a.mu.Unlock()
+}
+
+// evaluateGlobal handles a service in global mode. Global services have no
+// replica count, so they are skipped quietly unless GlobalPolicy is
+// placement: then the number of nodes carrying the service's node label is
+// its replica count, and scaling labels or unlabels nodes. Without metrics
+// only the bounds are enforced.
+func (a *Autoscaler) evaluateGlobal(ctx context.Context, eval Evaluation, config *docker.ServiceConfig, cpu, memory float64, hasMetrics bool) {
+	serviceName := config.Name
+
+	if a.config.GlobalPolicy != GlobalPolicyPlacement {
+		a.skip(ctx, serviceName, SkipGlobal, "global services are not scaled")
+		return
+	}
+	if config.GlobalNodeLabel == "" {
+		a.skip(ctx, serviceName, SkipGlobal, "no %s.global.node_label label to scale with", docker.LabelPrefix)
+		return
+	}
+
+	labelled, eligible, err := a.serviceManager.GlobalNodes(ctx, config.GlobalNodeLabel)
+	if err != nil {
+		a.log.ErrorContext(ctx, "Failed to get the nodes of global service", "service", serviceName, "error", err)
+		a.fireError(ctx, serviceName, err)
+		return
+	}
+
+	cpuHigh := a.aboveUpper(cpu, a.config.CPUUpperLimit)
+	memoryHigh := a.aboveUpper(memory, a.config.MemoryUpperLimit)
+
+	current := len(labelled)
+	target := current
+	direction := DirectionUp
+	reason := ""
+	switch {
+	case config.MinReplicas > 0 && current < config.MinReplicas:
+		target, reason = config.MinReplicas, "below_minimum"
+	case config.MaxReplicas > 0 && current > config.MaxReplicas:
+		target, direction, reason = config.MaxReplicas, DirectionDown, "above_maximum"
+	case !hasMetrics:
+		a.skip(ctx, serviceName, SkipNoMetrics, "no CPU metrics returned by Prometheus")
+		return
+	case cpuHigh || memoryHigh:
+		if !eval.ScaleUp {
+			return
+		}
+		if config.MaxReplicas > 0 && current >= config.MaxReplicas {
+			a.skip(ctx, serviceName, SkipAtMaximum, "%d nodes", config.MaxReplicas)
+			return
+		}
+		if !a.globalScalable(ctx, config, DirectionUp, config.CooldownUp) {
+			return
+		}
+		target, reason = current+config.StepSize(), "cpu_and_memory"
+		if !cpuHigh {
+			reason = "memory"
+		} else if !memoryHigh {
+			reason = "cpu"
+		}
+		if config.MaxReplicas > 0 && target > config.MaxReplicas {
+			target = config.MaxReplicas
+		}
+	case a.belowLower(cpu, a.config.CPULowerLimit) && a.belowLower(memory, a.config.MemoryLowerLimit):
+		if !eval.ScaleDown {
+			return
+		}
+		if a.scaleDownBlocked() {
+			a.skip(ctx, serviceName, SkipDisaster, "scale-downs are disabled in disaster mode")
+			return
+		}
+		if current <= config.MinReplicas || current == 0 {
+			a.skip(ctx, serviceName, SkipAtMinimum, "%d nodes", config.MinReplicas)
+			return
+		}
+		if !a.globalScalable(ctx, config, DirectionDown, config.CooldownDown) {
+			return
+		}
+		target, direction, reason = max(current-config.StepSize(), config.MinReplicas, 0), DirectionDown, "low_utilization"
+	default:
+		return
+	}
+
+	changed, err := a.placeGlobal(ctx, config, labelled, eligible, target)
+	if err != nil {
+		a.log.ErrorContext(ctx, "Failed to scale global service", "service", serviceName, "error", err)
+		a.notify(ctx, serviceName, true, "Failed to scale global service %s: %v", serviceName, err)
+		a.fireError(ctx, serviceName, err)
+	}
+	if changed == 0 {
+		if err == nil {
+			a.skip(ctx, serviceName, SkipAtMaximum, "all %d eligible nodes run the service", len(eligible))
+		}
+		return
+	}
+
+	to := current + changed
+	if direction == DirectionDown {
+		to = current - changed
+	}
+	a.log.InfoContext(ctx, "Scaled global service", "service", serviceName, "from", current, "to", to, "reason", reason)
+	if reason != "below_minimum" && reason != "above_maximum" {
+		a.recordScaled(config.ID, direction)
+	}
+	a.recordEvent(config, direction, reason)
+	a.fireAction(ctx, Action{Service: serviceName, Direction: direction, Reason: reason,
+		FromReplicas: current, ToReplicas: to})
+	a.notifyScaled(ctx, serviceName, direction, reason, current, to)
+}
+
+// globalScalable checks the cooldown and stabilization window of a global
+// service before a metric-driven scale action
+func (a *Autoscaler) globalScalable(ctx context.Context, config *docker.ServiceConfig, direction string, cooldown time.Duration) bool {
+	if cooling, remaining := a.inCooldown(config.ID, cooldown); cooling {
+		a.skip(ctx, config.Name, SkipCooldown, "scale-%s cooldown, %v remaining", direction, remaining.Round(time.Second))
+		return false
+	}
+	if blocked, phase := a.dampened(config.ID, direction); blocked {
+		a.skip(ctx, config.Name, SkipStabilization, "scale-%s blocked, service was %s recently", direction, phase)
+		return false
+	}
+	return true
+}
+
+// placeGlobal labels or unlabels nodes until target nodes carry the
+// service's node label. Nodes are added in name order and removed in
+// reverse, so the same nodes keep the service. It returns how many nodes
+// were changed, which is less than requested when no eligible node is left.
+func (a *Autoscaler) placeGlobal(ctx context.Context, config *docker.ServiceConfig, labelled, eligible []string, target int) (int, error) {
+	changed := 0
+	if target < len(labelled) {
+		for i := len(labelled) - 1; i >= target; i-- {
+			if err := a.serviceManager.SetNodeLabel(ctx, labelled[i], config.GlobalNodeLabel, false); err != nil {
+				return changed, fmt.Errorf("failed to remove node %s: %w", labelled[i], err)
+			}
+			changed++
+		}
+		return changed, nil
+	}
+
+	has := make(map[string]bool, len(labelled))
+	for _, node := range labelled {
+		has[node] = true
+	}
+	for _, node := range eligible {
+		if len(labelled)+changed >= target {
+			break
+		}
+		if has[node] {
+			continue
+		}
+		if err := a.serviceManager.SetNodeLabel(ctx, node, config.GlobalNodeLabel, true); err != nil {
+			return changed, fmt.Errorf("failed to add node %s: %w", node, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
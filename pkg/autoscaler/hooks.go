@@ -0,0 +1,130 @@
+package autoscaler
+
+import (
+	"context"
+
+	"github.com/dxas90/scalebee/pkg/events"
+	"github.com/dxas90/scalebee/pkg/prometheus"
+)
+
+// Decision is a scaling decision about to be acted on
+type Decision struct {
+	Service       string
+	Direction     string
+	Reason        string
+	CPUPercent    float64
+	MemoryPercent float64
+	Replicas      uint64
+}
+
+// Action is a scaling action that was applied
+type Action struct {
+	Service      string
+	Direction    string
+	Reason       string
+	FromReplicas int
+	ToReplicas   int
+	// Vertical is set when resources changed instead of replicas
+	Vertical bool
+}
+
+// DecisionHook is called before a decision is acted on. Returning false
+// vetoes the decision for this cycle.
+type DecisionHook func(ctx context.Context, decision Decision) bool
+
+// ActionHook is called after a scaling action was applied
+type ActionHook func(ctx context.Context, action Action)
+
+// ErrorHook is called for errors of the decision loop. The service is empty
+// for errors that are not specific to one service.
+type ErrorHook func(ctx context.Context, service string, err error)
+
+// MetricsFunc fetches CPU metrics and memory percentages per service
+type MetricsFunc func(ctx context.Context) ([]prometheus.ServiceMetric, map[string]float64, error)
+
+// MetricsMiddleware wraps the metrics source, e.g. to filter, adjust, or add
+// metrics before decisions are made
+type MetricsMiddleware func(next MetricsFunc) MetricsFunc
+
+// hooks holds the callbacks registered by programs embedding the autoscaler
+type hooks struct {
+	decision []DecisionHook
+	action   []ActionHook
+	err      []ErrorHook
+	metrics  MetricsFunc
+}
+
+// OnDecision registers a hook called before every scaling decision is acted on
+func (a *Autoscaler) OnDecision(hook DecisionHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks.decision = append(a.hooks.decision, hook)
+}
+
+// OnAction registers a hook called after every applied scaling action
+func (a *Autoscaler) OnAction(hook ActionHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks.action = append(a.hooks.action, hook)
+}
+
+// OnError registers a hook called for errors of the decision loop
+func (a *Autoscaler) OnError(hook ErrorHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks.err = append(a.hooks.err, hook)
+}
+
+// UseMetricsMiddleware wraps the metrics source. Middlewares registered later
+// wrap earlier ones, so they see the metrics first.
+func (a *Autoscaler) UseMetricsMiddleware(mw MetricsMiddleware) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks.metrics = mw(a.hooks.metrics)
+}
+
+// getServiceMetrics fetches metrics through the registered middlewares
+func (a *Autoscaler) getServiceMetrics(ctx context.Context) ([]prometheus.ServiceMetric, map[string]float64, error) {
+	a.mu.Lock()
+	fetch := a.hooks.metrics
+	a.mu.Unlock()
+	return fetch(ctx)
+}
+
+// allowDecision runs the decision hooks and reports whether all allow it
+func (a *Autoscaler) allowDecision(ctx context.Context, decision Decision) bool {
+	a.mu.Lock()
+	hooks := append([]DecisionHook(nil), a.hooks.decision...)
+	a.mu.Unlock()
+
+	for _, hook := range hooks {
+		if !hook(ctx, decision) {
+			return false
+		}
+	}
+	return true
+}
+
+// fireAction runs the action hooks
+func (a *Autoscaler) fireAction(ctx context.Context, action Action) {
+	a.mu.Lock()
+	hooks := append([]ActionHook(nil), a.hooks.action...)
+	a.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx, action)
+	}
+}
+
+// fireError runs the error hooks and publishes the error
+func (a *Autoscaler) fireError(ctx context.Context, service string, err error) {
+	a.publish(ctx, events.Event{Type: events.TypeError, Service: service, Message: err.Error(), Error: err.Error()})
+
+	a.mu.Lock()
+	hooks := append([]ErrorHook(nil), a.hooks.err...)
+	a.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx, service, err)
+	}
+}
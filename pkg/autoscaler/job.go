@@ -0,0 +1,71 @@
+package autoscaler
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// evaluateJob starts a run of a replicated job when its backlog query
+// reports pending items. Each run gets one completion per
+// JobItemsPerTask items, with as many concurrent tasks within the replica
+// bounds. Swarm restarts a job whose spec changes, so jobs are only scaled
+// once their previous run finished.
+func (a *Autoscaler) evaluateJob(ctx context.Context, eval Evaluation, config *docker.ServiceConfig) {
+	serviceName := config.Name
+
+	if config.JobQuery == "" {
+		a.skip(ctx, serviceName, SkipNoMetrics, "no %s.job.query label", docker.LabelPrefix)
+		return
+	}
+	if !eval.ScaleUp {
+		return
+	}
+
+	backlog, err := a.promRouter.QueryValue(ctx, serviceName, config.JobQuery)
+	if err != nil {
+		a.log.ErrorContext(ctx, "Failed to query the backlog of job", "service", serviceName, "error", err)
+		a.skip(ctx, serviceName, SkipNoMetrics, "backlog query failed: %v", err)
+		return
+	}
+	if backlog <= 0 {
+		return
+	}
+
+	if config.CurrentReplicas > 0 {
+		a.log.InfoContext(ctx, "Job has a backlog but tasks are still running", "service", serviceName, "backlog", backlog, "replicas", config.CurrentReplicas)
+		a.skip(ctx, serviceName, SkipJobRunning, "%d tasks running, backlog of %.0f", config.CurrentReplicas, backlog)
+		return
+	}
+
+	if cooling, remaining := a.inCooldown(config.ID, config.CooldownUp); cooling {
+		a.skip(ctx, serviceName, SkipCooldown, "scale-up cooldown, %v remaining", remaining.Round(time.Second))
+		return
+	}
+
+	completions := int(math.Ceil(backlog / config.JobItemsPerTask))
+	concurrency := completions
+	if config.MaxReplicas > 0 && concurrency > config.MaxReplicas {
+		concurrency = config.MaxReplicas
+	}
+	concurrency = max(concurrency, config.MinReplicas)
+	completions = max(completions, concurrency)
+
+	a.log.InfoContext(ctx, "Starting job", "service", serviceName, "backlog", backlog,
+		"completions", completions, "concurrency", concurrency)
+	if err := a.serviceManager.ScaleJob(ctx, config.ID, uint64(concurrency), uint64(completions), "backlog"); err != nil {
+		a.log.ErrorContext(ctx, "Failed to scale job", "service", serviceName, "error", err)
+		a.notify(ctx, serviceName, true, "Failed to scale job %s: %v", serviceName, err)
+		a.fireError(ctx, serviceName, err)
+		return
+	}
+
+	from := int(config.JobMaxConcurrent)
+	a.recordScaled(config.ID, DirectionUp)
+	a.recordEvent(config, DirectionUp, "backlog")
+	a.fireAction(ctx, Action{Service: serviceName, Direction: DirectionUp, Reason: "backlog",
+		FromReplicas: from, ToReplicas: concurrency})
+	a.notifyScaled(ctx, serviceName, DirectionUp, "backlog", from, concurrency)
+}
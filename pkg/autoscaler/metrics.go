@@ -0,0 +1,219 @@
+package autoscaler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DirectionUp marks a scale-up action
+	DirectionUp = "up"
+	// DirectionDown marks a scale-down action
+	DirectionDown = "down"
+)
+
+// scalingEvent is the last scaling action taken for a service in one direction
+type scalingEvent struct {
+	service   string
+	direction string
+	reason    string
+	timestamp time.Time
+}
+
+// headroom is how far a service is from its thresholds and replica maximum
+type headroom struct {
+	cpuPercent    float64
+	memoryPercent float64
+	replicas      int
+	hasMaximum    bool
+}
+
+// serviceHeadroom computes the headroom of a service from its latest metrics
+func (a *Autoscaler) serviceHeadroom(config *docker.ServiceConfig, avgCPU, avgMemory float64) headroom {
+	h := headroom{
+		cpuPercent:    a.config.CPUUpperLimit - avgCPU,
+		memoryPercent: a.config.MemoryUpperLimit - avgMemory,
+	}
+	if config.MaxReplicas > 0 {
+		h.replicas = config.MaxReplicas - int(config.CurrentReplicas)
+		h.hasMaximum = true
+	}
+	return h
+}
+
+// recordEvent remembers a scaling action so it can be exported as a metric
+func (a *Autoscaler) recordEvent(config *docker.ServiceConfig, direction, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Drop events of an earlier service with the same name, which would
+	// otherwise be exported with identical labels
+	for key, e := range a.events {
+		if e.service == config.Name && !strings.HasPrefix(key, config.ID+"/") {
+			delete(a.events, key)
+		}
+	}
+
+	a.events[config.ID+"/"+direction] = scalingEvent{
+		service:   config.Name,
+		direction: direction,
+		reason:    reason,
+		timestamp: time.Now(),
+	}
+}
+
+var (
+	degradedDesc = prom.NewDesc("scalebee_degraded",
+		"Whether metric-driven scaling is suspended because Prometheus is unavailable", nil, nil)
+	disasterDesc = prom.NewDesc("scalebee_disaster_mode",
+		"Whether the disaster mode policy is active", nil, nil)
+	staleDesc = prom.NewDesc("scalebee_stale",
+		"Whether no reconcile run succeeded for longer than STALE_RUN_INTERVALS intervals", nil, nil)
+	endpointUpDesc = prom.NewDesc("scalebee_prometheus_endpoint_up",
+		"Whether the last query to a Prometheus endpoint succeeded", []string{"endpoint"}, nil)
+	circuitOpenDesc = prom.NewDesc("scalebee_prometheus_circuit_open",
+		"Whether queries to a Prometheus endpoint are paused by its circuit breaker", []string{"endpoint"}, nil)
+	urlActiveDesc = prom.NewDesc("scalebee_prometheus_url_active",
+		"Whether queries of a Prometheus endpoint are sent to this URL", []string{"endpoint", "url"}, nil)
+	urlUpDesc = prom.NewDesc("scalebee_prometheus_url_up",
+		"Whether the last request to a Prometheus URL succeeded", []string{"endpoint", "url"}, nil)
+	convergingDesc = prom.NewDesc("scalebee_service_converging",
+		"Whether ScaleBee waits for a scaled service to run its new replica count", []string{"service"}, nil)
+	convergenceDesc = prom.NewDesc("scalebee_convergence_total",
+		"Waits for scaled services to run their new replica count, by outcome", []string{"service", "outcome"}, nil)
+	convergenceDurationDesc = prom.NewDesc("scalebee_convergence_duration_seconds",
+		"How long the last wait for convergence took", []string{"service"}, nil)
+	scalingEventDesc = prom.NewDesc("scalebee_scaling_event",
+		"Unix timestamp of the last scaling action per service and direction", []string{"service", "direction", "reason"}, nil)
+	discardedSamplesDesc = prom.NewDesc("scalebee_discarded_samples_total",
+		"Service metrics discarded as implausible, e.g. after an exporter restart", []string{"service"}, nil)
+	backpressureDesc = prom.NewDesc("scalebee_backpressure_engaged",
+		"Whether the gateway is shedding load for a service saturated at its maximum", []string{"service"}, nil)
+	cpuHeadroomDesc = prom.NewDesc("scalebee_service_cpu_headroom_percent",
+		"CPU percentage points left before the scale-up threshold", []string{"service"}, nil)
+	memoryHeadroomDesc = prom.NewDesc("scalebee_service_memory_headroom_percent",
+		"Memory percentage points left before the scale-up threshold", []string{"service"}, nil)
+	clusterFullDesc = prom.NewDesc("scalebee_cluster_full",
+		"Whether the last scale-up was blocked because the nodes have no resources left", nil, nil)
+	clusterFullTotalDesc = prom.NewDesc("scalebee_cluster_full_total",
+		"Scale-ups blocked because the nodes have no resources left", nil, nil)
+	unavailableNodesDesc = prom.NewDesc("scalebee_nodes_unavailable",
+		"Swarm nodes that are drained, paused or down", nil, nil)
+	reschedulingDesc = prom.NewDesc("scalebee_service_rescheduling_tasks",
+		"Tasks of a service being moved off drained or down nodes", []string{"service"}, nil)
+	globalServicesDesc = prom.NewDesc("scalebee_global_services",
+		"Autoscaled services in global mode, which are only scaled with GLOBAL_SERVICE_POLICY=placement", nil, nil)
+	replicaHeadroomDesc = prom.NewDesc("scalebee_service_replica_headroom",
+		"Replicas left before the service reaches its maximum", []string{"service"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (a *Autoscaler) Describe(ch chan<- *prom.Desc) {
+	ch <- degradedDesc
+	ch <- disasterDesc
+	ch <- staleDesc
+	ch <- clusterFullDesc
+	ch <- clusterFullTotalDesc
+	ch <- unavailableNodesDesc
+	ch <- reschedulingDesc
+	ch <- globalServicesDesc
+	ch <- endpointUpDesc
+	ch <- circuitOpenDesc
+	ch <- urlActiveDesc
+	ch <- urlUpDesc
+	ch <- convergingDesc
+	ch <- convergenceDesc
+	ch <- convergenceDurationDesc
+	ch <- scalingEventDesc
+	ch <- discardedSamplesDesc
+	ch <- backpressureDesc
+	ch <- cpuHeadroomDesc
+	ch <- memoryHeadroomDesc
+	ch <- replicaHeadroomDesc
+	ch <- exporterVersionDesc
+	ch <- versionSkewDesc
+	for _, c := range a.self.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector. The scaling event gauge holds the
+// Unix timestamp of the last action per service and direction, so Grafana
+// can render it as markers on graphs.
+func (a *Autoscaler) Collect(ch chan<- prom.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch <- prom.MustNewConstMetric(degradedDesc, prom.GaugeValue, boolValue(a.degraded))
+	ch <- prom.MustNewConstMetric(disasterDesc, prom.GaugeValue, boolValue(a.disaster.Active))
+	stale, _ := a.stale()
+	ch <- prom.MustNewConstMetric(staleDesc, prom.GaugeValue, boolValue(stale))
+	ch <- prom.MustNewConstMetric(clusterFullDesc, prom.GaugeValue, boolValue(a.clusterFull))
+	ch <- prom.MustNewConstMetric(clusterFullTotalDesc, prom.CounterValue, float64(a.clusterFullTotal))
+	ch <- prom.MustNewConstMetric(unavailableNodesDesc, prom.GaugeValue, float64(a.unavailableNodes))
+	ch <- prom.MustNewConstMetric(globalServicesDesc, prom.GaugeValue, float64(a.globalServices))
+
+	for _, h := range a.promRouter.Health() {
+		ch <- prom.MustNewConstMetric(endpointUpDesc, prom.GaugeValue, boolValue(h.Healthy), h.Name)
+		ch <- prom.MustNewConstMetric(circuitOpenDesc, prom.GaugeValue, boolValue(h.Circuit.State == prometheus.CircuitOpen), h.Name)
+		for _, u := range h.URLs {
+			ch <- prom.MustNewConstMetric(urlActiveDesc, prom.GaugeValue, boolValue(u.Active), h.Name, u.URL)
+			ch <- prom.MustNewConstMetric(urlUpDesc, prom.GaugeValue, boolValue(u.Healthy), h.Name, u.URL)
+		}
+	}
+
+	for _, e := range a.events {
+		ch <- prom.MustNewConstMetric(scalingEventDesc, prom.GaugeValue, float64(e.timestamp.Unix()),
+			e.service, e.direction, e.reason)
+	}
+
+	for name, id := range a.serviceIDs {
+		st, ok := a.states[id]
+		if !ok {
+			continue
+		}
+		if st.discardedSamples > 0 {
+			ch <- prom.MustNewConstMetric(discardedSamplesDesc, prom.CounterValue, float64(st.discardedSamples), name)
+		}
+		if moving := a.rescheduling[id]; moving > 0 {
+			ch <- prom.MustNewConstMetric(reschedulingDesc, prom.GaugeValue, float64(moving), name)
+		}
+		if st.backpressure {
+			ch <- prom.MustNewConstMetric(backpressureDesc, prom.GaugeValue, 1, name)
+		}
+		if c := st.convergence; c.active || len(c.outcomes) > 0 {
+			ch <- prom.MustNewConstMetric(convergingDesc, prom.GaugeValue, boolValue(c.active), name)
+			for outcome, count := range c.outcomes {
+				ch <- prom.MustNewConstMetric(convergenceDesc, prom.CounterValue, float64(count), name, outcome)
+			}
+			if len(c.outcomes) > 0 {
+				ch <- prom.MustNewConstMetric(convergenceDurationDesc, prom.GaugeValue, c.duration.Seconds(), name)
+			}
+		}
+	}
+
+	for service, h := range a.headroom {
+		ch <- prom.MustNewConstMetric(cpuHeadroomDesc, prom.GaugeValue, h.cpuPercent, service)
+		ch <- prom.MustNewConstMetric(memoryHeadroomDesc, prom.GaugeValue, h.memoryPercent, service)
+		if h.hasMaximum {
+			ch <- prom.MustNewConstMetric(replicaHeadroomDesc, prom.GaugeValue, float64(h.replicas), service)
+		}
+	}
+
+	a.collectVersionMetrics(ch)
+	for _, c := range a.self.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// boolValue converts a flag to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,60 @@
+package autoscaler
+
+import (
+	"context"
+)
+
+// OOM reactions
+const (
+	OOMReactionNone   = "none"
+	OOMReactionNotify = "notify"
+	OOMReactionScale  = "scale"
+	OOMReactionBoth   = "both"
+)
+
+// WatchOOMKills reacts to OOM-killed tasks of autoscaled services until ctx
+// is cancelled. The averaged memory metric often looks fine right after a
+// container dies, so this reacts to the kill itself. Reactions run on
+// actionCtx, so cancelling ctx on shutdown doesn't abort one halfway; it
+// returns once the reaction in flight is done.
+func (a *Autoscaler) WatchOOMKills(ctx, actionCtx context.Context) {
+	if a.config.OOMReaction == "" || a.config.OOMReaction == OOMReactionNone {
+		return
+	}
+
+	a.log.InfoContext(ctx, "Watching for OOM-killed tasks", "reaction", a.config.OOMReaction)
+	a.serviceManager.WatchOOMKills(ctx, func(serviceName, containerID string) {
+		a.handleOOMKill(actionCtx, serviceName, containerID)
+	})
+}
+
+// handleOOMKill applies the configured reaction to an OOM-killed task
+func (a *Autoscaler) handleOOMKill(ctx context.Context, serviceName, containerID string) {
+	config, err := a.serviceConfig(ctx, serviceName)
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to get config for OOM-killed service", "service", serviceName, "error", err)
+		return
+	}
+
+	if !config.AutoscaleEnabled {
+		return
+	}
+
+	a.log.WarnContext(ctx, "Container was OOM-killed", "service", serviceName, "container", containerID[:min(12, len(containerID))])
+
+	reaction := a.config.OOMReaction
+	if reaction == OOMReactionNotify || reaction == OOMReactionBoth {
+		a.notify(ctx, serviceName, true, "Container %.12s of service %s was OOM-killed", containerID, serviceName)
+	}
+
+	if (reaction == OOMReactionScale || reaction == OOMReactionBoth) && config.Updating {
+		a.log.InfoContext(ctx, "Service has a rolling update in progress, not scaling up after the OOM kill", "service", serviceName)
+		return
+	}
+	if reaction == OOMReactionScale || reaction == OOMReactionBoth {
+		if err := a.scaleUp(ctx, config, "oom_kill", false); err != nil {
+			a.log.ErrorContext(ctx, "Failed to scale up service after OOM kill", "service", serviceName, "error", err)
+			a.notify(ctx, serviceName, true, "Failed to scale up service %s after OOM kill: %v", serviceName, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// metricJumpMinPoints is the smallest increase in percentage points that
+// counts as a jump, so low values doubling (1% to 3%) are never discarded
+const metricJumpMinPoints = 25.0
+
+// checkPlausible compares a service's metrics with the previous cycle. A
+// value that grew by more than MetricJumpFactor, as after an exporter restart
+// or counter reset, is discarded for one cycle; if it persists in the next
+// cycle it is accepted as real load. Negative values are always discarded.
+func (a *Autoscaler) checkPlausible(config *docker.ServiceConfig, cpuPercent, memoryPercent float64) (bool, string) {
+	if cpuPercent < 0 || memoryPercent < 0 {
+		a.recordDiscarded(config.ID)
+		return false, fmt.Sprintf("negative CPU %.2f%% or memory %.2f%%", cpuPercent, memoryPercent)
+	}
+	if a.config.MetricJumpFactor <= 0 {
+		return true, ""
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.states[config.ID]
+	if !ok || !st.sampled {
+		return true, ""
+	}
+	if st.discarded {
+		st.discarded = false
+		return true, ""
+	}
+
+	var reason string
+	switch {
+	case a.jumped(st.cpuPercent, cpuPercent):
+		reason = fmt.Sprintf("CPU jumped from %.2f%% to %.2f%%", st.cpuPercent, cpuPercent)
+	case a.jumped(st.memoryPercent, memoryPercent):
+		reason = fmt.Sprintf("memory jumped from %.2f%% to %.2f%%", st.memoryPercent, memoryPercent)
+	default:
+		return true, ""
+	}
+
+	st.discarded = true
+	st.discardedSamples++
+	return false, reason
+}
+
+// jumped reports whether a metric grew implausibly between two cycles
+func (a *Autoscaler) jumped(previous, current float64) bool {
+	return current-previous >= metricJumpMinPoints && current > previous*a.config.MetricJumpFactor
+}
+
+// recordDiscarded counts a discarded sample of a service
+func (a *Autoscaler) recordDiscarded(serviceID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state(serviceID).discardedSamples++
+}
@@ -0,0 +1,103 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// RecommendationHeadroom is the margin added on top of observed usage
+const RecommendationHeadroom = 0.15
+
+// Recommendation holds suggested resource and replica settings for a service.
+// Recommendations are never applied.
+type Recommendation struct {
+	Service string `json:"service"`
+	Window  string `json:"window"`
+
+	// CPUReservation is in cores, memory in megabytes
+	CPUReservation      float64 `json:"cpu_reservation"`
+	MemoryReservationMB float64 `json:"memory_reservation_mb"`
+	MemoryLimitMB       float64 `json:"memory_limit_mb"`
+	MinReplicas         int     `json:"min_replicas"`
+	MaxReplicas         int     `json:"max_replicas"`
+
+	// Current reservations, when the exporter publishes service resource
+	// metrics (SERVICE_RESOURCE_METRICS)
+	CurrentCPUReservation      float64 `json:"current_cpu_reservation,omitempty"`
+	CurrentMemoryReservationMB float64 `json:"current_memory_reservation_mb,omitempty"`
+
+	// Current settings, when the service exists and has autoscaling labels
+	CurrentMinReplicas int  `json:"current_min_replicas,omitempty"`
+	CurrentMaxReplicas int  `json:"current_max_replicas,omitempty"`
+	Autoscaled         bool `json:"autoscaled"`
+}
+
+// Recommendations profiles every service with metrics over the window and
+// suggests reservations and replica bounds:
+//
+//   - CPU reservation: p95 of per-task CPU plus headroom
+//   - Memory reservation: p95 of per-task memory plus headroom
+//   - Memory limit: peak per-task memory plus twice the headroom
+//   - Min/max replicas: replicas needed to keep tasks below the CPU upper
+//     limit at low (p5) and peak total CPU, the maximum with headroom
+func (a *Autoscaler) Recommendations(ctx context.Context, window time.Duration) ([]Recommendation, error) {
+	usage, err := a.promRouter.GetServiceUsage(ctx, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service usage: %w", err)
+	}
+
+	current := make(map[string][2]int)
+	services, err := a.serviceManager.ListAutoscaledServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range services {
+		current[config.Name] = [2]int{config.MinReplicas, config.MaxReplicas}
+	}
+
+	recommendations := make([]Recommendation, 0, len(usage))
+	for name, u := range usage {
+		minReplicas := int(math.Ceil(u.TotalCPULow / a.config.CPUUpperLimit))
+		if minReplicas < 1 {
+			minReplicas = 1
+		}
+		maxReplicas := int(math.Ceil(u.TotalCPUMax * (1 + RecommendationHeadroom) / a.config.CPUUpperLimit))
+		if maxReplicas < minReplicas {
+			maxReplicas = minReplicas
+		}
+
+		rec := Recommendation{
+			Service:             name,
+			Window:              window.String(),
+			CPUReservation:      round(u.TaskCPUP95/100*(1+RecommendationHeadroom), 2),
+			MemoryReservationMB: math.Ceil(u.TaskMemoryP95MB * (1 + RecommendationHeadroom)),
+			MemoryLimitMB:       math.Ceil(u.TaskMemoryMaxMB * (1 + 2*RecommendationHeadroom)),
+			MinReplicas:         minReplicas,
+			MaxReplicas:         maxReplicas,
+
+			CurrentCPUReservation:      u.CPUReservation,
+			CurrentMemoryReservationMB: math.Round(u.MemoryReservationMB),
+		}
+		if bounds, ok := current[name]; ok {
+			rec.Autoscaled = true
+			rec.CurrentMinReplicas = bounds[0]
+			rec.CurrentMaxReplicas = bounds[1]
+		}
+		recommendations = append(recommendations, rec)
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].Service < recommendations[j].Service
+	})
+
+	return recommendations, nil
+}
+
+// round rounds v to the given number of decimals
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
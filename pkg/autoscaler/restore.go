@@ -0,0 +1,86 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// Restore targets for ShutdownRestore
+const (
+	RestoreNone     = "none"
+	RestoreMinimum  = "minimum"
+	RestoreSnapshot = "snapshot"
+)
+
+// recordSnapshot remembers the declared replicas of a service the first time
+// it is seen, before ScaleBee changes it
+func (a *Autoscaler) recordSnapshot(config *docker.ServiceConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.snapshot[config.ID]; !ok {
+		a.snapshot[config.ID] = config.DesiredReplicas
+	}
+}
+
+// Restore scales every autoscaled service back to its configured minimum or
+// to the replicas recorded when ScaleBee first saw it. Services without a
+// minimum or a snapshot are left alone. Errors are logged per service and the
+// number of failures is returned as an error.
+func (a *Autoscaler) Restore(ctx context.Context, target string) error {
+	if target == RestoreNone {
+		return nil
+	}
+
+	services, err := a.serviceManager.ListAutoscaledServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	snapshot := make(map[string]uint64, len(a.snapshot))
+	for id, replicas := range a.snapshot {
+		snapshot[id] = replicas
+	}
+	a.mu.Unlock()
+
+	failed := 0
+	for _, config := range services {
+		if !config.Replicated {
+			continue
+		}
+
+		var replicas uint64
+		switch target {
+		case RestoreMinimum:
+			if config.MinReplicas <= 0 {
+				continue
+			}
+			replicas = uint64(config.MinReplicas)
+		case RestoreSnapshot:
+			var ok bool
+			if replicas, ok = snapshot[config.ID]; !ok {
+				continue
+			}
+		default:
+			return fmt.Errorf("unknown restore target %q", target)
+		}
+
+		if config.DesiredReplicas == replicas {
+			continue
+		}
+
+		a.log.InfoContext(ctx, "Restoring service", "service", config.Name, "from", config.DesiredReplicas, "to", replicas, "target", target)
+		if err := a.serviceManager.ScaleService(ctx, config.ID, replicas, "restore_"+target); err != nil {
+			a.log.ErrorContext(ctx, "Failed to restore service", "service", config.Name, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to restore %d service(s)", failed)
+	}
+	return nil
+}
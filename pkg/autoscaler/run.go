@@ -0,0 +1,56 @@
+package autoscaler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// runIDKey is the context key of the run ID
+type runIDKey struct{}
+
+// WithRunID returns a context carrying the ID of a reconcile run. Evaluate
+// generates one unless the context already carries one.
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// RunID returns the ID of the reconcile run a context belongs to, e.g. in
+// decision and action hooks. It is empty outside of runs, such as for
+// Docker events.
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// newRunID returns a random run ID
+func newRunID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runHandler adds the run ID of the context to every log record, so the
+// lines of one run can be found in a noisy log stream
+type runHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h runHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RunID(ctx); id != "" {
+		r.AddAttrs(slog.String("run_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h runHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return runHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h runHandler) WithGroup(name string) slog.Handler {
+	return runHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,91 @@
+package autoscaler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/events"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DecisionScaleUp, DecisionScaleDown and DecisionSkip are the values
+	// of the decision label of scalebee_decisions_total
+	DecisionScaleUp   = "scale_up"
+	DecisionScaleDown = "scale_down"
+	DecisionSkip      = "skip"
+)
+
+// selfMetrics describe the behaviour of the autoscaler itself. Unlike the
+// gauges built from state in Collect, they accumulate over the lifetime of
+// the process.
+type selfMetrics struct {
+	decisions         *prom.CounterVec
+	errors            *prom.CounterVec
+	runDuration       prom.Histogram
+	runFailures       prom.Counter
+	runTimeouts       prom.Counter
+	lastSuccessfulRun prom.Gauge
+}
+
+// newSelfMetrics creates the metrics of a new autoscaler
+func newSelfMetrics() *selfMetrics {
+	return &selfMetrics{
+		decisions: prom.NewCounterVec(prom.CounterOpts{
+			Name: "scalebee_decisions_total",
+			Help: "Scaling decisions per service, by decision and reason",
+		}, []string{"service", "decision", "reason"}),
+		errors: prom.NewCounterVec(prom.CounterOpts{
+			Name: "scalebee_errors_total",
+			Help: "Errors while autoscaling, by service (empty for errors not tied to one)",
+		}, []string{"service"}),
+		runDuration: prom.NewHistogram(prom.HistogramOpts{
+			Name:    "scalebee_reconcile_duration_seconds",
+			Help:    "Duration of reconcile runs",
+			Buckets: prom.ExponentialBuckets(0.05, 2, 10),
+		}),
+		runFailures: prom.NewCounter(prom.CounterOpts{
+			Name: "scalebee_reconcile_failures_total",
+			Help: "Reconcile runs that returned an error",
+		}),
+		runTimeouts: prom.NewCounter(prom.CounterOpts{
+			Name: "scalebee_reconcile_timeouts_total",
+			Help: "Reconcile runs cancelled because they exceeded RUN_TIMEOUT",
+		}),
+		lastSuccessfulRun: prom.NewGauge(prom.GaugeOpts{
+			Name: "scalebee_last_successful_run_timestamp_seconds",
+			Help: "Unix timestamp of the last reconcile run that completed without error",
+		}),
+	}
+}
+
+// collectors returns the metrics, for Describe and Collect
+func (m *selfMetrics) collectors() []prom.Collector {
+	return []prom.Collector{m.decisions, m.errors, m.runDuration, m.runFailures, m.runTimeouts, m.lastSuccessfulRun}
+}
+
+// observeRun records the outcome of a reconcile run
+func (m *selfMetrics) observeRun(start time.Time, err error) {
+	m.runDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.runFailures.Inc()
+		return
+	}
+	m.lastSuccessfulRun.SetToCurrentTime()
+}
+
+// count is subscribed to the event bus and counts decisions and errors
+func (m *selfMetrics) count(ctx context.Context, e events.Event) {
+	switch e.Type {
+	case events.TypeScaled:
+		decision := DecisionScaleUp
+		if e.Direction == DirectionDown {
+			decision = DecisionScaleDown
+		}
+		m.decisions.WithLabelValues(e.Service, decision, e.Reason).Inc()
+	case events.TypeSkipped:
+		m.decisions.WithLabelValues(e.Service, DecisionSkip, e.Reason).Inc()
+	case events.TypeError:
+		m.errors.WithLabelValues(e.Service).Inc()
+	}
+}
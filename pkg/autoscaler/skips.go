@@ -0,0 +1,95 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/events"
+)
+
+// Reasons a labeled service was skipped during a cycle
+const (
+	SkipNoMetrics        = "no_metrics"
+	SkipNotReplicated    = "not_replicated"
+	SkipGlobal           = "global_mode"
+	SkipJobRunning       = "job_running"
+	SkipDegraded         = "degraded"
+	SkipGracePeriod      = "grace_period"
+	SkipCooldown         = "cooldown"
+	SkipStabilization    = "stabilization"
+	SkipPendingTasks     = "pending_tasks"
+	SkipAtMaximum        = "at_maximum"
+	SkipAtSoftMaximum    = "at_soft_maximum"
+	SkipPlacementLimit   = "placement_limit"
+	SkipClusterFull      = "cluster_full"
+	SkipAtMinimum        = "at_minimum"
+	SkipScaleDownLimit   = "scale_down_limit"
+	SkipRescheduling     = "rescheduling"
+	SkipVerticalBounds   = "vertical_bounds"
+	SkipVetoed           = "vetoed"
+	SkipCrashLoop        = "crash_loop"
+	SkipAwaitingApproval = "awaiting_approval"
+	SkipImplausible      = "implausible_metrics"
+	SkipDisaster         = "disaster_mode"
+	SkipConverging       = "converging"
+	SkipRollingUpdate    = "rolling_update"
+)
+
+// Skip describes why a labeled service was not scaled in the last cycle
+type Skip struct {
+	Service string    `json:"service"`
+	Reason  string    `json:"reason"`
+	Detail  string    `json:"detail,omitempty"`
+	Time    time.Time `json:"time"`
+	RunID   string    `json:"run_id,omitempty"`
+}
+
+// Skips returns the services skipped during the last completed cycle
+func (a *Autoscaler) Skips() []Skip {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	skips := make([]Skip, len(a.skips))
+	copy(skips, a.skips)
+	return skips
+}
+
+// skip records that a service was skipped in the current cycle and
+// publishes the skip
+func (a *Autoscaler) skip(ctx context.Context, serviceName, reason, format string, args ...interface{}) {
+	s := Skip{
+		Service: serviceName,
+		Reason:  reason,
+		Detail:  fmt.Sprintf(format, args...),
+		Time:    time.Now(),
+		RunID:   RunID(ctx),
+	}
+
+	a.mu.Lock()
+	a.cycleSkips = append(a.cycleSkips, s)
+	a.mu.Unlock()
+
+	a.publish(ctx, events.Event{Type: events.TypeSkipped, Time: s.Time,
+		Service: serviceName, Message: s.Detail, Reason: reason})
+}
+
+// beginCycle starts collecting skips for a new cycle
+func (a *Autoscaler) beginCycle() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cycleSkips = nil
+}
+
+// endCycle publishes the skips collected during the cycle
+func (a *Autoscaler) endCycle() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sort.Slice(a.cycleSkips, func(i, j int) bool {
+		return a.cycleSkips[i].Service < a.cycleSkips[j].Service
+	})
+	a.skips = a.cycleSkips
+	a.cycleSkips = nil
+}
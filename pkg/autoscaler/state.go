@@ -0,0 +1,189 @@
+package autoscaler
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// replicaChange records how many replicas were changed at a point in time
+type replicaChange struct {
+	at    time.Time
+	count int
+}
+
+// serviceState holds per-service scaling history used by the safety limits
+type serviceState struct {
+	scaleDowns []replicaChange
+	lastScaled time.Time
+	dampener   dampener
+
+	// Latest metrics, included in notifications
+	cpuPercent    float64
+	memoryPercent float64
+	sampled       bool
+
+	// discarded is set when the last cycle's metrics were implausible
+	discarded        bool
+	discardedSamples int
+
+	// backpressure is set while the gateway sheds load for the service;
+	// calmSince is when its load dropped below the scale-up thresholds
+	backpressure bool
+	calmSince    time.Time
+
+	// saturated is set once the service needed more than its maximum, so
+	// the notice is sent once until it drops below the maximum
+	saturated bool
+
+	convergence convergence
+}
+
+// state returns the state for a service, creating it if needed. State is
+// keyed by service ID, so a service recreated under the same name starts
+// fresh. Callers must hold a.mu.
+func (a *Autoscaler) state(serviceID string) *serviceState {
+	st, ok := a.states[serviceID]
+	if !ok {
+		st = &serviceState{}
+		a.states[serviceID] = st
+	}
+	return st
+}
+
+// scaleDownBudget returns how many replicas may still be removed from a
+// service within the current scale-down window, and false when the limit is
+// disabled
+func (a *Autoscaler) scaleDownBudget(serviceID string, currentReplicas int) (int, bool) {
+	if a.config.ScaleDownMaxPercent <= 0 {
+		return 0, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := a.state(serviceID)
+	cutoff := time.Now().Add(-a.config.ScaleDownWindow)
+
+	removed := 0
+	kept := st.scaleDowns[:0]
+	for _, c := range st.scaleDowns {
+		if c.at.After(cutoff) {
+			kept = append(kept, c)
+			removed += c.count
+		}
+	}
+	st.scaleDowns = kept
+
+	// The percentage applies to the replica count at the start of the window,
+	// and at least one replica may always be removed per window
+	allowed := int(math.Ceil(float64(currentReplicas+removed) * a.config.ScaleDownMaxPercent / 100))
+	if allowed < 1 {
+		allowed = 1
+	}
+
+	// Removals can exceed the allowance once the replica count dropped further
+	return max(allowed-removed, 0), true
+}
+
+// recordScaleDown adds a scale-down to the service's window history
+func (a *Autoscaler) recordScaleDown(serviceID string, removed int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := a.state(serviceID)
+	st.scaleDowns = append(st.scaleDowns, replicaChange{at: time.Now(), count: removed})
+}
+
+// inCooldown reports whether a service scaled too recently to scale again
+// and returns the remaining cooldown time
+func (a *Autoscaler) inCooldown(serviceID string, cooldown time.Duration) (bool, time.Duration) {
+	if cooldown <= 0 {
+		return false, 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := a.state(serviceID)
+	if st.lastScaled.IsZero() {
+		return false, 0
+	}
+
+	remaining := cooldown - time.Since(st.lastScaled)
+	return remaining > 0, remaining
+}
+
+// recordScaled marks the time and direction of the last scaling action for a service
+func (a *Autoscaler) recordScaled(serviceID, direction string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	st := a.state(serviceID)
+	st.lastScaled = now
+	st.dampener.record(direction, now)
+}
+
+// recordUsage remembers the latest metrics of a service and which service ID
+// its name currently refers to
+func (a *Autoscaler) recordUsage(config *docker.ServiceConfig, cpuPercent, memoryPercent float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// A new ID under a known name means the service was recreated, so the
+	// state of the old one is dropped
+	if old, ok := a.serviceIDs[config.Name]; ok && old != config.ID {
+		delete(a.states, old)
+		delete(a.snapshot, old)
+	}
+	a.serviceIDs[config.Name] = config.ID
+
+	st := a.state(config.ID)
+	// After a restart, cooldowns count from the scale action recorded in
+	// the service labels
+	if st.lastScaled.IsZero() {
+		st.lastScaled = config.LastScaledAt
+	}
+	st.cpuPercent = cpuPercent
+	st.memoryPercent = memoryPercent
+	st.sampled = true
+	if config.MaxReplicas == 0 || int(config.CurrentReplicas) < config.MaxReplicas {
+		st.saturated = false
+	}
+}
+
+// saturate marks a service as saturated at its maximum and reports whether
+// it just became so
+func (a *Autoscaler) saturate(serviceID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := a.state(serviceID)
+	if st.saturated {
+		return false
+	}
+	st.saturated = true
+	return true
+}
+
+// forgetService drops the state of a removed service
+func (a *Autoscaler) forgetService(serviceID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.states, serviceID)
+	delete(a.snapshot, serviceID)
+	for name, id := range a.serviceIDs {
+		if id == serviceID {
+			delete(a.serviceIDs, name)
+		}
+	}
+	for key := range a.events {
+		if strings.HasPrefix(key, serviceID+"/") {
+			delete(a.events, key)
+		}
+	}
+}
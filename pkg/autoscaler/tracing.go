@@ -0,0 +1,36 @@
+package autoscaler
+
+import (
+	"github.com/dxas90/scalebee/pkg/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of reconcile runs. Spans are only recorded once
+// a tracer provider is installed with otel.SetTracerProvider.
+var tracer = otel.Tracer("github.com/dxas90/scalebee/pkg/autoscaler")
+
+// traceEvent adds a published event to the current span, so a trace shows
+// what the run decided
+func traceEvent(span trace.Span, event events.Event) {
+	if !span.IsRecording() {
+		return
+	}
+	attrs := []attribute.KeyValue{attribute.String("message", event.Message)}
+	if event.Service != "" {
+		attrs = append(attrs, attribute.String("service", event.Service))
+	}
+	if event.Reason != "" {
+		attrs = append(attrs, attribute.String("reason", event.Reason))
+	}
+	if event.Direction != "" {
+		attrs = append(attrs, attribute.String("direction", event.Direction),
+			attribute.Int("from_replicas", event.FromReplicas), attribute.Int("to_replicas", event.ToReplicas))
+	}
+	span.AddEvent(event.Type, trace.WithAttributes(attrs...))
+	if event.Type == events.TypeError {
+		span.SetStatus(codes.Error, event.Error)
+	}
+}
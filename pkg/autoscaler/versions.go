@@ -0,0 +1,201 @@
+package autoscaler
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// exporterVersion is the version a running exporter task reports
+type exporterVersion struct {
+	service string
+	node    string
+	version string
+}
+
+// checkVersionSkew compares the image versions of all exporter tasks
+// (services labelled swarm.autoscaler.exporter=true) with the newest version
+// of their image repository. Skew is exported and notified when it appears;
+// with ExporterAutoUpdate, exporter services on an older release are updated
+// to the newest release of their repository. Tags that aren't versions, such
+// as "latest", are never newer than any other and never update targets.
+func (a *Autoscaler) checkVersionSkew(ctx context.Context) {
+	exporters, err := a.serviceManager.ListExporters(ctx)
+	if err != nil {
+		a.log.WarnContext(ctx, "Failed to check exporter versions", "error", err)
+		return
+	}
+
+	var versions []exporterVersion
+	// The newest version and the newest release of each repository
+	newest := make(map[string]string)
+	releases := make(map[string]string)
+	consider := func(image string) {
+		repository, version := docker.ImageRepository(image), docker.ImageVersion(image)
+		v, ok := parseVersion(version)
+		if !ok {
+			return
+		}
+		if current, ok := parseVersion(newest[repository]); !ok || v.compare(current) > 0 {
+			newest[repository] = version
+		}
+		if current, ok := parseVersion(releases[repository]); v.pre == nil && (!ok || v.compare(current) > 0) {
+			releases[repository] = version
+		}
+	}
+	for _, e := range exporters {
+		for _, t := range e.Tasks {
+			versions = append(versions, exporterVersion{service: e.Name, node: t.Node, version: docker.ImageVersion(t.Image)})
+			consider(t.Image)
+		}
+		// A service spec can be ahead of its tasks during a rollout
+		if e.Image != "" {
+			consider(e.Image)
+		}
+	}
+
+	skewed := 0
+	for _, e := range exporters {
+		for _, t := range e.Tasks {
+			if version, ok := newest[docker.ImageRepository(t.Image)]; ok && docker.ImageVersion(t.Image) != version {
+				skewed++
+			}
+		}
+	}
+
+	a.mu.Lock()
+	previous := a.versionSkew
+	a.exporterVersions = versions
+	a.versionSkew = skewed
+	a.mu.Unlock()
+
+	if skewed > 0 && previous == 0 {
+		a.log.WarnContext(ctx, "Exporter version skew", "tasks", skewed, "newest", newest)
+		a.notify(ctx, "", false, "Exporter version skew: %d task(s) not running the newest version of their image", skewed)
+	}
+
+	if !a.config.ExporterAutoUpdate {
+		return
+	}
+	for _, e := range exporters {
+		repository := docker.ImageRepository(e.Image)
+		target, ok := releases[repository]
+		if e.Image == "" || !ok {
+			continue
+		}
+		// Services on a tag that isn't a version are pinned by their operator
+		current, ok := parseVersion(docker.ImageVersion(e.Image))
+		if next, _ := parseVersion(target); !ok || next.compare(current) <= 0 {
+			continue
+		}
+
+		image := repository + ":" + target
+		a.log.InfoContext(ctx, "Updating exporter service", "service", e.Name, "from", e.Image, "to", image)
+		if err := a.serviceManager.UpdateServiceImage(ctx, e.ID, image); err != nil {
+			a.log.ErrorContext(ctx, "Failed to update exporter service", "service", e.Name, "error", err)
+			a.fireError(ctx, e.Name, err)
+			continue
+		}
+		a.notify(ctx, e.Name, false, "Updated exporter service %s to %s", e.Name, image)
+	}
+}
+
+// version is a semantic version parsed from an image tag
+type version struct {
+	core [3]int
+	pre  []string
+}
+
+// parseVersion parses a tag such as "v1.2.3" or "1.2.0-rc.1" as a semantic
+// version; missing minor and patch numbers are zero and build metadata is
+// ignored. It reports false for tags that aren't versions, e.g. "latest".
+func parseVersion(tag string) (version, bool) {
+	tag, _, _ = strings.Cut(strings.TrimPrefix(tag, "v"), "+")
+	core, pre, hasPre := strings.Cut(tag, "-")
+
+	var v version
+	parts := strings.Split(core, ".")
+	if len(parts) > len(v.core) {
+		return version{}, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return version{}, false
+		}
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// compare orders versions by semantic versioning precedence: a pre-release
+// precedes its release, and pre-release identifiers compare numerically
+// when both are numbers, with numbers preceding other identifiers.
+func (v version) compare(o version) int {
+	if c := slices.Compare(v.core[:], o.core[:]); c != 0 {
+		return c
+	}
+	switch {
+	case v.pre == nil && o.pre == nil:
+		return 0
+	case v.pre == nil:
+		return 1
+	case o.pre == nil:
+		return -1
+	}
+
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		na, errA := strconv.Atoi(v.pre[i])
+		nb, errB := strconv.Atoi(o.pre[i])
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(na, nb)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(v.pre[i], o.pre[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.pre), len(o.pre))
+}
+
+var (
+	exporterVersionDesc = prom.NewDesc("scalebee_exporter_version",
+		"Image version of each running exporter task", []string{"service", "node", "version"}, nil)
+	versionSkewDesc = prom.NewDesc("scalebee_exporter_version_skew",
+		"Exporter tasks not running the newest version", nil, nil)
+)
+
+// collectVersionMetrics sends the exporter versions. Callers must hold a.mu.
+func (a *Autoscaler) collectVersionMetrics(ch chan<- prom.Metric) {
+	if !a.config.ExporterVersionCheck {
+		return
+	}
+
+	// Several tasks of a service can run the same version on one node
+	seen := make(map[exporterVersion]bool)
+	for _, v := range a.exporterVersions {
+		if !seen[v] {
+			seen[v] = true
+			ch <- prom.MustNewConstMetric(exporterVersionDesc, prom.GaugeValue, 1, v.service, v.node, v.version)
+		}
+	}
+	ch <- prom.MustNewConstMetric(versionSkewDesc, prom.GaugeValue, float64(a.versionSkew))
+}
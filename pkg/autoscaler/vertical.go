@@ -0,0 +1,112 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/events"
+)
+
+// VerticalStepPercent is the default resource change per vertical scale action
+const VerticalStepPercent = 25.0
+
+// scaleVertical grows or shrinks the CPU and/or memory limits of a service
+// within its vertical bounds. Reservations are scaled by the same factor and
+// never exceed the new limit. It returns false when nothing could change.
+func (a *Autoscaler) scaleVertical(ctx context.Context, config *docker.ServiceConfig, direction, reason string, cpu, memory bool) (bool, error) {
+	cooldown := config.CooldownUp
+	if direction == DirectionDown {
+		cooldown = config.CooldownDown
+	}
+	if cooling, remaining := a.inCooldown(config.ID, cooldown); cooling {
+		a.log.InfoContext(ctx, "Service is in cooldown", "service", config.Name, "direction", direction, "remaining", remaining.Round(time.Second))
+		a.skip(ctx, config.Name, SkipCooldown, "vertical scale-%s cooldown, %v remaining", direction, remaining.Round(time.Second))
+		return false, nil
+	}
+
+	factor := 1 + a.config.VerticalStepPercent/100
+	if direction == DirectionDown {
+		factor = 1 / factor
+	}
+
+	current := config.Resources
+	res := current
+	bounds := config.VerticalBounds
+	if cpu {
+		res.CPULimit, res.CPUReservation = resize(current.CPULimit, current.CPUReservation, factor, bounds.CPUMin, bounds.CPUMax)
+	}
+	if memory {
+		res.MemoryLimit, res.MemoryReservation = resize(current.MemoryLimit, current.MemoryReservation, factor, bounds.MemoryMin, bounds.MemoryMax)
+	}
+
+	if res == current {
+		a.log.InfoContext(ctx, "Service cannot be scaled vertically, limits unset or at their bounds", "service", config.Name, "direction", direction)
+		a.skip(ctx, config.Name, SkipVerticalBounds, "resource limits unset or at their vertical bounds")
+		return false, nil
+	}
+
+	a.log.InfoContext(ctx, "Scaling service vertically", "service", config.Name, "direction", direction,
+		"cpu_from", formatCPUs(current.CPULimit), "cpu_to", formatCPUs(res.CPULimit),
+		"memory_from", formatMemory(current.MemoryLimit), "memory_to", formatMemory(res.MemoryLimit))
+
+	if err := a.serviceManager.UpdateServiceResources(ctx, config.ID, res, "vertical_"+reason); err != nil {
+		return false, err
+	}
+
+	a.recordScaled(config.ID, direction)
+	a.recordEvent(config, direction, "vertical_"+reason)
+	a.fireAction(ctx, Action{Service: config.Name, Direction: direction, Reason: reason, Vertical: true})
+	a.publish(ctx, events.Event{Type: events.TypeScaled, Service: config.Name,
+		Message: fmt.Sprintf("Scaled service %s vertically %s: CPU limit %s -> %s, memory limit %s -> %s",
+			config.Name, direction, formatCPUs(current.CPULimit), formatCPUs(res.CPULimit),
+			formatMemory(current.MemoryLimit), formatMemory(res.MemoryLimit)),
+		Direction: direction, Reason: "vertical_" + reason, Vertical: true})
+	return true, nil
+}
+
+// resize scales a limit by factor within [min, max] and scales the
+// reservation proportionally. Unset limits (0) are left untouched.
+func resize(limit, reservation int64, factor float64, min, max int64) (int64, int64) {
+	if limit == 0 {
+		return limit, reservation
+	}
+
+	newLimit := int64(float64(limit) * factor)
+	if min > 0 && newLimit < min {
+		newLimit = min
+	}
+	if max > 0 && newLimit > max {
+		newLimit = max
+	}
+	if newLimit == limit {
+		return limit, reservation
+	}
+
+	newReservation := reservation
+	if reservation > 0 {
+		newReservation = int64(float64(reservation) * float64(newLimit) / float64(limit))
+		if newReservation > newLimit {
+			newReservation = newLimit
+		}
+	}
+
+	return newLimit, newReservation
+}
+
+// formatCPUs formats nano CPUs for logs
+func formatCPUs(nanoCPUs int64) string {
+	if nanoCPUs == 0 {
+		return "unset"
+	}
+	return fmt.Sprintf("%.2f", float64(nanoCPUs)/1e9)
+}
+
+// formatMemory formats bytes as megabytes for logs
+func formatMemory(bytes int64) string {
+	if bytes == 0 {
+		return "unset"
+	}
+	return fmt.Sprintf("%dMB", bytes/1024/1024)
+}
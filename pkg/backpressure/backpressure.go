@@ -0,0 +1,85 @@
+package backpressure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Signal actions
+const (
+	// ActionEngage asks the gateway to rate limit or shed load
+	ActionEngage = "engage"
+	// ActionRelease asks the gateway to undo an earlier engage
+	ActionRelease = "release"
+)
+
+// Signal describes the pressure on a service that can't scale any further
+type Signal struct {
+	Service       string    `json:"service"`
+	Action        string    `json:"action"`
+	Reason        string    `json:"reason,omitempty"`
+	Replicas      uint64    `json:"replicas"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryPercent float64   `json:"memory_percent"`
+	Cluster       string    `json:"cluster,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// Gateway applies backpressure upstream of a service, e.g. by enabling a
+// rate limit on the reverse proxy in front of it
+type Gateway interface {
+	Signal(ctx context.Context, signal Signal) error
+}
+
+// WebhookGateway posts signals as JSON to an HTTP endpoint, usually a small
+// adapter for the gateway's API (Traefik, Nginx Plus, ...)
+type WebhookGateway struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhookGateway creates a gateway that posts to the given URL. The token
+// is sent as a bearer token when set.
+func NewWebhookGateway(url, token string) *WebhookGateway {
+	return &WebhookGateway{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Signal sends the signal to the webhook
+func (g *WebhookGateway) Signal(ctx context.Context, signal Signal) error {
+	body, err := json.Marshal(signal)
+	if err != nil {
+		return fmt.Errorf("failed to encode backpressure signal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send backpressure signal: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("backpressure webhook returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
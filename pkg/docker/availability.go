@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// NodeAvailability describes the nodes that can't run tasks, because they
+// are drained, paused or down, and the services affected by them
+type NodeAvailability struct {
+	// Unavailable is the number of nodes that can't take new tasks
+	Unavailable int
+	// Rescheduling counts, per service ID, the tasks on drained or down
+	// nodes that are meant to run or were shut down since the given time.
+	// Swarm moves them to other nodes, so the service runs fewer tasks until
+	// they started. Tasks on paused nodes keep running.
+	Rescheduling map[string]int
+}
+
+// NodeAvailability checks the availability of the swarm nodes. Tasks are
+// only listed when a node is drained or down.
+func (sm *ServiceManager) NodeAvailability(ctx context.Context, since time.Time) (NodeAvailability, error) {
+	availability := NodeAvailability{Rescheduling: make(map[string]int)}
+
+	nodes, err := sm.client.NodeList(ctx, swarm.NodeListOptions{})
+	if err != nil {
+		return availability, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	evicting := make(map[string]bool)
+	for _, node := range nodes {
+		if node.Spec.Availability != swarm.NodeAvailabilityActive || node.Status.State != swarm.NodeStateReady {
+			availability.Unavailable++
+		}
+		if node.Spec.Availability == swarm.NodeAvailabilityDrain || node.Status.State == swarm.NodeStateDown {
+			evicting[node.ID] = true
+		}
+	}
+	if len(evicting) == 0 {
+		return availability, nil
+	}
+
+	tasks, err := sm.client.TaskList(ctx, swarm.TaskListOptions{})
+	if err != nil {
+		return availability, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	for _, t := range tasks {
+		if !evicting[t.NodeID] {
+			continue
+		}
+		if t.DesiredState == swarm.TaskStateRunning || t.Status.Timestamp.After(since) {
+			availability.Rescheduling[t.ServiceID]++
+		}
+	}
+	return availability, nil
+}
@@ -0,0 +1,60 @@
+package docker
+
+import "time"
+
+// cachedConfig is a service configuration kept until it expires
+type cachedConfig struct {
+	config  ServiceConfig
+	expires time.Time
+}
+
+// cachedConfig returns a copy of the unexpired configuration of a service,
+// so callers may adjust it
+func (sm *ServiceManager) cachedConfig(serviceName string) (*ServiceConfig, bool) {
+	if sm.options.ConfigCacheTTL <= 0 {
+		return nil, false
+	}
+
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+
+	entry, ok := sm.configs[serviceName]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	config := entry.config
+	return &config, true
+}
+
+// storeConfigs caches service configurations and drops expired ones
+func (sm *ServiceManager) storeConfigs(configs ...*ServiceConfig) {
+	if sm.options.ConfigCacheTTL <= 0 {
+		return
+	}
+
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+
+	now := time.Now()
+	for name, entry := range sm.configs {
+		if now.After(entry.expires) {
+			delete(sm.configs, name)
+		}
+	}
+	for _, config := range configs {
+		sm.configs[config.Name] = cachedConfig{config: *config, expires: now.Add(sm.options.ConfigCacheTTL)}
+	}
+}
+
+// InvalidateService drops the cached configuration of a service, by name or
+// ID, e.g. when an event reports a change
+func (sm *ServiceManager) InvalidateService(service string) {
+	sm.cacheMu.Lock()
+	defer sm.cacheMu.Unlock()
+
+	for name, entry := range sm.configs {
+		if name == service || entry.config.ID == service {
+			delete(sm.configs, name)
+		}
+	}
+}
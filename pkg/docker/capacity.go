@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// ClusterCapacity holds the resources of the schedulable (active, ready)
+// nodes and how much of them the tasks that should run reserve, in total
+// and per node
+type ClusterCapacity struct {
+	NanoCPUs            int64
+	MemoryBytes         int64
+	ReservedNanoCPUs    int64
+	ReservedMemoryBytes int64
+	Nodes               []NodeCapacity
+}
+
+// NodeCapacity holds the resources of a schedulable node and the
+// reservations of the tasks assigned to it
+type NodeCapacity struct {
+	Hostname            string
+	NanoCPUs            int64
+	MemoryBytes         int64
+	ReservedNanoCPUs    int64
+	ReservedMemoryBytes int64
+}
+
+// Reserve adds the reservations of more replicas of a service to the
+// totals, for decisions taken before Swarm schedules them
+func (c *ClusterCapacity) Reserve(res Resources, replicas int) {
+	c.ReservedNanoCPUs += res.CPUReservation * int64(replicas)
+	c.ReservedMemoryBytes += res.MemoryReservation * int64(replicas)
+}
+
+// FreeReplicas returns how many replicas with the given reservations still
+// fit into the cluster, or -1 when the service reserves nothing. Capacity
+// is summed over all nodes, so fragmentation can still leave a replica
+// pending.
+func (c ClusterCapacity) FreeReplicas(res Resources) int {
+	if res.CPUReservation <= 0 && res.MemoryReservation <= 0 {
+		return -1
+	}
+
+	free := -1
+	if res.CPUReservation > 0 {
+		free = int(max(c.NanoCPUs-c.ReservedNanoCPUs, 0) / res.CPUReservation)
+	}
+	if res.MemoryReservation > 0 {
+		n := int(max(c.MemoryBytes-c.ReservedMemoryBytes, 0) / res.MemoryReservation)
+		if free < 0 || n < free {
+			free = n
+		}
+	}
+	return free
+}
+
+// ClusterCapacity reads the capacity of the cluster. It requires a manager.
+func (sm *ServiceManager) ClusterCapacity(ctx context.Context) (ClusterCapacity, error) {
+	return ReadClusterCapacity(ctx, sm.client)
+}
+
+// ReadClusterCapacity sums the resources of the schedulable nodes and the
+// reservations of all tasks that should be running, including pending ones
+// and tasks on nodes that are going away. It requires a manager.
+func ReadClusterCapacity(ctx context.Context, c *client.Client) (ClusterCapacity, error) {
+	var capacity ClusterCapacity
+
+	nodes, err := c.NodeList(ctx, swarm.NodeListOptions{})
+	if err != nil {
+		return capacity, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	tasks, err := c.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("desired-state", "running")),
+	})
+	if err != nil {
+		return capacity, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	reservedCPU := make(map[string]int64)
+	reservedMemory := make(map[string]int64)
+	for _, t := range tasks {
+		if r := t.Spec.Resources; r != nil && r.Reservations != nil {
+			capacity.ReservedNanoCPUs += r.Reservations.NanoCPUs
+			capacity.ReservedMemoryBytes += r.Reservations.MemoryBytes
+			reservedCPU[t.NodeID] += r.Reservations.NanoCPUs
+			reservedMemory[t.NodeID] += r.Reservations.MemoryBytes
+		}
+	}
+
+	for _, node := range nodes {
+		if node.Spec.Availability != swarm.NodeAvailabilityActive || node.Status.State != swarm.NodeStateReady {
+			continue
+		}
+		resources := node.Description.Resources
+		capacity.NanoCPUs += resources.NanoCPUs
+		capacity.MemoryBytes += resources.MemoryBytes
+		capacity.Nodes = append(capacity.Nodes, NodeCapacity{
+			Hostname:            node.Description.Hostname,
+			NanoCPUs:            resources.NanoCPUs,
+			MemoryBytes:         resources.MemoryBytes,
+			ReservedNanoCPUs:    reservedCPU[node.ID],
+			ReservedMemoryBytes: reservedMemory[node.ID],
+		})
+	}
+
+	return capacity, nil
+}
@@ -0,0 +1,168 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/dxas90/scalebee/pkg/instrument"
+)
+
+// Connection selects and secures the Docker endpoint. Unset fields fall
+// back to the DOCKER_HOST, DOCKER_CERT_PATH and DOCKER_TLS_VERIFY variables.
+type Connection struct {
+	// Host is the Docker endpoint, e.g. unix:///var/run/docker.sock,
+	// tcp://manager:2376 or ssh://user@manager
+	Host string
+	// CAFile, CertFile and KeyFile configure mutual TLS for tcp:// hosts
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// NewClient creates a Docker client for a connection. ssh:// hosts run
+// "docker system dial-stdio" on the remote host through the ssh binary, as
+// the Docker CLI does, so keys and known hosts come from the SSH setup.
+func NewClient(conn Connection) (*client.Client, error) {
+	opts := []client.Opt{
+		client.WithTLSClientConfigFromEnv(),
+		client.WithVersionFromEnv(),
+		client.WithAPIVersionNegotiation(),
+	}
+
+	host := conn.Host
+	if host == "" {
+		host = os.Getenv(client.EnvOverrideHost)
+	}
+	if u, err := url.Parse(host); err == nil && u.Scheme == "ssh" {
+		// The host is only used in request URLs, the dialer picks the
+		// connection
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(sshDialer(u)))
+	} else if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+
+	if conn.CAFile != "" || conn.CertFile != "" || conn.KeyFile != "" {
+		if (conn.CertFile == "") != (conn.KeyFile == "") {
+			return nil, fmt.Errorf("docker TLS needs both a certificate and a key file")
+		}
+		opts = append(opts, client.WithTLSClientConfig(conn.CAFile, conn.CertFile, conn.KeyFile))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	// Requests are measured on top of the client's transport. The option is
+	// applied to the finished client, which keeps the base transport it
+	// found for TLS and idle connections.
+	httpClient := cli.HTTPClient()
+	httpClient.Transport = instrument.Transport(instrument.Docker, endpointName(host), operation, httpClient.Transport)
+	if err := client.WithHTTPClient(httpClient)(cli); err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	return cli, nil
+}
+
+// endpointName names a Docker endpoint in metrics, without credentials
+func endpointName(host string) string {
+	if host == "" {
+		return client.DefaultDockerHost
+	}
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return host
+}
+
+// apiVersionPrefix matches the API version at the start of request paths
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// operation names a Docker API request by its method and route, with the
+// object ID replaced, e.g. "POST /services/{id}/update"
+func operation(req *http.Request) string {
+	path := apiVersionPrefix.ReplaceAllString(req.URL.Path, "/")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > 1 {
+		switch segments[1] {
+		case "json", "create", "prune":
+		default:
+			segments[1] = "{id}"
+		}
+	}
+	return req.Method + " /" + strings.Join(segments, "/")
+}
+
+// sshDialer returns a dialer that connects to the Docker daemon of an
+// ssh:// host
+func sshDialer(u *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// The command outlives the dial, so it isn't bound to ctx
+		cmd := exec.Command("ssh", args...)
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run ssh to %s: %w", u.Hostname(), err)
+		}
+		return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, host: u.Hostname()}, nil
+	}
+}
+
+// commandConn is a connection over the standard input and output of a
+// command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	host   string
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// Close ends the command
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	c.stdout.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr              { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr             { return commandAddr(c.host) }
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+// commandAddr is the address of a command connection
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
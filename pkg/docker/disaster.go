@@ -0,0 +1,28 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// DisasterLabel is the node label that activates disaster mode while any
+// node carries it with the value "true"
+const DisasterLabel = LabelPrefix + ".disaster"
+
+// DisasterSignal reports whether a node is labelled for disaster mode and
+// returns the hostname of the first one
+func (sm *ServiceManager) DisasterSignal(ctx context.Context) (string, bool, error) {
+	nodes, err := sm.client.NodeList(ctx, swarm.NodeListOptions{
+		Filters: filters.NewArgs(filters.Arg("node.label", DisasterLabel+"=true")),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		return "", false, nil
+	}
+	return nodes[0].Description.Hostname, true, nil
+}
@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Service event actions
+const (
+	ServiceCreated = "create"
+	ServiceUpdated = "update"
+	ServiceRemoved = "remove"
+	// TaskFailed is a task container that exited with a non-zero code
+	TaskFailed = "task_failed"
+)
+
+// ServiceEvent is a change of a Swarm service or a failure of one of its tasks
+type ServiceEvent struct {
+	Action      string
+	ServiceID   string
+	ServiceName string
+	// ReplicasOnly is set for updates that only changed the replica count,
+	// e.g. scaling actions
+	ReplicasOnly bool
+}
+
+// WatchOOMKills calls handler with the service name of every Swarm task
+// container killed by the kernel OOM killer, until the context is cancelled.
+// Docker events are local to the daemon, so only containers on the node
+// ScaleBee is connected to are seen.
+func (sm *ServiceManager) WatchOOMKills(ctx context.Context, handler func(serviceName, containerID string)) {
+	eventFilters := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("event", string(events.ActionOOM)),
+	)
+
+	sm.watchEvents(ctx, eventFilters, func(msg events.Message) {
+		serviceName := msg.Actor.Attributes["com.docker.swarm.service.name"]
+		if serviceName == "" {
+			return
+		}
+		handler(serviceName, msg.Actor.ID)
+	})
+}
+
+// WatchServiceEvents calls handler for every created, updated or removed
+// service and every failed task, until the context is cancelled. Service
+// events are reported by every manager; task failures, like all container
+// events, only for containers on the node ScaleBee is connected to. It
+// returns once no handler runs anymore.
+func (sm *ServiceManager) WatchServiceEvents(ctx context.Context, handler func(ServiceEvent)) {
+	taskFilters := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("event", string(events.ActionDie)),
+	)
+	var tasks sync.WaitGroup
+	defer tasks.Wait()
+	tasks.Add(1)
+	go func() {
+		defer tasks.Done()
+		sm.watchEvents(ctx, taskFilters, func(msg events.Message) {
+			attrs := msg.Actor.Attributes
+			if attrs["com.docker.swarm.service.name"] == "" || attrs["exitCode"] == "0" {
+				return
+			}
+			handler(ServiceEvent{
+				Action:      TaskFailed,
+				ServiceID:   attrs["com.docker.swarm.service.id"],
+				ServiceName: attrs["com.docker.swarm.service.name"],
+			})
+		})
+	}()
+
+	serviceFilters := filters.NewArgs(
+		filters.Arg("type", string(events.ServiceEventType)),
+		filters.Arg("event", string(events.ActionCreate)),
+		filters.Arg("event", string(events.ActionUpdate)),
+		filters.Arg("event", string(events.ActionRemove)),
+	)
+	sm.watchEvents(ctx, serviceFilters, func(msg events.Message) {
+		attrs := msg.Actor.Attributes
+		// Updates report the old and new replicas, image and update state
+		// when they change
+		_, replicas := attrs["replicas.new"]
+		_, image := attrs["image.new"]
+		_, updateState := attrs["updatestate.new"]
+		handler(ServiceEvent{
+			Action:       string(msg.Action),
+			ServiceID:    msg.Actor.ID,
+			ServiceName:  attrs["name"],
+			ReplicasOnly: replicas && !image && !updateState,
+		})
+	})
+}
+
+// watchEvents calls handler for every event matching the filters, and
+// reconnects when the stream breaks, until the context is cancelled
+func (sm *ServiceManager) watchEvents(ctx context.Context, eventFilters filters.Args, handler func(events.Message)) {
+	for {
+		messages, errs := sm.client.Events(ctx, events.ListOptions{Filters: eventFilters})
+
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-messages:
+				handler(msg)
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("Docker events stream failed, reconnecting", "error", err)
+				break stream
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
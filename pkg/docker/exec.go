@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ExecInServiceTasks starts cmd detached in every running task container of
+// a service and returns how many containers it was started in. Exec goes
+// through the local daemon, so only tasks on the node ScaleBee is connected
+// to are reached.
+func (sm *ServiceManager) ExecInServiceTasks(ctx context.Context, serviceName string, cmd []string) (int, error) {
+	containers, err := sm.client.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "com.docker.swarm.service.name="+serviceName)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list containers of service %s: %w", serviceName, err)
+	}
+
+	started := 0
+	for _, ctr := range containers {
+		exec, err := sm.client.ContainerExecCreate(ctx, ctr.ID, container.ExecOptions{Cmd: cmd, Detach: true})
+		if err != nil {
+			return started, fmt.Errorf("failed to create exec in container %s: %w", ctr.ID[:12], err)
+		}
+		if err := sm.client.ContainerExecStart(ctx, exec.ID, container.ExecStartOptions{Detach: true}); err != nil {
+			return started, fmt.Errorf("failed to start exec in container %s: %w", ctr.ID[:12], err)
+		}
+		started++
+	}
+
+	return started, nil
+}
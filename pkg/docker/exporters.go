@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ExporterLabel marks the services running ScaleBee exporters whose
+// versions are kept consistent
+const ExporterLabel = LabelPrefix + ".exporter"
+
+// ExporterService is a service running ScaleBee exporters
+type ExporterService struct {
+	ID    string
+	Name  string
+	Image string
+	Tasks []ExporterTask
+}
+
+// ExporterTask is a running exporter task
+type ExporterTask struct {
+	Node  string
+	Image string
+}
+
+// ListExporters returns the services labelled swarm.autoscaler.exporter=true
+// with the images of their running tasks
+func (sm *ServiceManager) ListExporters(ctx context.Context) ([]ExporterService, error) {
+	services, err := sm.client.ServiceList(ctx, swarm.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", ExporterLabel+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exporter services: %w", err)
+	}
+	if len(services) == 0 {
+		return nil, nil
+	}
+
+	nodes, err := sm.client.NodeList(ctx, swarm.NodeListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	hostnames := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		hostnames[n.ID] = n.Description.Hostname
+	}
+
+	exporters := make([]ExporterService, 0, len(services))
+	for _, s := range services {
+		tasks, err := sm.client.TaskList(ctx, swarm.TaskListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("service", s.ID),
+				filters.Arg("desired-state", "running"),
+			),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks of service %s: %w", s.Spec.Name, err)
+		}
+
+		exporter := ExporterService{ID: s.ID, Name: s.Spec.Name}
+		if s.Spec.TaskTemplate.ContainerSpec != nil {
+			exporter.Image = s.Spec.TaskTemplate.ContainerSpec.Image
+		}
+		for _, t := range tasks {
+			if t.Status.State != swarm.TaskStateRunning || t.Spec.ContainerSpec == nil {
+				continue
+			}
+			exporter.Tasks = append(exporter.Tasks, ExporterTask{
+				Node:  hostnames[t.NodeID],
+				Image: t.Spec.ContainerSpec.Image,
+			})
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	return exporters, nil
+}
+
+// UpdateServiceImage rolls a service to a new image
+func (sm *ServiceManager) UpdateServiceImage(ctx context.Context, serviceID, image string) error {
+	defer sm.InvalidateService(serviceID)
+
+	return sm.updateService(ctx, serviceID, func(service *swarm.Service) error {
+		if service.Spec.TaskTemplate.ContainerSpec == nil {
+			return fmt.Errorf("service %s has no container spec", service.Spec.Name)
+		}
+		service.Spec.TaskTemplate.ContainerSpec.Image = image
+		return nil
+	})
+}
+
+// ImageVersion returns the tag of an image reference, without its digest
+// ("latest" when untagged)
+func ImageVersion(image string) string {
+	if _, tag, ok := splitImage(image); ok {
+		return tag
+	}
+	return "latest"
+}
+
+// ImageRepository returns an image reference without its tag and digest
+func ImageRepository(image string) string {
+	repository, _, _ := splitImage(image)
+	return repository
+}
+
+// splitImage splits an image reference into its repository and tag,
+// dropping the digest
+func splitImage(image string) (repository, tag string, tagged bool) {
+	image, _, _ = strings.Cut(image, "@")
+	// A colon before the last slash belongs to a registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:], true
+	}
+	return image, "", false
+}
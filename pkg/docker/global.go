@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// GlobalNodes returns the hostnames of the nodes labelled with label=true,
+// and of the active, ready nodes that could be labelled, both sorted
+func (sm *ServiceManager) GlobalNodes(ctx context.Context, label string) (labelled, eligible []string, err error) {
+	nodes, err := sm.client.NodeList(ctx, swarm.NodeListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	for _, node := range nodes {
+		name := node.Description.Hostname
+		if node.Spec.Labels[label] == "true" {
+			labelled = append(labelled, name)
+		}
+		if node.Spec.Availability == swarm.NodeAvailabilityActive && node.Status.State == swarm.NodeStateReady {
+			eligible = append(eligible, name)
+		}
+	}
+	sort.Strings(labelled)
+	sort.Strings(eligible)
+	return labelled, eligible, nil
+}
+
+// SetNodeLabel sets label=true on a node, or removes the label
+func (sm *ServiceManager) SetNodeLabel(ctx context.Context, hostname, label string, set bool) error {
+	node, _, err := sm.client.NodeInspectWithRaw(ctx, hostname)
+	if err != nil {
+		return fmt.Errorf("failed to inspect node %s: %w", hostname, err)
+	}
+
+	spec := node.Spec
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	if set {
+		spec.Labels[label] = "true"
+	} else {
+		delete(spec.Labels, label)
+	}
+
+	if err := sm.client.NodeUpdate(ctx, node.ID, node.Version, spec); err != nil {
+		return fmt.Errorf("failed to update labels of node %s: %w", hostname, err)
+	}
+	return nil
+}
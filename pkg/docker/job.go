@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ScaleJob sets the concurrency and completions of a replicated-job service,
+// by ID. Swarm runs a job again whenever its spec changes, so this starts a
+// new run.
+func (sm *ServiceManager) ScaleJob(ctx context.Context, serviceID string, maxConcurrent, totalCompletions uint64, reason string) error {
+	defer sm.InvalidateService(serviceID)
+
+	return sm.updateService(ctx, serviceID, func(service *swarm.Service) error {
+		if service.Spec.Mode.ReplicatedJob == nil {
+			return fmt.Errorf("service %s is not a replicated job", service.Spec.Name)
+		}
+		service.Spec.Mode.ReplicatedJob.MaxConcurrent = &maxConcurrent
+		service.Spec.Mode.ReplicatedJob.TotalCompletions = &totalCompletions
+		sm.recordScale(service, reason)
+		return nil
+	})
+}
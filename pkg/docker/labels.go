@@ -0,0 +1,189 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LabelIssue is a problem found while validating autoscaler labels
+type LabelIssue struct {
+	Label   string `json:"label,omitempty"`
+	Message string `json:"message"`
+}
+
+// labelSchema maps every supported autoscaler label to its value validator
+var labelSchema = map[string]func(string) error{
+	LabelPrefix:                    validateBool,
+	LabelPrefix + ".minimum":       validateNonNegativeInt,
+	LabelPrefix + ".maximum":       validateNonNegativeInt,
+	LabelPrefix + ".maximum.soft":  validateNonNegativeInt,
+	LabelPrefix + ".step":          validateStep,
+	LabelPrefix + ".cooldown.up":   validateDuration,
+	LabelPrefix + ".cooldown.down": validateDuration,
+
+	LabelPrefix + ".mode":                validateMode,
+	LabelPrefix + ".vertical.cpu.min":    validateCPUs,
+	LabelPrefix + ".vertical.cpu.max":    validateCPUs,
+	LabelPrefix + ".vertical.memory.min": validateMemory,
+	LabelPrefix + ".vertical.memory.max": validateMemory,
+
+	LabelPrefix + ".app":        validateNonEmpty,
+	LabelPrefix + ".app.weight": validatePositiveNumber,
+
+	LabelPrefix + ".prometheus":        validateNonEmpty,
+	LabelPrefix + ".global.node_label": validateNonEmpty,
+
+	LabelPrefix + ".job.query":          validateNonEmpty,
+	LabelPrefix + ".job.items_per_task": validatePositiveNumber,
+
+	LastScaledAtLabel: validateTime,
+	LastReasonLabel:   validateNonEmpty,
+
+	ExporterLabel: validateBool,
+}
+
+// ValidateLabels checks autoscaler labels against the label schema and
+// checks that the replica bounds are consistent
+func ValidateLabels(labels map[string]string) []LabelIssue {
+	var issues []LabelIssue
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k != LabelPrefix && !strings.HasPrefix(k, LabelPrefix+".") {
+			continue
+		}
+
+		validate, ok := labelSchema[k]
+		if !ok {
+			issues = append(issues, LabelIssue{Label: k, Message: "unknown autoscaler label"})
+			continue
+		}
+		if err := validate(labels[k]); err != nil {
+			issues = append(issues, LabelIssue{Label: k, Message: err.Error()})
+		}
+	}
+
+	min, hasMin := intLabel(labels, LabelPrefix+".minimum")
+	max, hasMax := intLabel(labels, LabelPrefix+".maximum")
+	softMax, hasSoftMax := intLabel(labels, LabelPrefix+".maximum.soft")
+
+	if hasMin && hasMax && max > 0 && min > max {
+		issues = append(issues, LabelIssue{
+			Label:   LabelPrefix + ".minimum",
+			Message: fmt.Sprintf("minimum %d is greater than maximum %d", min, max),
+		})
+	}
+	if hasSoftMax && softMax > 0 {
+		if hasMin && softMax < min {
+			issues = append(issues, LabelIssue{
+				Label:   LabelPrefix + ".maximum.soft",
+				Message: fmt.Sprintf("soft maximum %d is lower than minimum %d", softMax, min),
+			})
+		}
+		if hasMax && max > 0 && softMax > max {
+			issues = append(issues, LabelIssue{
+				Label:   LabelPrefix + ".maximum.soft",
+				Message: fmt.Sprintf("soft maximum %d is greater than maximum %d", softMax, max),
+			})
+		}
+	}
+
+	return issues
+}
+
+// intLabel returns the integer value of a label if it is set and valid
+func intLabel(labels map[string]string, key string) (int, bool) {
+	val, ok := labels[key]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func validateBool(val string) error {
+	if val != "true" && val != "false" {
+		return fmt.Errorf("must be \"true\" or \"false\", got %q", val)
+	}
+	return nil
+}
+
+func validateNonNegativeInt(val string) error {
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return fmt.Errorf("must be a non-negative integer, got %q", val)
+	}
+	return nil
+}
+
+func validateNonEmpty(val string) error {
+	if strings.TrimSpace(val) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+func validatePositiveNumber(val string) error {
+	if n, err := strconv.ParseFloat(val, 64); err != nil || n <= 0 {
+		return fmt.Errorf("must be a positive number, got %q", val)
+	}
+	return nil
+}
+
+func validateStep(val string) error {
+	if pct, isPercent := strings.CutSuffix(val, "%"); isPercent {
+		if p, err := strconv.ParseFloat(pct, 64); err != nil || p <= 0 {
+			return fmt.Errorf("must be a positive percentage, got %q", val)
+		}
+		return nil
+	}
+	if n, err := strconv.Atoi(val); err != nil || n <= 0 {
+		return fmt.Errorf("must be a positive integer or percentage, got %q", val)
+	}
+	return nil
+}
+
+func validateDuration(val string) error {
+	if d, err := parseDuration(val); err != nil || d < 0 {
+		return fmt.Errorf("must be a duration such as \"30s\" or \"10m\", got %q", val)
+	}
+	return nil
+}
+
+func validateTime(val string) error {
+	if _, err := time.Parse(time.RFC3339, val); err != nil {
+		return fmt.Errorf("must be an RFC 3339 time such as \"2024-05-01T12:00:00Z\", got %q", val)
+	}
+	return nil
+}
+
+func validateMode(val string) error {
+	switch val {
+	case ModeHorizontal, ModeVertical, ModeBoth:
+		return nil
+	}
+	return fmt.Errorf("must be %q, %q, or %q, got %q", ModeHorizontal, ModeVertical, ModeBoth, val)
+}
+
+func validateCPUs(val string) error {
+	_, err := parseCPUs(val)
+	return err
+}
+
+func validateMemory(val string) error {
+	if _, err := parseMemory(val); err != nil {
+		return fmt.Errorf("must be a memory size such as \"512M\", got %q", val)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Labels ScaleBee writes to a service when it scales it, so the last action
+// shows in `docker service inspect` and survives restarts
+const (
+	LastScaledAtLabel = LabelPrefix + ".last-scaled-at"
+	LastReasonLabel   = LabelPrefix + ".last-reason"
+)
+
+// recordScale sets the scaling metadata labels on a service about to be
+// updated. Service labels don't reach the tasks, so this restarts nothing.
+func (sm *ServiceManager) recordScale(service *swarm.Service, reason string) {
+	if !sm.options.ScaleMetadataLabels || reason == "" {
+		return
+	}
+	if service.Spec.Labels == nil {
+		service.Spec.Labels = make(map[string]string)
+	}
+	service.Spec.Labels[LastScaledAtLabel] = time.Now().UTC().Format(time.RFC3339)
+	service.Spec.Labels[LastReasonLabel] = reason
+}
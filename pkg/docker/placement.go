@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// PlacementCapacity returns how many replicas of a service the scheduler can
+// place: its replicas per node times the active, ready nodes that satisfy its
+// placement constraints. limited is false for services without a per-node
+// limit.
+func (sm *ServiceManager) PlacementCapacity(ctx context.Context, config *ServiceConfig) (capacity int, limited bool, err error) {
+	if config.MaxReplicasPerNode == 0 {
+		return 0, false, nil
+	}
+
+	nodes, err := sm.client.NodeList(ctx, swarm.NodeListOptions{})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	eligible := 0
+	for _, node := range nodes {
+		if node.Spec.Availability == swarm.NodeAvailabilityActive && node.Status.State == swarm.NodeStateReady &&
+			matchConstraints(node, config.Constraints) {
+			eligible++
+		}
+	}
+	return eligible * int(config.MaxReplicasPerNode), true, nil
+}
+
+// matchConstraints reports whether a node satisfies all placement
+// constraints. Like Swarm, values are compared case-insensitively; unknown
+// attributes match, since Swarm rejects services using them.
+func matchConstraints(node swarm.Node, constraints []string) bool {
+	for _, constraint := range constraints {
+		key, value, equal := strings.Cut(constraint, "==")
+		if !equal {
+			var ok bool
+			if key, value, ok = strings.Cut(constraint, "!="); !ok {
+				continue
+			}
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		actual, known := nodeAttribute(node, key)
+		if known && strings.EqualFold(actual, value) != equal {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeAttribute returns the value of a constraint attribute of a node
+func nodeAttribute(node swarm.Node, key string) (string, bool) {
+	switch {
+	case key == "node.id":
+		return node.ID, true
+	case key == "node.hostname":
+		return node.Description.Hostname, true
+	case key == "node.role":
+		return string(node.Spec.Role), true
+	case key == "node.platform.os":
+		return node.Description.Platform.OS, true
+	case key == "node.platform.arch":
+		return node.Description.Platform.Architecture, true
+	case strings.HasPrefix(key, "node.labels."):
+		return node.Spec.Labels[strings.TrimPrefix(key, "node.labels.")], true
+	case strings.HasPrefix(key, "engine.labels."):
+		return node.Description.Engine.Labels[strings.TrimPrefix(key, "engine.labels.")], true
+	}
+	return "", false
+}
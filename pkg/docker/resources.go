@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-units"
+)
+
+// Scaling modes
+const (
+	ModeHorizontal = "horizontal"
+	ModeVertical   = "vertical"
+	ModeBoth       = "both"
+)
+
+// Resources holds the CPU and memory settings of a service's tasks.
+// CPU values are in nano CPUs, memory values in bytes; 0 means unset.
+type Resources struct {
+	CPULimit          int64
+	CPUReservation    int64
+	MemoryLimit       int64
+	MemoryReservation int64
+}
+
+// ResourceBounds holds the label-defined bounds for vertical scaling
+type ResourceBounds struct {
+	CPUMin    int64
+	CPUMax    int64
+	MemoryMin int64
+	MemoryMax int64
+}
+
+// serviceResources extracts the task resources from a service spec
+func serviceResources(spec swarm.ServiceSpec) Resources {
+	var res Resources
+	if r := spec.TaskTemplate.Resources; r != nil {
+		if r.Limits != nil {
+			res.CPULimit = r.Limits.NanoCPUs
+			res.MemoryLimit = r.Limits.MemoryBytes
+		}
+		if r.Reservations != nil {
+			res.CPUReservation = r.Reservations.NanoCPUs
+			res.MemoryReservation = r.Reservations.MemoryBytes
+		}
+	}
+	return res
+}
+
+// UpdateServiceResources patches the CPU/memory limits and reservations of
+// a service's task template, by ID, for the given reason. Swarm rolls the
+// tasks to apply the change.
+func (sm *ServiceManager) UpdateServiceResources(ctx context.Context, serviceID string, res Resources, reason string) error {
+	defer sm.InvalidateService(serviceID)
+
+	return sm.updateService(ctx, serviceID, func(service *swarm.Service) error {
+		spec := &service.Spec
+		if spec.TaskTemplate.Resources == nil {
+			spec.TaskTemplate.Resources = &swarm.ResourceRequirements{}
+		}
+		if spec.TaskTemplate.Resources.Limits == nil {
+			spec.TaskTemplate.Resources.Limits = &swarm.Limit{}
+		}
+		if spec.TaskTemplate.Resources.Reservations == nil {
+			spec.TaskTemplate.Resources.Reservations = &swarm.Resources{}
+		}
+
+		spec.TaskTemplate.Resources.Limits.NanoCPUs = res.CPULimit
+		spec.TaskTemplate.Resources.Limits.MemoryBytes = res.MemoryLimit
+		spec.TaskTemplate.Resources.Reservations.NanoCPUs = res.CPUReservation
+		spec.TaskTemplate.Resources.Reservations.MemoryBytes = res.MemoryReservation
+		sm.recordScale(service, reason)
+		return nil
+	})
+}
+
+// parseCPUs parses a CPU count such as "0.5" into nano CPUs
+func parseCPUs(val string) (int64, error) {
+	cpus, err := strconv.ParseFloat(val, 64)
+	if err != nil || cpus < 0 {
+		return 0, fmt.Errorf("invalid CPU value %q", val)
+	}
+	return int64(cpus * 1e9), nil
+}
+
+// parseMemory parses a memory size such as "512M" into bytes
+func parseMemory(val string) (int64, error) {
+	return units.RAMInBytes(val)
+}
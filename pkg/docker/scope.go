@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// StackLabel is the label Swarm sets on the services of a stack
+const StackLabel = "com.docker.stack.namespace"
+
+// ErrOutOfScope is returned for changes to services ScaleBee must not touch
+var ErrOutOfScope = errors.New("service is outside the scope of this instance")
+
+// NamePattern matches service names with a glob such as "db_*", or with a
+// regular expression written between slashes such as "/^(db|redis)_/"
+type NamePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// ParseNamePatterns parses a list of globs and /regular expressions/
+func ParseNamePatterns(patterns []string) ([]NamePattern, error) {
+	var parsed []NamePattern
+	for _, p := range patterns {
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid service name pattern %s: %w", p, err)
+			}
+			parsed = append(parsed, NamePattern{re: re})
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid service name pattern %s: %w", p, err)
+		}
+		parsed = append(parsed, NamePattern{glob: p})
+	}
+	return parsed, nil
+}
+
+// Match reports whether a service name matches the pattern
+func (p NamePattern) Match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// String returns the pattern as configured
+func (p NamePattern) String() string {
+	if p.re != nil {
+		return "/" + p.re.String() + "/"
+	}
+	return p.glob
+}
+
+// matchAny reports whether a name matches any of the patterns
+func matchAny(patterns []NamePattern, name string) bool {
+	return slices.ContainsFunc(patterns, func(p NamePattern) bool { return p.Match(name) })
+}
+
+// excluded reports whether a service name is denied by ExcludeServices
+func (sm *ServiceManager) excluded(name string) bool {
+	return matchAny(sm.options.ExcludeServices, name)
+}
+
+// InScope reports whether a service of the given name and stack would be in
+// the scope of this instance, e.g. for a stack file not deployed yet. An
+// empty stack skips the check of Stacks.
+func (sm *ServiceManager) InScope(name, stack string) bool {
+	return sm.nameInScope(name) && (stack == "" || sm.stackInScope(stack))
+}
+
+// inScope reports whether ScaleBee may manage a service: it must not match
+// ExcludeServices and, when set, must match IncludeServices and belong to one
+// of Stacks. Services outside the scope are never autoscaled nor changed.
+func (sm *ServiceManager) inScope(spec swarm.ServiceSpec) bool {
+	return sm.nameInScope(spec.Name) && sm.stackInScope(spec.Labels[StackLabel])
+}
+
+// nameInScope checks a service name against ExcludeServices and
+// IncludeServices
+func (sm *ServiceManager) nameInScope(name string) bool {
+	if sm.excluded(name) {
+		return false
+	}
+	return len(sm.options.IncludeServices) == 0 || matchAny(sm.options.IncludeServices, name)
+}
+
+// stackInScope checks a stack against Stacks
+func (sm *ServiceManager) stackInScope(stack string) bool {
+	return len(sm.options.Stacks) == 0 || slices.Contains(sm.options.Stacks, stack)
+}
@@ -3,35 +3,152 @@ package docker
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"math"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 )
 
+// LabelPrefix is the prefix shared by all autoscaler labels
+const LabelPrefix = "swarm.autoscaler"
+
+// Options configures optional ServiceManager behavior
+type Options struct {
+	// ContainerLabelFallback reads swarm.autoscaler.* labels from the task
+	// template's container labels when they are missing on the service spec
+	ContainerLabelFallback bool
+	// ConfigCacheTTL caches service configurations for this long, until
+	// ScaleBee changes the service or InvalidateService is called
+	ConfigCacheTTL time.Duration
+	// Stacks restricts autoscaling to the services of these stacks, so
+	// instances of different teams don't touch each other's services
+	Stacks []string
+	// IncludeServices and ExcludeServices restrict autoscaling by service
+	// name, independently of labels. Excluded services are never changed.
+	IncludeServices []NamePattern
+	ExcludeServices []NamePattern
+	// ScaleMetadataLabels writes the time and reason of every scale action
+	// to the labels of the service
+	ScaleMetadataLabels bool
+	// Connection selects the Docker endpoint, by default the one of the
+	// DOCKER_HOST variable
+	Connection Connection
+}
+
 // ServiceManager handles Docker Swarm service operations
 type ServiceManager struct {
-	client *client.Client
+	client  *client.Client
+	options Options
+
+	warnMu sync.Mutex
+	warned map[string]struct{}
+
+	cacheMu sync.Mutex
+	configs map[string]cachedConfig
 }
 
 // ServiceConfig holds autoscaling configuration for a service
 type ServiceConfig struct {
+	// ID identifies the service; names can be reused after a service is
+	// removed and recreated
+	ID               string
 	Name             string
-	CurrentReplicas  uint64
+	CreatedAt        time.Time
 	MinReplicas      int
 	MaxReplicas      int
 	AutoscaleEnabled bool
+
+	// CurrentReplicas is the number of tasks actually running
+	CurrentReplicas uint64
+	// DesiredReplicas is the replica count declared in the service spec
+	DesiredReplicas uint64
+	// Replicated is true for services in replicated mode, Global for
+	// services in global mode
+	Replicated bool
+	Global     bool
+	// MaxReplicasPerNode and Constraints are the placement limits of the
+	// service, which cap how many replicas the scheduler can place
+	MaxReplicasPerNode uint64
+	Constraints        []string
+	// Job is true for replicated jobs, which run JobMaxConcurrent tasks at a
+	// time until JobTotalCompletions tasks succeeded
+	Job                 bool
+	JobMaxConcurrent    uint64
+	JobTotalCompletions uint64
+	// JobQuery is a PromQL query returning the backlog of a job, e.g. a
+	// queue length, and JobItemsPerTask how many items one task processes
+	JobQuery        string
+	JobItemsPerTask float64
+	// GlobalNodeLabel is the node label a global service is constrained
+	// to, which ScaleBee adds to or removes from nodes to scale it
+	GlobalNodeLabel string
+	// SoftMaxReplicas is only exceeded under critical load
+	SoftMaxReplicas int
+	// Step is the number of replicas added or removed per scale action
+	Step int
+	// StepPercent, when set, sizes each scale action as a percentage of the
+	// current replica count instead of using the fixed Step
+	StepPercent float64
+	// CooldownUp and CooldownDown are the minimum times since the last
+	// scaling action before the service may scale up or down again
+	CooldownUp   time.Duration
+	CooldownDown time.Duration
+	// Mode is horizontal (replicas), vertical (resources), or both
+	Mode string
+	// Resources are the current task resources, VerticalBounds the limits
+	// for vertical scaling
+	Resources      Resources
+	VerticalBounds ResourceBounds
+	// Labels are the service labels, including container label fallbacks
+	Labels map[string]string
+	// App groups services that are scaled together, with replicas split in
+	// proportion to AppWeight
+	App       string
+	AppWeight float64
+	// PrometheusEndpoint names the Prometheus endpoint the service's metrics
+	// are queried from, overriding stack routes
+	PrometheusEndpoint string
+	// Stack is the namespace of the stack the service was deployed with
+	Stack string
+	// Updating is set while a rolling update or its rollback is in progress
+	Updating bool
+	// LastScaledAt and LastReason are the last scale action recorded in the
+	// service labels
+	LastScaledAt time.Time
+	LastReason   string
+}
+
+// StepSize returns how many replicas a single scale action should change.
+// Percentage steps are rounded up so every action changes at least one replica.
+func (c *ServiceConfig) StepSize() int {
+	if c.StepPercent > 0 {
+		step := int(math.Ceil(float64(c.CurrentReplicas) * c.StepPercent / 100))
+		if step < 1 {
+			step = 1
+		}
+		return step
+	}
+	return c.Step
 }
 
 // NewServiceManager creates a new Docker service manager
-func NewServiceManager() (*ServiceManager, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func NewServiceManager(opts Options) (*ServiceManager, error) {
+	cli, err := NewClient(opts.Connection)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %w", err)
+		return nil, err
 	}
 
 	return &ServiceManager{
-		client: cli,
+		client:  cli,
+		options: opts,
+		warned:  make(map[string]struct{}),
+		configs: make(map[string]cachedConfig),
 	}, nil
 }
 
@@ -40,75 +157,305 @@ func (sm *ServiceManager) Close() error {
 	return sm.client.Close()
 }
 
+// Ping checks that the Docker daemon responds
+func (sm *ServiceManager) Ping(ctx context.Context) error {
+	if _, err := sm.client.Ping(ctx); err != nil {
+		return fmt.Errorf("docker is unreachable: %w", err)
+	}
+	return nil
+}
+
 // GetServiceConfig retrieves the autoscaling configuration for a service
 func (sm *ServiceManager) GetServiceConfig(ctx context.Context, serviceName string) (*ServiceConfig, error) {
+	if config, ok := sm.cachedConfig(serviceName); ok {
+		return config, nil
+	}
+
 	service, _, err := sm.client.ServiceInspectWithRaw(ctx, serviceName, swarm.ServiceInspectOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect service %s: %w", serviceName, err)
 	}
 
+	// Inspect doesn't report task counts, so fetch the running tasks separately
+	statusFilters := filters.NewArgs(filters.Arg("id", service.ID))
+	services, err := sm.client.ServiceList(ctx, swarm.ServiceListOptions{Filters: statusFilters, Status: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of service %s: %w", serviceName, err)
+	}
+	for _, s := range services {
+		if s.ID == service.ID {
+			service.ServiceStatus = s.ServiceStatus
+		}
+	}
+
+	config := sm.buildConfig(service)
+	sm.storeConfigs(config)
+	return config, nil
+}
+
+// ListAutoscaledServices returns the configuration of every service that has
+// autoscaling enabled, independent of whether it currently reports metrics
+func (sm *ServiceManager) ListAutoscaledServices(ctx context.Context) ([]*ServiceConfig, error) {
+	listFilters := filters.NewArgs()
+	if !sm.options.ContainerLabelFallback {
+		// With the fallback the label may only exist on containers, so every
+		// service has to be checked
+		listFilters.Add("label", LabelPrefix+"=true")
+	}
+
+	services, err := sm.client.ServiceList(ctx, swarm.ServiceListOptions{Filters: listFilters, Status: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	configs := make([]*ServiceConfig, 0, len(services))
+	for _, service := range services {
+		if config := sm.buildConfig(service); config.AutoscaleEnabled {
+			configs = append(configs, config)
+		}
+	}
+	sm.storeConfigs(configs...)
+
+	return configs, nil
+}
+
+// buildConfig parses the autoscaling configuration from a service spec
+func (sm *ServiceManager) buildConfig(service swarm.Service) *ServiceConfig {
+	serviceName := service.Spec.Name
+
 	config := &ServiceConfig{
+		ID:               service.ID,
 		Name:             serviceName,
+		CreatedAt:        service.CreatedAt,
 		MinReplicas:      0,
 		MaxReplicas:      0,
 		AutoscaleEnabled: false,
+		Step:             1,
+		Mode:             ModeHorizontal,
+		AppWeight:        1,
+		JobItemsPerTask:  1,
+		Resources:        serviceResources(service.Spec),
+		Stack:            service.Spec.Labels[StackLabel],
+	}
+
+	labels := service.Spec.Labels
+	if sm.options.ContainerLabelFallback && service.Spec.TaskTemplate.ContainerSpec != nil {
+		labels = sm.mergeContainerLabels(serviceName, labels, service.Spec.TaskTemplate.ContainerSpec.Labels)
 	}
+	config.Labels = labels
 
 	// Check if autoscaling is enabled
-	if service.Spec.Labels != nil {
-		if val, ok := service.Spec.Labels["swarm.autoscaler"]; ok && val == "true" {
+	if labels != nil {
+		if val, ok := labels["swarm.autoscaler"]; ok && val == "true" {
 			config.AutoscaleEnabled = true
 		}
 
 		// Get minimum replicas
-		if val, ok := service.Spec.Labels["swarm.autoscaler.minimum"]; ok {
+		if val, ok := labels["swarm.autoscaler.minimum"]; ok {
 			if min, err := strconv.Atoi(val); err == nil {
 				config.MinReplicas = min
 			}
 		}
 
 		// Get maximum replicas
-		if val, ok := service.Spec.Labels["swarm.autoscaler.maximum"]; ok {
+		if val, ok := labels["swarm.autoscaler.maximum"]; ok {
 			if max, err := strconv.Atoi(val); err == nil {
 				config.MaxReplicas = max
 			}
 		}
+
+		// Get soft maximum replicas
+		if val, ok := labels["swarm.autoscaler.maximum.soft"]; ok {
+			if softMax, err := strconv.Atoi(val); err == nil {
+				config.SoftMaxReplicas = softMax
+			}
+		}
+
+		// Get replicas added or removed per scale action, either a fixed
+		// count ("3") or a percentage of the current replicas ("25%")
+		if val, ok := labels["swarm.autoscaler.step"]; ok {
+			if pct, isPercent := strings.CutSuffix(val, "%"); isPercent {
+				if stepPercent, err := strconv.ParseFloat(pct, 64); err == nil && stepPercent > 0 {
+					config.StepPercent = stepPercent
+				}
+			} else if step, err := strconv.Atoi(val); err == nil && step > 0 {
+				config.Step = step
+			}
+		}
+
+		// Get per-direction cooldowns
+		if val, ok := labels["swarm.autoscaler.cooldown.up"]; ok {
+			if d, err := parseDuration(val); err == nil {
+				config.CooldownUp = d
+			}
+		}
+		if val, ok := labels["swarm.autoscaler.cooldown.down"]; ok {
+			if d, err := parseDuration(val); err == nil {
+				config.CooldownDown = d
+			}
+		}
+
+		// Get scaling mode and vertical scaling bounds
+		if val, ok := labels["swarm.autoscaler.mode"]; ok && validateMode(val) == nil {
+			config.Mode = val
+		}
+		if val, ok := labels["swarm.autoscaler.vertical.cpu.min"]; ok {
+			if n, err := parseCPUs(val); err == nil {
+				config.VerticalBounds.CPUMin = n
+			}
+		}
+		if val, ok := labels["swarm.autoscaler.vertical.cpu.max"]; ok {
+			if n, err := parseCPUs(val); err == nil {
+				config.VerticalBounds.CPUMax = n
+			}
+		}
+		if val, ok := labels["swarm.autoscaler.vertical.memory.min"]; ok {
+			if n, err := parseMemory(val); err == nil {
+				config.VerticalBounds.MemoryMin = n
+			}
+		}
+		if val, ok := labels["swarm.autoscaler.vertical.memory.max"]; ok {
+			if n, err := parseMemory(val); err == nil {
+				config.VerticalBounds.MemoryMax = n
+			}
+		}
+
+		// Get application grouping
+		config.App = labels["swarm.autoscaler.app"]
+		if val, ok := labels["swarm.autoscaler.app.weight"]; ok {
+			if weight, err := strconv.ParseFloat(val, 64); err == nil && weight > 0 {
+				config.AppWeight = weight
+			}
+		}
+
+		// Get the Prometheus endpoint of federated setups
+		config.PrometheusEndpoint = labels["swarm.autoscaler.prometheus"]
+
+		// Get the node label global services are scaled with
+		config.GlobalNodeLabel = labels["swarm.autoscaler.global.node_label"]
+
+		// Get the backlog query of replicated jobs
+		config.JobQuery = labels["swarm.autoscaler.job.query"]
+		if val, ok := labels["swarm.autoscaler.job.items_per_task"]; ok {
+			if items, err := strconv.ParseFloat(val, 64); err == nil && items > 0 {
+				config.JobItemsPerTask = items
+			}
+		}
+
+		// Get the last scale action written back by ScaleBee
+		if val, ok := labels[LastScaledAtLabel]; ok {
+			if t, err := time.Parse(time.RFC3339, val); err == nil {
+				config.LastScaledAt = t
+			}
+		}
+		config.LastReason = labels[LastReasonLabel]
+	}
+
+	if !sm.inScope(service.Spec) {
+		config.AutoscaleEnabled = false
 	}
 
-	// Get current replicas
+	// Get desired replicas from the spec, and current replicas from the tasks
+	// that are actually running so pending or failing tasks don't count
+	config.Replicated = service.Spec.Mode.Replicated != nil
+	config.Global = service.Spec.Mode.Global != nil
+	if job := service.Spec.Mode.ReplicatedJob; job != nil {
+		config.Job = true
+		if job.MaxConcurrent != nil {
+			config.JobMaxConcurrent = *job.MaxConcurrent
+		}
+		if job.TotalCompletions != nil {
+			config.JobTotalCompletions = *job.TotalCompletions
+		}
+	}
 	if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
-		config.CurrentReplicas = *service.Spec.Mode.Replicated.Replicas
+		config.DesiredReplicas = *service.Spec.Mode.Replicated.Replicas
+	}
+	config.CurrentReplicas = config.DesiredReplicas
+	if service.ServiceStatus != nil {
+		config.CurrentReplicas = service.ServiceStatus.RunningTasks
 	}
 
-	return config, nil
+	if placement := service.Spec.TaskTemplate.Placement; placement != nil {
+		config.MaxReplicasPerNode = placement.MaxReplicas
+		config.Constraints = placement.Constraints
+	}
+
+	if service.UpdateStatus != nil {
+		switch service.UpdateStatus.State {
+		case swarm.UpdateStateUpdating, swarm.UpdateStateRollbackStarted:
+			config.Updating = true
+		}
+	}
+
+	return config
 }
 
-// ScaleService scales a service to the specified number of replicas
-func (sm *ServiceManager) ScaleService(ctx context.Context, serviceName string, replicas uint64) error {
-	service, _, err := sm.client.ServiceInspectWithRaw(ctx, serviceName, swarm.ServiceInspectOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to inspect service %s: %w", serviceName, err)
+// parseDuration parses a label duration such as "30s" or "10m". Plain numbers
+// are interpreted as seconds.
+func parseDuration(val string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(val); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(val)
+}
+
+// mergeContainerLabels returns the effective autoscaler labels for a service.
+// Service labels always take precedence; container labels only fill in
+// swarm.autoscaler.* keys that are absent on the service spec.
+func (sm *ServiceManager) mergeContainerLabels(serviceName string, serviceLabels, containerLabels map[string]string) map[string]string {
+	merged := make(map[string]string, len(serviceLabels))
+	for k, v := range serviceLabels {
+		merged[k] = v
 	}
 
-	// Update the replica count
-	if service.Spec.Mode.Replicated == nil {
-		return fmt.Errorf("service %s is not in replicated mode", serviceName)
+	for k, v := range containerLabels {
+		if !strings.HasPrefix(k, LabelPrefix) {
+			continue
+		}
+
+		serviceVal, ok := serviceLabels[k]
+		if !ok {
+			sm.warnOnce(serviceName, k, "Label is only set on the container, using it as fallback (move it to deploy.labels)",
+				"service", serviceName, "label", k)
+			merged[k] = v
+			continue
+		}
+
+		if serviceVal != v {
+			sm.warnOnce(serviceName, k, "Service and container labels differ, using the service label",
+				"service", serviceName, "label", k, "service_value", serviceVal, "container_value", v)
+		}
 	}
 
-	service.Spec.Mode.Replicated.Replicas = &replicas
+	return merged
+}
+
+// warnOnce logs a warning only the first time it is seen for a service/label pair
+func (sm *ServiceManager) warnOnce(serviceName, label, msg string, args ...any) {
+	key := serviceName + "/" + label
 
-	// Update the service
-	_, err = sm.client.ServiceUpdate(
-		ctx,
-		service.ID,
-		service.Version,
-		service.Spec,
-		swarm.ServiceUpdateOptions{},
-	)
+	sm.warnMu.Lock()
+	defer sm.warnMu.Unlock()
 
-	if err != nil {
-		return fmt.Errorf("failed to update service %s: %w", serviceName, err)
+	if _, seen := sm.warned[key]; seen {
+		return
 	}
+	sm.warned[key] = struct{}{}
+	slog.Warn(msg, args...)
+}
 
-	return nil
+// ScaleService scales a service, by ID, to the specified number of replicas
+// for the given reason
+func (sm *ServiceManager) ScaleService(ctx context.Context, serviceID string, replicas uint64, reason string) error {
+	defer sm.InvalidateService(serviceID)
+
+	return sm.updateService(ctx, serviceID, func(service *swarm.Service) error {
+		if service.Spec.Mode.Replicated == nil {
+			return fmt.Errorf("service %s is not in replicated mode", service.Spec.Name)
+		}
+		service.Spec.Mode.Replicated.Replicas = &replicas
+		sm.recordScale(service, reason)
+		return nil
+	})
 }
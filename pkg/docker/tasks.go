@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// RecentTaskFailures returns how many tasks of a service failed since the
+// given time. Swarm replaces failed tasks instead of restarting containers,
+// so a high count means the service is crash-looping. Only tasks still in
+// Swarm's task history are counted.
+func (sm *ServiceManager) RecentTaskFailures(ctx context.Context, serviceID string, since time.Time) (int, error) {
+	tasks, err := sm.client.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", serviceID)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tasks of service %s: %w", serviceID, err)
+	}
+
+	failures := 0
+	for _, t := range tasks {
+		if t.Status.State == swarm.TaskStateFailed && t.Status.Timestamp.After(since) {
+			failures++
+		}
+	}
+	return failures, nil
+}
+
+// RunningReplicas returns the number of running tasks of a service, bypassing
+// the configuration cache
+func (sm *ServiceManager) RunningReplicas(ctx context.Context, serviceID string) (uint64, error) {
+	services, err := sm.client.ServiceList(ctx, swarm.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("id", serviceID)),
+		Status:  true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get status of service %s: %w", serviceID, err)
+	}
+	for _, s := range services {
+		if s.ID == serviceID && s.ServiceStatus != nil {
+			return s.ServiceStatus.RunningTasks, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s not found", serviceID)
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// updateRetries bounds how often an update is repeated after a version
+// conflict
+const updateRetries = 3
+
+// tracer creates spans for service updates; the Docker client adds spans
+// for its requests
+var tracer = otel.Tracer("github.com/dxas90/scalebee/pkg/docker")
+
+// updateService inspects a service by ID, applies change to it and updates it.
+// Swarm rejects an update as out of sequence when the service was modified
+// since it was inspected, e.g. by a concurrent deployment, so it is
+// inspected again and the change reapplied.
+func (sm *ServiceManager) updateService(ctx context.Context, serviceID string, change func(service *swarm.Service) error) (err error) {
+	ctx, span := tracer.Start(ctx, "update_service", trace.WithAttributes(attribute.String("service", serviceID)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		service, _, err := sm.client.ServiceInspectWithRaw(ctx, serviceID, swarm.ServiceInspectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to inspect service %s: %w", serviceID, err)
+		}
+		// ScaleBee's own exporters are updated in any stack, unless excluded
+		exporter := service.Spec.Labels[ExporterLabel] == "true" && !sm.excluded(service.Spec.Name)
+		if !sm.inScope(service.Spec) && !exporter {
+			return fmt.Errorf("%w: %s", ErrOutOfScope, service.Spec.Name)
+		}
+		if err := change(&service); err != nil {
+			return err
+		}
+
+		_, err = sm.client.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, swarm.ServiceUpdateOptions{})
+		if err == nil {
+			return nil
+		}
+		if !outOfSequence(err) || attempt >= updateRetries {
+			return fmt.Errorf("failed to update service %s: %w", service.Spec.Name, err)
+		}
+
+		slog.Info("Service changed during the update, retrying", "service", service.Spec.Name, "attempt", attempt+1, "retries", updateRetries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * 100 * time.Millisecond):
+		}
+	}
+}
+
+// outOfSequence reports whether an update failed because the service
+// version was outdated
+func outOfSequence(err error) bool {
+	return strings.Contains(err.Error(), "update out of sequence")
+}
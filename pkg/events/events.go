@@ -0,0 +1,98 @@
+// Package events carries the scaling decisions of the autoscaler as
+// structured events to the notifiers, the event history and the API.
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Types of events
+const (
+	// TypeScaled is a scaling action that was applied
+	TypeScaled = "scaled"
+	// TypeSkipped is a service left alone in a cycle, with the reason
+	TypeSkipped = "skipped"
+	// TypeProposed is a scaling action waiting for manual approval
+	TypeProposed = "proposed"
+	// TypeNotice is any other noteworthy change, e.g. disaster mode or a
+	// lost Prometheus
+	TypeNotice = "notice"
+	// TypeError is an error of the decision loop
+	TypeError = "error"
+)
+
+// Event is a decision or state change of the autoscaler
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Cluster  string    `json:"cluster,omitempty"`
+	RunID    string    `json:"run_id,omitempty"`
+	Service  string    `json:"service,omitempty"`
+	Message  string    `json:"message"`
+	Critical bool      `json:"critical,omitempty"`
+
+	// Scaling details, set for scaling actions and proposals. Reason is the
+	// skip reason for skipped services.
+	Direction    string `json:"direction,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	FromReplicas int    `json:"from_replicas,omitempty"`
+	ToReplicas   int    `json:"to_replicas,omitempty"`
+	Vertical     bool   `json:"vertical,omitempty"`
+
+	// Latest service metrics
+	CPUPercent    float64 `json:"cpu_percent,omitempty"`
+	MemoryPercent float64 `json:"memory_percent,omitempty"`
+
+	// ProposalID is set for proposals, Error for errors
+	ProposalID string `json:"proposal_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Handler consumes events
+type Handler func(ctx context.Context, event Event)
+
+// subscriber is a handler with the event types it receives
+type subscriber struct {
+	handler Handler
+	types   []string
+}
+
+// Bus delivers every published event to its subscribers
+type Bus struct {
+	mu          sync.Mutex
+	subscribers []subscriber
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for events of the given types, or for all
+// events when no type is given
+func (b *Bus) Subscribe(handler Handler, types ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber{handler: handler, types: types})
+}
+
+// Publish delivers an event to the subscribers in the order they
+// subscribed. Handlers run synchronously, so slow ones delay the caller.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	subscribers := append([]subscriber(nil), b.subscribers...)
+	b.mu.Unlock()
+
+	for _, s := range subscribers {
+		if len(s.types) == 0 || slices.Contains(s.types, event.Type) {
+			s.handler(ctx, event)
+		}
+	}
+}
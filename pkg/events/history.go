@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultHistorySize is the default number of events a history keeps
+const DefaultHistorySize = 500
+
+// History keeps the latest events in memory
+type History struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+	next   int
+	full   bool
+}
+
+// NewHistory creates a history keeping the latest size events
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{events: make([]Event, size), size: size}
+}
+
+// Record adds an event, dropping the oldest one when the history is full.
+// It is a Handler, so a history can subscribe to a bus.
+func (h *History) Record(_ context.Context, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.events[h.next] = event
+	h.next = (h.next + 1) % h.size
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Filter selects events of a history; empty fields match everything
+type Filter struct {
+	Service string
+	Type    string
+	// Limit caps the number of events returned, 0 returns all
+	Limit int
+}
+
+// Events returns the events matching the filter, newest first
+func (h *History) Events(filter Filter) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = h.size
+	}
+
+	events := []Event{}
+	for i := 1; i <= count; i++ {
+		e := h.events[(h.next-i+h.size)%h.size]
+		if (filter.Service != "" && e.Service != filter.Service) || (filter.Type != "" && e.Type != filter.Type) {
+			continue
+		}
+		events = append(events, e)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events
+}
@@ -0,0 +1,85 @@
+// Package instrument measures the requests ScaleBee sends to its
+// dependencies, Docker and Prometheus, so slow ones show up before they
+// break scaling.
+package instrument
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Docker and Prometheus are the values of the dependency label
+	Docker     = "docker"
+	Prometheus = "prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scalebee_dependency_request_duration_seconds",
+		Help:    "Duration of requests to Docker and Prometheus until the response headers arrived",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"dependency", "target", "operation"})
+	requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scalebee_dependency_request_errors_total",
+		Help: "Requests to Docker and Prometheus that failed or returned a server error",
+	}, []string{"dependency", "target", "operation"})
+)
+
+// Register adds the request metrics to a registry
+func Register(r prometheus.Registerer) {
+	r.MustRegister(requestDuration, requestErrors)
+}
+
+// OperationFunc names the operation of a request for the operation label.
+// It must map IDs and names to placeholders to keep the label bounded.
+type OperationFunc func(req *http.Request) string
+
+// Transport returns a RoundTripper that measures the requests sent through
+// next. target names the endpoint, the host of the request URL when empty;
+// operation defaults to the method and path.
+func Transport(dependency, target string, operation OperationFunc, next http.RoundTripper) http.RoundTripper {
+	if operation == nil {
+		operation = func(req *http.Request) string { return req.Method + " " + req.URL.Path }
+	}
+	return &transport{dependency: dependency, target: target, operation: operation, next: next}
+}
+
+// transport measures requests
+type transport struct {
+	dependency string
+	target     string
+	operation  OperationFunc
+	next       http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := t.target
+	if target == "" {
+		target = req.URL.Host
+	}
+	labels := prometheus.Labels{"dependency": t.dependency, "target": target, "operation": t.operation(req)}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	requestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+	// Requests cancelled by ScaleBee, e.g. on shutdown, say nothing about
+	// the dependency
+	if (err != nil && !errors.Is(err, context.Canceled)) || (err == nil && resp.StatusCode >= 500) {
+		requestErrors.With(labels).Inc()
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *transport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// containerGauge is a metric exported for every container with usage stats
+type containerGauge struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(m *ContainerMetrics) float64
+}
+
+// exporterDescs holds the descriptors of the exporter's own metrics. Container
+// descriptors depend on the configured extra labels.
+type exporterDescs struct {
+	containers []containerGauge
+	healthy    *prometheus.Desc
+	restarts   *prometheus.Desc
+}
+
+var (
+	collectionDurationDesc = prometheus.NewDesc("scalebee_exporter_collection_duration_seconds",
+		"Duration of the last container stats collection", nil, nil)
+	statsFailuresDesc = prometheus.NewDesc("scalebee_exporter_stats_failures",
+		"Container stats requests that failed or timed out in the last collection", nil, nil)
+)
+
+// newExporterDescs creates the container descriptors with the given extra labels
+func newExporterDescs(extraLabels []MetricLabel) *exporterDescs {
+	labels := []string{"service", "task", "container_id"}
+	for _, l := range extraLabels {
+		labels = append(labels, l.Name)
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, labels, nil)
+	}
+
+	return &exporterDescs{
+		containers: []containerGauge{
+			{desc("container_cpu_usage_percent", "CPU usage percentage of the container"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return m.CPUPercentage }},
+			{desc("container_cpu_usage_seconds_total", "Cumulative CPU time consumed by the container in seconds"),
+				prometheus.CounterValue, func(m *ContainerMetrics) float64 { return m.CPUUsageSeconds }},
+			{desc("container_memory_usage_mb", "Memory usage in megabytes"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return m.MemoryUsageMB }},
+			{desc("container_memory_working_set_mb", "Memory usage without inactive page cache in megabytes"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return m.MemoryWorkingSetMB }},
+			{desc("container_memory_working_set_bytes", "Memory usage without inactive page cache in bytes"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return float64(m.MemoryWorkingSetBytes) }},
+			{desc("container_memory_limit_mb", "Memory limit in megabytes"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return m.MemoryLimitMB }},
+			{desc("container_start_time_seconds", "Start time of the container since unix epoch in seconds"),
+				prometheus.GaugeValue, func(m *ContainerMetrics) float64 { return float64(m.StartedAt.Unix()) }},
+		},
+		healthy: desc("container_healthy",
+			"Whether the task passes its healthcheck (1 without a healthcheck)"),
+		restarts: desc("container_restart_count",
+			"Failed tasks in the task's slot, within Swarm's task history"),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, g := range e.descs.containers {
+		ch <- g.desc
+	}
+	ch <- e.descs.healthy
+	ch <- e.descs.restarts
+	ch <- collectionDurationDesc
+	ch <- statsFailuresDesc
+
+	if e.serviceResources {
+		describeServiceMetrics(ch, resourceGauges)
+	}
+	if e.serviceReplicas {
+		describeServiceMetrics(ch, replicaGauges)
+	}
+	if e.nodeMetrics {
+		describeNodeMetrics(ch)
+	}
+}
+
+// Collect implements prometheus.Collector with the metrics of the last
+// collection
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, m := range e.metrics {
+		labels := append([]string{m.ServiceName, m.TaskName, m.ContainerID}, m.Labels...)
+		for _, g := range e.descs.containers {
+			ch <- prometheus.MustNewConstMetric(g.desc, g.valueType, g.value(m), labels...)
+		}
+	}
+
+	for _, t := range e.tasks {
+		labels := append([]string{t.ServiceName, t.TaskName, t.ContainerID}, t.Labels...)
+		healthy := 0.0
+		if t.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(e.descs.healthy, prometheus.GaugeValue, healthy, labels...)
+		if t.HasRestarts {
+			ch <- prometheus.MustNewConstMetric(e.descs.restarts, prometheus.GaugeValue, float64(t.Restarts), labels...)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(collectionDurationDesc, prometheus.GaugeValue, e.collectionDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(statsFailuresDesc, prometheus.GaugeValue, float64(e.statsFailures))
+
+	if e.serviceResources {
+		collectServiceMetrics(ch, resourceGauges, e.services)
+	}
+	if e.serviceReplicas {
+		collectServiceMetrics(ch, replicaGauges, e.services)
+	}
+	if e.nodeMetrics {
+		collectNodeMetrics(ch, e.node, e.capacity)
+	}
+}
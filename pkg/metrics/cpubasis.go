@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// CPU percentage bases
+const (
+	// CPUBasisHost reports CPU usage as docker stats does (100 = one core)
+	CPUBasisHost = "host"
+	// CPUBasisLimit reports CPU usage relative to the task's CPU limit
+	CPUBasisLimit = "limit"
+	// CPUBasisReservation reports CPU usage relative to the service's CPU
+	// reservation
+	CPUBasisReservation = "reservation"
+)
+
+// SetCPUBasis sets what container_cpu_usage_percent is relative to. Tasks
+// without a limit or reservation fall back to the host basis.
+func (e *Exporter) SetCPUBasis(basis string) {
+	e.cpuBasis = basis
+}
+
+// relativeCPU converts a host-basis CPU percentage to the configured basis.
+// nanoCPUs caches the per-cycle basis of each service.
+func (e *Exporter) relativeCPU(ctx context.Context, cpuPercent float64, containerID, serviceName string, nanoCPUs map[string]int64) float64 {
+	var basis int64
+	switch e.cpuBasis {
+	case CPUBasisLimit:
+		basis = e.containerCPULimit(ctx, containerID)
+	case CPUBasisReservation:
+		e.cacheMu.Lock()
+		reservation, ok := nanoCPUs[serviceName]
+		e.cacheMu.Unlock()
+		if !ok {
+			// Concurrent workers may both inspect the service, which is harmless
+			reservation = e.serviceCPUReservation(ctx, serviceName)
+			e.cacheMu.Lock()
+			nanoCPUs[serviceName] = reservation
+			e.cacheMu.Unlock()
+		}
+		basis = reservation
+	}
+
+	if basis <= 0 {
+		return cpuPercent
+	}
+	// A host-basis percentage of 100 is one core, i.e. 1e9 nano CPUs
+	return cpuPercent * 1e9 / float64(basis)
+}
+
+// containerCPULimit returns the CPU limit of a container in nano CPUs. Swarm
+// applies the service's CPU limit to the task container, and it never changes
+// during the container's lifetime, so it is cached.
+func (e *Exporter) containerCPULimit(ctx context.Context, containerID string) int64 {
+	e.cacheMu.Lock()
+	limit, ok := e.cpuLimits[containerID]
+	e.cacheMu.Unlock()
+	if ok {
+		return limit
+	}
+
+	info, err := e.dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		slog.Warn("Failed to inspect container", "container", containerID[:12], "error", err)
+		return 0
+	}
+
+	limit = info.HostConfig.NanoCPUs
+	e.cacheMu.Lock()
+	e.cpuLimits[containerID] = limit
+	e.cacheMu.Unlock()
+	return limit
+}
+
+// serviceCPUReservation returns the CPU reservation of a service in nano CPUs.
+// Reservations are only in the service spec, which requires a manager node.
+func (e *Exporter) serviceCPUReservation(ctx context.Context, serviceName string) int64 {
+	service, _, err := e.dockerClient.ServiceInspectWithRaw(ctx, serviceName, swarm.ServiceInspectOptions{})
+	if err != nil {
+		slog.Warn("Failed to inspect service for its CPU reservation", "service", serviceName, "error", err)
+		return 0
+	}
+
+	resources := service.Spec.TaskTemplate.Resources
+	if resources == nil || resources.Reservations == nil {
+		return 0
+	}
+	return resources.Reservations.NanoCPUs
+}
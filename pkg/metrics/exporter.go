@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
@@ -14,15 +13,75 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/dxas90/scalebee/pkg/instrument"
+	"github.com/dxas90/scalebee/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
+// prevStatsTTL is how many collection intervals previous stats are kept
+// without a newer sample
+const prevStatsTTL = 5
+
 // Exporter collects Docker container stats and exposes them as Prometheus metrics
 type Exporter struct {
 	dockerClient *client.Client
 	mu           sync.RWMutex
 	metrics      map[string]*ContainerMetrics
+	tasks        map[string]*TaskHealth
+	services     []*ServiceMetrics
 	prevStats    map[string]*container.StatsResponse
 	interval     time.Duration
+	registry     *prometheus.Registry
+	handler      http.Handler
+	descs        *exporterDescs
+	cpuBasis     string
+	cpuLimits    map[string]int64
+	pacing       string
+	pacingDelay  time.Duration
+	workers      int
+	statsTimeout time.Duration
+	statsMode    string
+
+	streamsMu sync.Mutex
+	streams   map[string]*statsStream
+
+	// cacheMu guards prevStats and cpuLimits, which stats workers share
+	cacheMu sync.Mutex
+
+	// Self-metrics of the last collection
+	collectionDuration time.Duration
+	statsFailures      int
+
+	restartsWarned   bool
+	capacityWarned   bool
+	serviceResources bool
+	serviceReplicas  bool
+
+	autoscaledOnly   bool
+	autoscaledWarned bool
+	include          []LabelSelector
+	exclude          []LabelSelector
+
+	pushURL           string
+	pusher            *push.Pusher
+	remoteWrite       *RemoteWriteConfig
+	remoteWriteClient *http.Client
+	meterProvider     *sdkmetric.MeterProvider
+
+	metricLabels []MetricLabel
+	minTaskAge   time.Duration
+	nodeName     string
+
+	nodeMetrics  bool
+	procPath     string
+	prevCPUTimes *cpuTimes
+	node         *NodeMetrics
+	capacity     []*NodeCapacity
 }
 
 // ContainerMetrics holds CPU and memory metrics for a container
@@ -32,34 +91,93 @@ type ContainerMetrics struct {
 	ContainerID   string
 	CPUPercentage float64
 	MemoryUsageMB float64
-	MemoryLimitMB float64
-	LastUpdate    time.Time
+	// MemoryWorkingSetMB excludes inactive page cache, which the kernel can
+	// reclaim under pressure
+	MemoryWorkingSetMB float64
+	MemoryLimitMB      float64
+	// CPUUsageSeconds and MemoryWorkingSetBytes are the raw values in
+	// cAdvisor units
+	CPUUsageSeconds       float64
+	MemoryWorkingSetBytes uint64
+	StartedAt             time.Time
+	LastUpdate            time.Time
+	// Labels are the values of the configured extra metric labels
+	Labels []string
 }
 
-// NewExporter creates a new metrics exporter
-func NewExporter(interval time.Duration) (*Exporter, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// NewExporter creates a new metrics exporter for the containers of the
+// Docker endpoint of conn
+func NewExporter(interval time.Duration, conn docker.Connection) (*Exporter, error) {
+	cli, err := docker.NewClient(conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %w", err)
+		return nil, err
 	}
 
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	registry.MustRegister(version.Collector())
+	instrument.Register(registry)
+
+	// Scrapers that accept OpenMetrics or gzip negotiate them through the
+	// Accept and Accept-Encoding headers
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics:   true,
+		OfferedCompressions: []promhttp.Compression{promhttp.Identity, promhttp.Gzip},
+	})
+
 	return &Exporter{
 		dockerClient: cli,
+		registry:     registry,
+		handler:      handler,
+		descs:        newExporterDescs(nil),
 		metrics:      make(map[string]*ContainerMetrics),
+		tasks:        make(map[string]*TaskHealth),
 		prevStats:    make(map[string]*container.StatsResponse),
 		interval:     interval,
+		cpuBasis:     CPUBasisHost,
+		pacing:       PacingNone,
+		workers:      DefaultStatsWorkers,
+		statsMode:    StatsModeStream,
+		streams:      make(map[string]*statsStream),
+		statsTimeout: DefaultStatsTimeout,
+		cpuLimits:    make(map[string]int64),
 	}, nil
 }
 
-// Start begins collecting metrics in the background
+// SetMinTaskAge leaves containers younger than age out of the usage metrics,
+// so start-up spikes never reach service averages. Their health is still
+// exported.
+func (e *Exporter) SetMinTaskAge(age time.Duration) {
+	e.minTaskAge = age
+}
+
+// Register adds a collector whose metrics are served on /metrics
+func (e *Exporter) Register(c prometheus.Collector) {
+	e.registry.MustRegister(c)
+}
+
+// RegisterWithLabels adds a collector whose metrics all get the given
+// labels, e.g. the cluster of one of several autoscalers
+func (e *Exporter) RegisterWithLabels(labels prometheus.Labels, c prometheus.Collector) {
+	prometheus.WrapRegistererWith(labels, e.registry).MustRegister(c)
+}
+
+// Start begins collecting metrics in the background. The container metrics
+// are registered here, once their labels are configured.
 func (e *Exporter) Start(ctx context.Context) {
+	e.registry.MustRegister(e)
+
 	ticker := time.NewTicker(e.interval)
 	defer ticker.Stop()
 
 	// Collect immediately on start
 	if err := e.collectMetrics(ctx); err != nil {
-		log.Printf("Error collecting initial metrics: %v", err)
+		slog.Error("Failed to collect initial metrics", "error", err)
 	}
+	e.publish(ctx)
 
 	for {
 		select {
@@ -67,14 +185,23 @@ func (e *Exporter) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			if err := e.collectMetrics(ctx); err != nil {
-				log.Printf("Error collecting metrics: %v", err)
+				slog.Error("Failed to collect metrics", "error", err)
 			}
+			e.publish(ctx)
 		}
 	}
 }
 
+// publish sends the collected metrics to the configured push targets
+func (e *Exporter) publish(ctx context.Context) {
+	e.push(ctx)
+	e.writeRemote(ctx)
+}
+
 // collectMetrics gets stats from all running containers
 func (e *Exporter) collectMetrics(ctx context.Context) error {
+	start := time.Now()
+
 	// List all containers (including Swarm tasks)
 	containerFilters := filters.NewArgs()
 	containerFilters.Add("status", "running")
@@ -87,39 +214,121 @@ func (e *Exporter) collectMetrics(ctx context.Context) error {
 	}
 
 	newMetrics := make(map[string]*ContainerMetrics)
+	newTasks := make(map[string]*TaskHealth)
+	reservations := make(map[string]int64)
+
+	// The task list is only available on managers
+	restarts, err := e.slotRestarts(ctx)
+	if err != nil && !e.restartsWarned {
+		slog.Warn("Restart counts unavailable, not exporting container_restart_count", "error", err)
+		e.restartsWarned = true
+	}
 
-	for _, ctr := range containers {
-		// Get container stats
-		stats, err := e.getContainerStats(ctx, ctr.ID)
-		if err != nil {
-			log.Printf("Failed to get stats for container %s: %v", ctr.ID[:12], err)
-			continue
-		}
+	var autoscaled map[string]bool
+	if e.autoscaledOnly {
+		autoscaled = e.autoscaledServices(ctx)
+	}
 
+	var jobs []*statsJob
+	for _, ctr := range containers {
 		// Extract service and task names from labels
 		serviceName := ctr.Labels["com.docker.swarm.service.name"]
 		taskName := ctr.Labels["com.docker.swarm.task.name"]
 
-		// Skip containers without Swarm labels
-		if serviceName == "" {
+		// Skip containers without Swarm labels, and of services not exported
+		if serviceName == "" || !e.exported(ctr.Labels, autoscaled) {
 			continue
 		}
 
-		containerMetrics := &ContainerMetrics{
-			ServiceName:   serviceName,
-			TaskName:      taskName,
-			ContainerID:   ctr.ID[:12],
-			CPUPercentage: stats.CPUPercentage,
-			MemoryUsageMB: stats.MemoryUsageMB,
-			MemoryLimitMB: stats.MemoryLimitMB,
-			LastUpdate:    time.Now(),
+		labels := e.containerLabels(ctx, ctr.Labels)
+		task := &TaskHealth{
+			ServiceName: serviceName,
+			TaskName:    taskName,
+			ContainerID: ctr.ID[:12],
+			Healthy:     containerHealthy(ctr.Status),
+			Labels:      labels,
+		}
+		if restarts != nil {
+			task.Restarts, task.HasRestarts = restarts[ctr.ID], true
+		}
+		newTasks[ctr.ID] = task
+
+		// Skip tasks failing their healthcheck so they don't distort averages
+		if strings.Contains(ctr.Status, "(unhealthy)") {
+			continue
+		}
+
+		// Skip tasks too young for their usage to be representative
+		if e.minTaskAge > 0 && time.Since(time.Unix(ctr.Created, 0)) < e.minTaskAge {
+			continue
 		}
 
-		newMetrics[ctr.ID] = containerMetrics
+		jobs = append(jobs, &statsJob{
+			containerID: ctr.ID,
+			metrics: &ContainerMetrics{
+				ServiceName: serviceName,
+				TaskName:    taskName,
+				ContainerID: ctr.ID[:12],
+				Labels:      labels,
+				// Swarm never restarts a task's container in place, so the
+				// creation time is also when the task started
+				StartedAt: time.Unix(ctr.Created, 0),
+			},
+		})
+	}
+
+	failures := e.collectStats(ctx, jobs, reservations)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Stop streaming stats of containers that are gone or now unhealthy
+	streamed := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		streamed[job.containerID] = true
+	}
+	e.closeStreams(streamed)
+
+	for _, job := range jobs {
+		if job.ok {
+			newMetrics[job.containerID] = job.metrics
+		}
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, ctr := range containers {
+		running[ctr.ID] = true
+	}
+	e.evictCaches(running, time.Now())
+
+	var services []*ServiceMetrics
+	if e.serviceResources || e.serviceReplicas {
+		if services, err = e.collectServices(ctx); err != nil {
+			slog.Error("Failed to collect service metrics", "error", err)
+		}
+	}
+
+	var node *NodeMetrics
+	var capacity []*NodeCapacity
+	if e.nodeMetrics {
+		if node, err = e.collectNode(ctx); err != nil {
+			slog.Error("Failed to collect node metrics", "error", err)
+		}
+		// Only managers can list nodes; workers export their own node only
+		if capacity, err = e.collectCapacity(ctx); err != nil && !e.capacityWarned {
+			slog.Warn("Swarm node capacity unavailable", "error", err)
+			e.capacityWarned = true
+		}
 	}
 
 	e.mu.Lock()
 	e.metrics = newMetrics
+	e.tasks = newTasks
+	e.services = services
+	e.node = node
+	e.capacity = capacity
+	e.collectionDuration = time.Since(start)
+	e.statsFailures = failures
 	e.mu.Unlock()
 
 	return nil
@@ -127,9 +336,12 @@ func (e *Exporter) collectMetrics(ctx context.Context) error {
 
 // ContainerStats holds calculated stats
 type ContainerStats struct {
-	CPUPercentage float64
-	MemoryUsageMB float64
-	MemoryLimitMB float64
+	CPUPercentage         float64
+	MemoryUsageMB         float64
+	MemoryWorkingSetMB    float64
+	MemoryLimitMB         float64
+	CPUUsageSeconds       float64
+	MemoryWorkingSetBytes uint64
 }
 
 // getContainerStats retrieves and calculates stats for a container
@@ -145,27 +357,76 @@ func (e *Exporter) getContainerStats(ctx context.Context, containerID string) (*
 		return nil, fmt.Errorf("failed to decode stats: %w", err)
 	}
 
+	return e.calculateStats(containerID, &v), nil
+}
+
+// evictCaches forgets the cached stats and limits of containers that are no
+// longer running, and previous stats too old for a meaningful CPU delta, e.g.
+// of containers skipped as unhealthy for a while
+func (e *Exporter) evictCaches(running map[string]bool, now time.Time) {
+	e.cacheMu.Lock()
+	defer e.cacheMu.Unlock()
+
+	for id, prev := range e.prevStats {
+		if !running[id] || now.Sub(prev.Read) > prevStatsTTL*e.interval {
+			delete(e.prevStats, id)
+		}
+	}
+	for id := range e.cpuLimits {
+		if !running[id] {
+			delete(e.cpuLimits, id)
+		}
+	}
+}
+
+// calculateStats derives container stats from a stats response, using the
+// response of the previous collection for the CPU delta
+func (e *Exporter) calculateStats(containerID string, v *container.StatsResponse) *ContainerStats {
 	// Calculate CPU percentage using previous stats if available
 	var cpuPercent float64
-	if prevStat, exists := e.prevStats[containerID]; exists {
-		cpuPercent = calculateCPUPercentWithPrevious(&v, prevStat)
+	e.cacheMu.Lock()
+	if prevStat, exists := e.prevStats[containerID]; exists && prevStat.Read.Before(v.Read) {
+		cpuPercent = calculateCPUPercentWithPrevious(v, prevStat)
 	} else {
-		// First time seeing this container, use PreCPUStats
-		cpuPercent = calculateCPUPercent(&v)
+		// First time seeing this container, or a stalled stream without a
+		// newer sample, use PreCPUStats
+		cpuPercent = calculateCPUPercent(v)
 	}
 
 	// Store current stats for next iteration
-	e.prevStats[containerID] = &v
+	e.prevStats[containerID] = v
+	e.cacheMu.Unlock()
 
 	// Calculate memory usage
 	memUsageMB := float64(v.MemoryStats.Usage) / 1024 / 1024
+	memWorkingSet := workingSet(v)
+	memWorkingSetMB := float64(memWorkingSet) / 1024 / 1024
 	memLimitMB := float64(v.MemoryStats.Limit) / 1024 / 1024
 
 	return &ContainerStats{
-		CPUPercentage: cpuPercent,
-		MemoryUsageMB: memUsageMB,
-		MemoryLimitMB: memLimitMB,
-	}, nil
+		CPUPercentage:      cpuPercent,
+		MemoryUsageMB:      memUsageMB,
+		MemoryWorkingSetMB: memWorkingSetMB,
+		// TotalUsage is in nanoseconds
+		CPUUsageSeconds:       float64(v.CPUStats.CPUUsage.TotalUsage) / 1e9,
+		MemoryWorkingSetBytes: memWorkingSet,
+		MemoryLimitMB:         memLimitMB,
+	}
+}
+
+// workingSet returns memory usage minus inactive page cache, as docker stats
+// and cAdvisor do. The stat is named inactive_file on cgroup v2 and
+// total_inactive_file on cgroup v1.
+func workingSet(stats *container.StatsResponse) uint64 {
+	usage := stats.MemoryStats.Usage
+	inactive, ok := stats.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		inactive = stats.MemoryStats.Stats["total_inactive_file"]
+	}
+	if inactive < usage {
+		return usage - inactive
+	}
+	return usage
 }
 
 // calculateCPUPercentWithPrevious calculates CPU percentage using stored previous stats
@@ -174,11 +435,7 @@ func calculateCPUPercentWithPrevious(current, previous *container.StatsResponse)
 	systemDelta := float64(current.CPUStats.SystemUsage - previous.CPUStats.SystemUsage)
 
 	if systemDelta > 0.0 && cpuDelta > 0.0 {
-		numCPUs := float64(len(current.CPUStats.CPUUsage.PercpuUsage))
-		if numCPUs == 0 {
-			numCPUs = 1.0
-		}
-		return (cpuDelta / systemDelta) * numCPUs * 100.0
+		return (cpuDelta / systemDelta) * onlineCPUs(current) * 100.0
 	}
 	return 0.0
 }
@@ -189,57 +446,33 @@ func calculateCPUPercent(stats *container.StatsResponse) float64 {
 	systemDelta := float64(stats.CPUStats.SystemUsage - stats.PreCPUStats.SystemUsage)
 
 	if systemDelta > 0.0 && cpuDelta > 0.0 {
-		return (cpuDelta / systemDelta) * float64(len(stats.CPUStats.CPUUsage.PercpuUsage)) * 100.0
+		return (cpuDelta / systemDelta) * onlineCPUs(stats) * 100.0
 	}
 	return 0.0
 }
 
-// ServeHTTP implements http.Handler for Prometheus metrics endpoint
-func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-
-	var sb strings.Builder
-
-	// Write metric help and type
-	sb.WriteString("# HELP container_cpu_usage_percent CPU usage percentage of the container\n")
-	sb.WriteString("# TYPE container_cpu_usage_percent gauge\n")
-
-	for _, m := range e.metrics {
-		sb.WriteString(fmt.Sprintf(
-			`container_cpu_usage_percent{service="%s",task="%s",container_id="%s"} %.2f`+"\n",
-			m.ServiceName, m.TaskName, m.ContainerID, m.CPUPercentage,
-		))
+// onlineCPUs returns the number of CPUs available to a container. cgroup v2
+// hosts don't report per-CPU usage, so OnlineCPUs is preferred and the
+// per-CPU count is only a fallback for older daemons, as in docker stats.
+func onlineCPUs(stats *container.StatsResponse) float64 {
+	if stats.CPUStats.OnlineCPUs > 0 {
+		return float64(stats.CPUStats.OnlineCPUs)
 	}
-
-	sb.WriteString("\n")
-	sb.WriteString("# HELP container_memory_usage_mb Memory usage in megabytes\n")
-	sb.WriteString("# TYPE container_memory_usage_mb gauge\n")
-
-	for _, m := range e.metrics {
-		sb.WriteString(fmt.Sprintf(
-			`container_memory_usage_mb{service="%s",task="%s",container_id="%s"} %.2f`+"\n",
-			m.ServiceName, m.TaskName, m.ContainerID, m.MemoryUsageMB,
-		))
-	}
-
-	sb.WriteString("\n")
-	sb.WriteString("# HELP container_memory_limit_mb Memory limit in megabytes\n")
-	sb.WriteString("# TYPE container_memory_limit_mb gauge\n")
-
-	for _, m := range e.metrics {
-		sb.WriteString(fmt.Sprintf(
-			`container_memory_limit_mb{service="%s",task="%s",container_id="%s"} %.2f`+"\n",
-			m.ServiceName, m.TaskName, m.ContainerID, m.MemoryLimitMB,
-		))
+	if n := len(stats.CPUStats.CPUUsage.PercpuUsage); n > 0 {
+		return float64(n)
 	}
+	return 1.0
+}
 
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-	io.WriteString(w, sb.String())
+// ServeHTTP implements http.Handler for Prometheus metrics endpoint
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.handler.ServeHTTP(w, r)
 }
 
-// Close closes the Docker client
+// Close closes the stats streams and the Docker client
 func (e *Exporter) Close() error {
+	e.closeStreams(nil)
+
 	if e.dockerClient != nil {
 		return e.dockerClient.Close()
 	}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// autoscaleLabel is the label that enables autoscaling of a service
+const autoscaleLabel = "swarm.autoscaler"
+
+// LabelSelector matches containers that have a label, with a specific
+// value if Value is set
+type LabelSelector struct {
+	Key   string
+	Value string
+	// HasValue distinguishes key= (empty value) from key (any value)
+	HasValue bool
+}
+
+// ParseLabelSelectors parses a comma-separated list of label selectors,
+// each either "key" or "key=value"
+func ParseLabelSelectors(spec string) ([]LabelSelector, error) {
+	var selectors []LabelSelector
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid label selector %q", entry)
+		}
+		selectors = append(selectors, LabelSelector{Key: key, Value: strings.TrimSpace(value), HasValue: hasValue})
+	}
+	return selectors, nil
+}
+
+// matches reports whether the labels satisfy the selector
+func (s LabelSelector) matches(labels map[string]string) bool {
+	value, ok := labels[s.Key]
+	return ok && (!s.HasValue || value == s.Value)
+}
+
+// SetContainerFilter limits the exported containers to those matching all
+// include selectors and none of the exclude selectors
+func (e *Exporter) SetContainerFilter(include, exclude []LabelSelector) {
+	e.include = include
+	e.exclude = exclude
+}
+
+// SetAutoscaledOnly limits the exported metrics to containers and services
+// with swarm.autoscaler=true. The service labels are read on managers; on
+// workers only the container label is seen.
+func (e *Exporter) SetAutoscaledOnly(enabled bool) {
+	e.autoscaledOnly = enabled
+}
+
+// autoscaledServices returns the IDs of the services with autoscaling
+// enabled, or nil when they can't be listed
+func (e *Exporter) autoscaledServices(ctx context.Context) map[string]bool {
+	services, err := e.dockerClient.ServiceList(ctx, swarm.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", autoscaleLabel+"=true")),
+	})
+	if err != nil {
+		if !e.autoscaledWarned {
+			slog.Warn("Autoscaled services unavailable, filtering on the container label only", "error", err)
+			e.autoscaledWarned = true
+		}
+		return nil
+	}
+
+	ids := make(map[string]bool, len(services))
+	for _, s := range services {
+		ids[s.ID] = true
+	}
+	return ids
+}
+
+// exported reports whether the metrics of a container are exported
+func (e *Exporter) exported(labels map[string]string, autoscaled map[string]bool) bool {
+	for _, s := range e.include {
+		if !s.matches(labels) {
+			return false
+		}
+	}
+	for _, s := range e.exclude {
+		if s.matches(labels) {
+			return false
+		}
+	}
+
+	if !e.autoscaledOnly {
+		return true
+	}
+	return autoscaled[labels["com.docker.swarm.service.id"]] || labels[autoscaleLabel] == "true"
+}
+
+// serviceListOptions returns the options to list the services whose
+// metrics are exported
+func (e *Exporter) serviceListOptions() swarm.ServiceListOptions {
+	opts := swarm.ServiceListOptions{Status: e.serviceReplicas}
+	if e.autoscaledOnly {
+		opts.Filters = filters.NewArgs(filters.Arg("label", autoscaleLabel+"=true"))
+	}
+	return opts
+}
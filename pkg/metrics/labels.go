@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Special metric label sources
+const (
+	// LabelStack adds the stack namespace of the container as "stack"
+	LabelStack = "stack"
+	// LabelNode adds the hostname of the node as "node"
+	LabelNode = "node"
+)
+
+// stackLabel is the container label Docker sets to the stack namespace
+const stackLabel = "com.docker.stack.namespace"
+
+// reservedLabels are the labels every container metric already has
+var reservedLabels = map[string]bool{"service": true, "task": true, "container_id": true}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// MetricLabel adds the value of a container label (or the node name) as a
+// Prometheus label to every container metric
+type MetricLabel struct {
+	Name   string
+	Source string
+}
+
+// ParseMetricLabels parses a comma-separated allowlist of metric labels.
+// Entries are "stack", "node", a container label (exported with dots and
+// other invalid characters replaced by underscores), or name=container_label.
+func ParseMetricLabels(spec string) ([]MetricLabel, error) {
+	var labels []MetricLabel
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var label MetricLabel
+		switch name, source, ok := strings.Cut(entry, "="); {
+		case ok:
+			label = MetricLabel{Name: strings.TrimSpace(name), Source: strings.TrimSpace(source)}
+		case entry == LabelStack:
+			label = MetricLabel{Name: LabelStack, Source: stackLabel}
+		case entry == LabelNode:
+			label = MetricLabel{Name: LabelNode, Source: LabelNode}
+		default:
+			label = MetricLabel{Name: invalidLabelChars.ReplaceAllString(entry, "_"), Source: entry}
+		}
+
+		if label.Name == "" || label.Source == "" || invalidLabelChars.MatchString(label.Name) ||
+			(label.Name[0] >= '0' && label.Name[0] <= '9') || strings.HasPrefix(label.Name, "__") {
+			return nil, fmt.Errorf("invalid metric label %q", entry)
+		}
+		if reservedLabels[label.Name] || seen[label.Name] {
+			return nil, fmt.Errorf("duplicate metric label %q", label.Name)
+		}
+		seen[label.Name] = true
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
+
+// SetMetricLabels sets the extra labels added to every container metric
+func (e *Exporter) SetMetricLabels(labels []MetricLabel) {
+	e.metricLabels = labels
+	e.descs = newExporterDescs(labels)
+}
+
+// containerLabels returns the configured extra label values of a container
+func (e *Exporter) containerLabels(ctx context.Context, labels map[string]string) []string {
+	if len(e.metricLabels) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(e.metricLabels))
+	for i, l := range e.metricLabels {
+		if l.Source == LabelNode && l.Name == LabelNode {
+			values[i] = e.localNodeName(ctx)
+		} else {
+			values[i] = labels[l.Source]
+		}
+	}
+	return values
+}
+
+// localNodeName returns the hostname of the node, looked up once
+func (e *Exporter) localNodeName(ctx context.Context) string {
+	if e.nodeName == "" {
+		info, err := e.dockerClient.Info(ctx)
+		if err != nil {
+			return ""
+		}
+		e.nodeName = info.Name
+	}
+	return e.nodeName
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NodeMetrics holds the capacity and usage of the local node
+type NodeMetrics struct {
+	Node                 string
+	CPUCores             int
+	CPUUsagePercent      float64
+	MemoryTotalBytes     int64
+	MemoryAvailableBytes uint64
+	hasCPUUsage          bool
+	hasMemoryAvailable   bool
+}
+
+// NodeCapacity is the capacity of a schedulable Swarm node not yet reserved
+// by tasks
+type NodeCapacity struct {
+	Node              string
+	AllocatableCPU    float64
+	AllocatableMemory int64
+}
+
+// cpuTimes is a /proc/stat CPU sample
+type cpuTimes struct {
+	idle, total uint64
+}
+
+// SetNodeMetrics enables node metrics, reading /proc from procPath (e.g. a
+// bind mount of the host's /proc). Allocatable capacity of all Swarm nodes is
+// exported when running on a manager.
+func (e *Exporter) SetNodeMetrics(enabled bool, procPath string) {
+	e.nodeMetrics = enabled
+	e.procPath = procPath
+}
+
+// collectNode reads the local node's capacity from the Docker engine and its
+// usage from /proc
+func (e *Exporter) collectNode(ctx context.Context) (*NodeMetrics, error) {
+	info, err := e.dockerClient.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get engine info: %w", err)
+	}
+
+	m := &NodeMetrics{
+		Node:             info.Name,
+		CPUCores:         info.NCPU,
+		MemoryTotalBytes: info.MemTotal,
+	}
+
+	if times, err := readCPUTimes(filepath.Join(e.procPath, "stat")); err != nil {
+		slog.Warn("Failed to read node CPU usage", "error", err)
+	} else {
+		if e.prevCPUTimes != nil && times.total > e.prevCPUTimes.total {
+			total := float64(times.total - e.prevCPUTimes.total)
+			idle := float64(times.idle - e.prevCPUTimes.idle)
+			m.CPUUsagePercent = (total - idle) / total * 100
+			m.hasCPUUsage = true
+		}
+		e.prevCPUTimes = times
+	}
+
+	if available, err := readMemAvailable(filepath.Join(e.procPath, "meminfo")); err != nil {
+		slog.Warn("Failed to read node available memory", "error", err)
+	} else {
+		m.MemoryAvailableBytes = available
+		m.hasMemoryAvailable = true
+	}
+
+	return m, nil
+}
+
+// collectCapacity computes the unreserved capacity of every schedulable
+// Swarm node. It requires a manager.
+func (e *Exporter) collectCapacity(ctx context.Context) ([]*NodeCapacity, error) {
+	cluster, err := docker.ReadClusterCapacity(ctx, e.dockerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := make([]*NodeCapacity, 0, len(cluster.Nodes))
+	for _, n := range cluster.Nodes {
+		capacity = append(capacity, &NodeCapacity{
+			Node:              n.Hostname,
+			AllocatableCPU:    float64(n.NanoCPUs-n.ReservedNanoCPUs) / 1e9,
+			AllocatableMemory: n.MemoryBytes - n.ReservedMemoryBytes,
+		})
+	}
+	return capacity, nil
+}
+
+// readCPUTimes reads the aggregate CPU line of /proc/stat
+func readCPUTimes(path string) (*cpuTimes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		times := &cpuTimes{}
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", path, err)
+			}
+			times.total += v
+			// idle and iowait
+			if i == 3 || i == 4 {
+				times.idle += v
+			}
+			// guest and guest_nice, after steal, are counted in user and
+			// nice already
+			if i == 7 {
+				break
+			}
+		}
+		return times, nil
+	}
+	return nil, fmt.Errorf("no cpu line in %s", path)
+}
+
+// readMemAvailable reads MemAvailable from /proc/meminfo in bytes
+func readMemAvailable(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s: %w", path, err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("no MemAvailable in %s", path)
+}
+
+var (
+	nodeCPUCoresDesc = prometheus.NewDesc("scalebee_node_cpu_cores",
+		"Number of CPUs of the node", []string{"node"}, nil)
+	nodeMemoryTotalDesc = prometheus.NewDesc("scalebee_node_memory_total_bytes",
+		"Total memory of the node in bytes", []string{"node"}, nil)
+	nodeCPUUsageDesc = prometheus.NewDesc("scalebee_node_cpu_usage_percent",
+		"CPU usage of the node across all CPUs", []string{"node"}, nil)
+	nodeMemoryAvailableDesc = prometheus.NewDesc("scalebee_node_memory_available_bytes",
+		"Memory available for new allocations in bytes", []string{"node"}, nil)
+	allocatableCPUDesc = prometheus.NewDesc("swarm_node_allocatable_cpu_cores",
+		"CPU cores of the node not reserved by running tasks", []string{"node"}, nil)
+	allocatableMemoryDesc = prometheus.NewDesc("swarm_node_allocatable_memory_bytes",
+		"Memory of the node not reserved by running tasks in bytes", []string{"node"}, nil)
+)
+
+// describeNodeMetrics sends the node and Swarm capacity descriptors
+func describeNodeMetrics(ch chan<- *prometheus.Desc) {
+	ch <- nodeCPUCoresDesc
+	ch <- nodeMemoryTotalDesc
+	ch <- nodeCPUUsageDesc
+	ch <- nodeMemoryAvailableDesc
+	ch <- allocatableCPUDesc
+	ch <- allocatableMemoryDesc
+}
+
+// collectNodeMetrics sends the local node and Swarm capacity gauges
+func collectNodeMetrics(ch chan<- prometheus.Metric, node *NodeMetrics, capacity []*NodeCapacity) {
+	if node != nil {
+		ch <- prometheus.MustNewConstMetric(nodeCPUCoresDesc, prometheus.GaugeValue, float64(node.CPUCores), node.Node)
+		ch <- prometheus.MustNewConstMetric(nodeMemoryTotalDesc, prometheus.GaugeValue, float64(node.MemoryTotalBytes), node.Node)
+		if node.hasCPUUsage {
+			ch <- prometheus.MustNewConstMetric(nodeCPUUsageDesc, prometheus.GaugeValue, node.CPUUsagePercent, node.Node)
+		}
+		if node.hasMemoryAvailable {
+			ch <- prometheus.MustNewConstMetric(nodeMemoryAvailableDesc, prometheus.GaugeValue, float64(node.MemoryAvailableBytes), node.Node)
+		}
+	}
+
+	for _, c := range capacity {
+		ch <- prometheus.MustNewConstMetric(allocatableCPUDesc, prometheus.GaugeValue, c.AllocatableCPU, c.Node)
+		ch <- prometheus.MustNewConstMetric(allocatableMemoryDesc, prometheus.GaugeValue, float64(c.AllocatableMemory), c.Node)
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	prometheusbridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLP protocols
+const (
+	OTLPNone = "none"
+	OTLPGRPC = "grpc"
+	OTLPHTTP = "http"
+)
+
+// SetOTLP exports all metrics over OTLP at the collection interval. The
+// endpoint, headers and TLS settings are read from the standard
+// OTEL_EXPORTER_OTLP_* environment variables, and resource attributes from
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES.
+func (e *Exporter) SetOTLP(ctx context.Context, protocol string) error {
+	var exporter sdkmetric.Exporter
+	var err error
+	switch protocol {
+	case OTLPNone:
+		return nil
+	case OTLPGRPC:
+		exporter, err = otlpmetricgrpc.New(ctx)
+	case OTLPHTTP:
+		exporter, err = otlpmetrichttp.New(ctx)
+	default:
+		return fmt.Errorf("unknown OTLP protocol %q", protocol)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	// The registry's metrics are bridged, so OTLP carries exactly what
+	// /metrics serves
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(e.interval),
+		sdkmetric.WithProducer(prometheusbridge.NewMetricProducer(prometheusbridge.WithGatherer(e.registry))),
+	)
+	e.meterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(OTLPResource(ctx)),
+	)
+	return nil
+}
+
+// OTLPResource describes ScaleBee in OTLP exports, with the attributes of
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+func OTLPResource(ctx context.Context) *resource.Resource {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "scalebee")),
+		resource.WithHost(),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		// Partial resources are still usable
+		slog.Warn("OTLP resource detection failed", "error", err)
+	}
+	return res
+}
+
+// ShutdownOTLP sends the last metrics and stops the OTLP export
+func (e *Exporter) ShutdownOTLP(ctx context.Context) {
+	if e.meterProvider == nil {
+		return
+	}
+	if err := e.meterProvider.Shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down OTLP export", "error", err)
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Stats request pacing modes
+const (
+	// PacingNone requests stats of all containers back to back
+	PacingNone = "none"
+	// PacingFixed waits a fixed delay with jitter between requests
+	PacingFixed = "fixed"
+	// PacingAdaptive spreads the requests over most of the collection
+	// interval, so the pace follows the number of containers
+	PacingAdaptive = "adaptive"
+)
+
+// adaptiveSpread is the share of the interval adaptive pacing spreads
+// requests over, leaving room for the requests themselves
+const adaptiveSpread = 0.8
+
+// SetPacing configures how stats requests are spread out to avoid bursts of
+// dockerd CPU. delay is the base delay between requests in fixed mode.
+func (e *Exporter) SetPacing(mode string, delay time.Duration) {
+	e.pacing = mode
+	e.pacingDelay = delay
+}
+
+// pace waits before the next stats request of a collection of n containers.
+// It returns false if the context was cancelled while waiting.
+func (e *Exporter) pace(ctx context.Context, n int) bool {
+	var delay time.Duration
+	switch e.pacing {
+	case PacingFixed:
+		delay = e.pacingDelay
+	case PacingAdaptive:
+		delay = time.Duration(float64(e.interval) * adaptiveSpread / float64(n))
+	}
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	// ±25% jitter keeps exporters on different nodes from synchronizing
+	delay = time.Duration(float64(delay) * (0.75 + rand.Float64()*0.5))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
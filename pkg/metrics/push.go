@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushTimeout bounds a single request to the Pushgateway
+const pushTimeout = 10 * time.Second
+
+// SetPush pushes all metrics to a Prometheus Pushgateway after every
+// collection, grouped by job and instance
+func (e *Exporter) SetPush(url, job, instance string) {
+	e.pushURL = url
+	e.pusher = push.New(url, job).
+		Gatherer(e.registry).
+		Grouping("instance", instance).
+		Client(&http.Client{Timeout: pushTimeout})
+}
+
+// push sends the current metrics to the Pushgateway, replacing the
+// previous push of this instance
+func (e *Exporter) push(ctx context.Context) {
+	if e.pusher == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	if err := e.pusher.PushContext(ctx); err != nil {
+		slog.Error("Failed to push metrics", "url", e.pushURL, "error", err)
+	}
+}
+
+// DeletePush removes this instance's metrics from the Pushgateway, which
+// would otherwise keep exposing them after the exporter is gone
+func (e *Exporter) DeletePush() {
+	if e.pusher == nil {
+		return
+	}
+	if err := e.pusher.Delete(); err != nil {
+		slog.Error("Failed to delete pushed metrics", "url", e.pushURL, "error", err)
+	}
+}
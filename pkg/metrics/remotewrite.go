@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteTimeout bounds a single remote-write request
+const remoteWriteTimeout = 10 * time.Second
+
+// RemoteWriteConfig configures shipping metrics with the Prometheus
+// remote-write protocol
+type RemoteWriteConfig struct {
+	URL string
+	// Job and Instance are added as labels to every series, since no scrape
+	// adds them
+	Job      string
+	Instance string
+	// Username and Password set basic auth, BearerToken a bearer token
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// rwLabel is a label of a remote-write series
+type rwLabel struct {
+	name  string
+	value string
+}
+
+// rwSeries is a remote-write series with a single sample
+type rwSeries struct {
+	labels    []rwLabel
+	value     float64
+	timestamp int64
+}
+
+// SetRemoteWrite sends all metrics to a remote-write endpoint such as Mimir,
+// VictoriaMetrics or Grafana Cloud after every collection
+func (e *Exporter) SetRemoteWrite(cfg RemoteWriteConfig) {
+	e.remoteWrite = &cfg
+	e.remoteWriteClient = &http.Client{Timeout: remoteWriteTimeout}
+}
+
+// writeRemote gathers the current metrics and sends them in one request.
+// Failed requests aren't retried; the next collection sends fresh samples.
+func (e *Exporter) writeRemote(ctx context.Context) {
+	if e.remoteWrite == nil {
+		return
+	}
+
+	families, err := e.registry.Gather()
+	if err != nil {
+		slog.Warn("Failed to gather metrics for remote write", "error", err)
+	}
+
+	extra := []rwLabel{{"job", e.remoteWrite.Job}, {"instance", e.remoteWrite.Instance}}
+	now := time.Now().UnixMilli()
+	var series []rwSeries
+	for _, mf := range families {
+		series = appendFamilySeries(series, mf, extra, now)
+	}
+
+	if err := e.sendRemoteWrite(ctx, encodeWriteRequest(series)); err != nil {
+		slog.Error("Failed to remote-write metrics", "url", e.remoteWrite.URL, "error", err)
+	}
+}
+
+// sendRemoteWrite posts a snappy-compressed WriteRequest
+func (e *Exporter) sendRemoteWrite(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.remoteWrite.URL, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "scalebee")
+	switch {
+	case e.remoteWrite.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+e.remoteWrite.BearerToken)
+	case e.remoteWrite.Username != "":
+		req.SetBasicAuth(e.remoteWrite.Username, e.remoteWrite.Password)
+	}
+
+	resp, err := e.remoteWriteClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// appendFamilySeries converts a metric family to remote-write series.
+// Summaries and histograms are expanded into the series Prometheus would
+// have scraped.
+func appendFamilySeries(series []rwSeries, mf *dto.MetricFamily, extra []rwLabel, now int64) []rwSeries {
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		ts := now
+		if m.TimestampMs != nil {
+			ts = m.GetTimestampMs()
+		}
+
+		add := func(name string, value float64, more ...rwLabel) {
+			labels := make([]rwLabel, 0, len(m.GetLabel())+len(extra)+len(more)+1)
+			labels = append(labels, rwLabel{"__name__", name})
+			for _, l := range m.GetLabel() {
+				labels = append(labels, rwLabel{l.GetName(), l.GetValue()})
+			}
+			labels = append(labels, extra...)
+			labels = append(labels, more...)
+			sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+			series = append(series, rwSeries{labels: labels, value: value, timestamp: ts})
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			add(name, m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			add(name, m.GetGauge().GetValue())
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			for _, q := range s.GetQuantile() {
+				add(name, q.GetValue(), rwLabel{"quantile", formatFloat(q.GetQuantile())})
+			}
+			add(name+"_sum", s.GetSampleSum())
+			add(name+"_count", float64(s.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM:
+			h := m.GetHistogram()
+			for _, b := range h.GetBucket() {
+				add(name+"_bucket", float64(b.GetCumulativeCount()), rwLabel{"le", formatFloat(b.GetUpperBound())})
+			}
+			add(name+"_bucket", float64(h.GetSampleCount()), rwLabel{"le", "+Inf"})
+			add(name+"_sum", h.GetSampleSum())
+			add(name+"_count", float64(h.GetSampleCount()))
+		default:
+			add(name, m.GetUntyped().GetValue())
+		}
+	}
+	return series
+}
+
+// formatFloat formats a quantile or bucket bound as Prometheus does
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes series as a remote-write 1.0 WriteRequest
+// protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []rwSeries) []byte {
+	var buf, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, 1, protowire.Fixed64Type)
+		msg = protowire.AppendFixed64(msg, math.Float64bits(s.value))
+		msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, msg)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
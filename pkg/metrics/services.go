@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServiceMetrics holds the configured resources and replicas of a Swarm service
+type ServiceMetrics struct {
+	ServiceName       string
+	CPULimit          float64
+	CPUReservation    float64
+	MemoryLimit       int64
+	MemoryReservation int64
+	DesiredReplicas   uint64
+	RunningReplicas   uint64
+}
+
+// SetServiceMetrics enables exporting the resources configured in each
+// service's spec and the desired and running replicas of each service. Both
+// require the exporter to run on a manager.
+func (e *Exporter) SetServiceMetrics(resources, replicas bool) {
+	e.serviceResources = resources
+	e.serviceReplicas = replicas
+}
+
+// collectServices reads the configured resources of all services
+func (e *Exporter) collectServices(ctx context.Context) ([]*ServiceMetrics, error) {
+	services, err := e.dockerClient.ServiceList(ctx, e.serviceListOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	result := make([]*ServiceMetrics, 0, len(services))
+	for _, service := range services {
+		m := &ServiceMetrics{ServiceName: service.Spec.Name}
+		if service.ServiceStatus != nil {
+			m.DesiredReplicas = service.ServiceStatus.DesiredTasks
+			m.RunningReplicas = service.ServiceStatus.RunningTasks
+		}
+		if res := service.Spec.TaskTemplate.Resources; res != nil {
+			if res.Limits != nil {
+				m.CPULimit = float64(res.Limits.NanoCPUs) / 1e9
+				m.MemoryLimit = res.Limits.MemoryBytes
+			}
+			if res.Reservations != nil {
+				m.CPUReservation = float64(res.Reservations.NanoCPUs) / 1e9
+				m.MemoryReservation = res.Reservations.MemoryBytes
+			}
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// serviceGauge is a per-service gauge
+type serviceGauge struct {
+	desc  *prometheus.Desc
+	value func(m *ServiceMetrics) float64
+}
+
+// newServiceGauge creates a per-service gauge
+func newServiceGauge(name, help string, value func(m *ServiceMetrics) float64) serviceGauge {
+	return serviceGauge{prometheus.NewDesc(name, help, []string{"service"}, nil), value}
+}
+
+// resourceGauges describe the configured resources. Unset limits and
+// reservations are exported as 0.
+var resourceGauges = []serviceGauge{
+	newServiceGauge("swarm_service_cpu_limit_cores", "CPU limit of the service's tasks in cores (0 when unset)",
+		func(m *ServiceMetrics) float64 { return m.CPULimit }),
+	newServiceGauge("swarm_service_cpu_reservation_cores", "CPU reservation of the service's tasks in cores (0 when unset)",
+		func(m *ServiceMetrics) float64 { return m.CPUReservation }),
+	newServiceGauge("swarm_service_memory_limit_bytes", "Memory limit of the service's tasks in bytes (0 when unset)",
+		func(m *ServiceMetrics) float64 { return float64(m.MemoryLimit) }),
+	newServiceGauge("swarm_service_memory_reservation_bytes", "Memory reservation of the service's tasks in bytes (0 when unset)",
+		func(m *ServiceMetrics) float64 { return float64(m.MemoryReservation) }),
+}
+
+// replicaGauges describe the replica counts. For global services the desired
+// count is the number of eligible nodes.
+var replicaGauges = []serviceGauge{
+	newServiceGauge("swarm_service_desired_replicas", "Number of tasks the service should run",
+		func(m *ServiceMetrics) float64 { return float64(m.DesiredReplicas) }),
+	newServiceGauge("swarm_service_running_replicas", "Number of tasks of the service that are running",
+		func(m *ServiceMetrics) float64 { return float64(m.RunningReplicas) }),
+}
+
+// describeServiceMetrics sends the descriptors of per-service gauges
+func describeServiceMetrics(ch chan<- *prometheus.Desc, gauges []serviceGauge) {
+	for _, g := range gauges {
+		ch <- g.desc
+	}
+}
+
+// collectServiceMetrics sends per-service gauges
+func collectServiceMetrics(ch chan<- prometheus.Metric, gauges []serviceGauge, services []*ServiceMetrics) {
+	for _, g := range gauges {
+		for _, m := range services {
+			ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, g.value(m), m.ServiceName)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Stats collection modes
+const (
+	// StatsModeStream keeps one streaming stats request open per container
+	// and reads the latest sample at each collection
+	StatsModeStream = "stream"
+	// StatsModePoll requests a one-shot stats snapshot per container at each
+	// collection
+	StatsModePoll = "poll"
+)
+
+// statsStream is a long-lived streaming stats request for a container
+type statsStream struct {
+	cancel context.CancelFunc
+	// ready is closed once the first sample arrived, done when the stream ends
+	ready chan struct{}
+	done  chan struct{}
+
+	mu     sync.Mutex
+	latest *container.StatsResponse
+	err    error
+}
+
+// SetStatsMode sets whether container stats are streamed or polled. Pacing
+// and the worker pool only matter for polling.
+func (e *Exporter) SetStatsMode(mode string) {
+	e.statsMode = mode
+}
+
+// streamedStats returns the stats of a container from its stream, opening
+// the stream with the exporter's context if needed. A new stream is given
+// until wait is done to deliver its first sample.
+func (e *Exporter) streamedStats(ctx, wait context.Context, containerID string) (*ContainerStats, error) {
+	s := e.stream(ctx, containerID)
+
+	select {
+	case <-s.ready:
+	case <-s.done:
+	case <-wait.Done():
+		return nil, fmt.Errorf("no stats received yet: %w", wait.Err())
+	}
+
+	s.mu.Lock()
+	latest, err := s.latest, s.err
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		// Reopen the stream at the next collection
+		e.streamsMu.Lock()
+		if e.streams[containerID] == s {
+			delete(e.streams, containerID)
+		}
+		e.streamsMu.Unlock()
+		return nil, fmt.Errorf("stats stream ended: %w", err)
+	default:
+	}
+
+	return e.calculateStats(containerID, latest), nil
+}
+
+// stream returns the open stream of a container, or opens one
+func (e *Exporter) stream(ctx context.Context, containerID string) *statsStream {
+	e.streamsMu.Lock()
+	defer e.streamsMu.Unlock()
+
+	if s, ok := e.streams[containerID]; ok {
+		return s
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &statsStream{
+		cancel: cancel,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	e.streams[containerID] = s
+	go e.readStream(ctx, containerID, s)
+	return s
+}
+
+// readStream keeps the latest sample of a container's stats stream. Docker
+// sends a sample about every second until the container stops.
+func (e *Exporter) readStream(ctx context.Context, containerID string, s *statsStream) {
+	defer close(s.done)
+
+	stats, err := e.dockerClient.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to get container stats: %w", err))
+		return
+	}
+	defer stats.Body.Close()
+
+	decoder := json.NewDecoder(stats.Body)
+	for {
+		var v container.StatsResponse
+		if err := decoder.Decode(&v); err != nil {
+			s.fail(fmt.Errorf("failed to decode stats: %w", err))
+			return
+		}
+
+		s.mu.Lock()
+		first := s.latest == nil
+		s.latest = &v
+		s.mu.Unlock()
+		if first {
+			close(s.ready)
+		}
+	}
+}
+
+// fail records why a stream ended
+func (s *statsStream) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// closeStreams closes the streams of containers that are not in keep
+func (e *Exporter) closeStreams(keep map[string]bool) {
+	e.streamsMu.Lock()
+	defer e.streamsMu.Unlock()
+
+	for id, s := range e.streams {
+		if !keep[id] {
+			s.cancel()
+			delete(e.streams, id)
+		}
+	}
+}
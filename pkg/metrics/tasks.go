@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// TaskHealth holds the health and restart history of a task
+type TaskHealth struct {
+	ServiceName string
+	TaskName    string
+	ContainerID string
+	Healthy     bool
+	// Restarts is the number of failed tasks in the same slot, within
+	// Swarm's task history retention. HasRestarts is false when the task
+	// list is unavailable, e.g. on worker nodes.
+	Restarts    int
+	HasRestarts bool
+	// Labels are the values of the configured extra metric labels
+	Labels []string
+}
+
+// containerHealthy reports whether a container passes its healthcheck.
+// Containers without a healthcheck count as healthy, containers whose
+// healthcheck hasn't passed yet do not.
+func containerHealthy(status string) bool {
+	return !strings.Contains(status, "(unhealthy)") && !strings.Contains(status, "(health: starting)")
+}
+
+// slotRestarts counts failed tasks per service slot and maps running task
+// containers to their count. Swarm never restarts a container in place, it
+// replaces the task, so failed tasks in a slot are the task's restarts.
+func (e *Exporter) slotRestarts(ctx context.Context) (map[string]int, error) {
+	tasks, err := e.dockerClient.TaskList(ctx, swarm.TaskListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	failed := make(map[string]int)
+	for _, t := range tasks {
+		if t.Status.State == swarm.TaskStateFailed {
+			failed[slotKey(t)]++
+		}
+	}
+
+	restarts := make(map[string]int)
+	for _, t := range tasks {
+		if t.Status.ContainerStatus != nil && t.Status.ContainerStatus.ContainerID != "" {
+			restarts[t.Status.ContainerStatus.ContainerID] = failed[slotKey(t)]
+		}
+	}
+	return restarts, nil
+}
+
+// slotKey identifies a replicated task slot, or a global task's node
+func slotKey(t swarm.Task) string {
+	if t.Slot == 0 {
+		return t.ServiceID + "/" + t.NodeID
+	}
+	return fmt.Sprintf("%s/%d", t.ServiceID, t.Slot)
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats collection defaults
+const (
+	// DefaultStatsWorkers is the default number of concurrent stats requests
+	DefaultStatsWorkers = 4
+	// DefaultStatsTimeout is the default timeout of a single stats request
+	DefaultStatsTimeout = 5 * time.Second
+)
+
+// statsJob is a container whose stats are read during a collection
+type statsJob struct {
+	containerID string
+	metrics     *ContainerMetrics
+	ok          bool
+}
+
+// SetWorkers configures how many stats requests run concurrently and how long
+// a single request may take. dockerd needs about a second per stats request,
+// so a sequential collection can't keep up with many containers.
+func (e *Exporter) SetWorkers(workers int, timeout time.Duration) {
+	e.workers = workers
+	e.statsTimeout = timeout
+}
+
+// collectStats reads the stats of all jobs with a bounded worker pool and
+// returns how many requests failed. Pacing applies to dispatching the
+// requests, so a slow container delays neither the pace nor the others.
+// Streamed stats are read from memory and never paced.
+func (e *Exporter) collectStats(ctx context.Context, jobs []*statsJob, reservations map[string]int64) int {
+	var failures atomic.Int64
+	queue := make(chan *statsJob)
+
+	var wg sync.WaitGroup
+	for range min(e.workers, len(jobs)) {
+		wg.Go(func() {
+			for job := range queue {
+				if !e.readStats(ctx, job, reservations) {
+					failures.Add(1)
+				}
+			}
+		})
+	}
+
+	for i, job := range jobs {
+		if i > 0 && e.statsMode == StatsModePoll && !e.pace(ctx, len(jobs)) {
+			break
+		}
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return int(failures.Load())
+}
+
+// readStats fills in the metrics of a job, and reports whether it succeeded
+func (e *Exporter) readStats(ctx context.Context, job *statsJob, reservations map[string]int64) bool {
+	requestCtx, cancel := context.WithTimeout(ctx, e.statsTimeout)
+	defer cancel()
+
+	var stats *ContainerStats
+	var err error
+	if e.statsMode == StatsModeStream {
+		// The stream outlives this collection, only the wait is bounded
+		stats, err = e.streamedStats(ctx, requestCtx, job.containerID)
+	} else {
+		stats, err = e.getContainerStats(requestCtx, job.containerID)
+	}
+	if err != nil {
+		slog.Warn("Failed to get container stats", "container", job.containerID[:12], "error", err)
+		return false
+	}
+
+	m := job.metrics
+	m.CPUPercentage = e.relativeCPU(requestCtx, stats.CPUPercentage, job.containerID, m.ServiceName, reservations)
+	m.MemoryUsageMB = stats.MemoryUsageMB
+	m.MemoryWorkingSetMB = stats.MemoryWorkingSetMB
+	m.CPUUsageSeconds = stats.CPUUsageSeconds
+	m.MemoryWorkingSetBytes = stats.MemoryWorkingSetBytes
+	m.MemoryLimitMB = stats.MemoryLimitMB
+	m.LastUpdate = time.Now()
+	job.ok = true
+	return true
+}
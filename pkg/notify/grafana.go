@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/events"
+)
+
+// GrafanaNotifier posts events of the event bus as annotations to the
+// Grafana HTTP API
+type GrafanaNotifier struct {
+	baseURL      string
+	token        string
+	dashboardUID string
+	tags         []string
+	client       *http.Client
+}
+
+// grafanaAnnotation is the request body of POST /api/annotations
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// NewGrafanaNotifier creates a notifier that writes Grafana annotations.
+// Without a dashboard UID the annotations are organization-wide and can be
+// matched by tags from any dashboard.
+func NewGrafanaNotifier(baseURL, token, dashboardUID string, tags []string) *GrafanaNotifier {
+	return &GrafanaNotifier{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		dashboardUID: dashboardUID,
+		tags:         tags,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Annotate creates an annotation for an event of the event bus, tagged
+// with its service, cluster, direction and reason so dashboards can filter
+// scaling actions. It is an events.Handler and the only way annotations are
+// written; failures are logged.
+func (g *GrafanaNotifier) Annotate(ctx context.Context, event events.Event) {
+	tags := append([]string{"scalebee"}, g.tags...)
+	for _, tag := range []string{event.Service, event.Cluster, event.Direction, event.Reason} {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if event.Critical {
+		tags = append(tags, "critical")
+	}
+	if event.Vertical {
+		tags = append(tags, "vertical")
+	}
+
+	if err := g.post(ctx, event.Time, event.Message, tags); err != nil {
+		slog.Warn("Failed to send Grafana annotation", "service", event.Service, "error", err)
+	}
+}
+
+// post creates an annotation
+func (g *GrafanaNotifier) post(ctx context.Context, at time.Time, text string, tags []string) error {
+	body, err := json.Marshal(grafanaAnnotation{
+		DashboardUID: g.dashboardUID,
+		Time:         at.UnixMilli(),
+		Tags:         tags,
+		Text:         text,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode annotation: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.baseURL+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send annotation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("grafana returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
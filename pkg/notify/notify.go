@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Event represents a notification about an autoscaling action
+type Event struct {
+	Service  string    `json:"service,omitempty"`
+	Message  string    `json:"message"`
+	Critical bool      `json:"critical"`
+	Time     time.Time `json:"time"`
+
+	// Scaling details, set for scaling actions
+	Reason       string `json:"reason,omitempty"`
+	Direction    string `json:"direction,omitempty"`
+	FromReplicas uint64 `json:"from_replicas,omitempty"`
+	ToReplicas   uint64 `json:"to_replicas,omitempty"`
+
+	// Latest service metrics and the cluster ScaleBee runs in
+	CPUPercent    float64 `json:"cpu_percent,omitempty"`
+	MemoryPercent float64 `json:"memory_percent,omitempty"`
+	Cluster       string  `json:"cluster,omitempty"`
+
+	// ProposalID is set for actions waiting for manual approval
+	ProposalID string `json:"proposal_id,omitempty"`
+	// RunID identifies the reconcile run that decided the action
+	RunID string `json:"run_id,omitempty"`
+}
+
+// Notifier delivers events to a notification channel
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// WebhookNotifier posts events as JSON to an HTTP endpoint
+type WebhookNotifier struct {
+	url         string
+	client      *http.Client
+	template    *template.Template
+	contentType string
+}
+
+// webhookPayload is the JSON body sent to webhooks. The text field makes it
+// directly compatible with Slack and Mattermost incoming webhooks.
+type webhookPayload struct {
+	Text string `json:"text"`
+	Event
+}
+
+// NewWebhookNotifier creates a notifier that posts to the given URL
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetTemplate replaces the default JSON payload with the output of tmpl,
+// sent with the given content type
+func (w *WebhookNotifier) SetTemplate(tmpl *template.Template, contentType string) {
+	w.template = tmpl
+	w.contentType = contentType
+}
+
+// body renders the request body for an event
+func (w *WebhookNotifier) body(event Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(webhookPayload{Text: event.Message, Event: event})
+	}
+
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Notify sends the event to the webhook
+func (w *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := w.body(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	contentType := "application/json"
+	if w.contentType != "" {
+		contentType = w.contentType
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// Multi fans out events to several notifiers
+type Multi []Notifier
+
+// Notify sends the event to every notifier, returning the first error
+func (m Multi) Notify(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// QueueSize is the number of events a Queue holds before dropping new ones
+const QueueSize = 100
+
+// ErrQueueFull is returned for events dropped because the queue is full
+var ErrQueueFull = errors.New("notification queue is full")
+
+// Queue delivers events to a notifier in the background, so a slow channel
+// doesn't hold up the reconcile loop. Events beyond QueueSize are dropped.
+type Queue struct {
+	next   Notifier
+	events chan queuedEvent
+}
+
+// queuedEvent is an event with the context it was sent with
+type queuedEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// NewQueue wraps a notifier so events are delivered by Start
+func NewQueue(next Notifier) *Queue {
+	return &Queue{
+		next:   next,
+		events: make(chan queuedEvent, QueueSize),
+	}
+}
+
+// Notify queues the event; it fails only when the queue is full
+func (q *Queue) Notify(ctx context.Context, event Event) error {
+	select {
+	case q.events <- queuedEvent{ctx: context.WithoutCancel(ctx), event: event}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start delivers queued events until the context is cancelled, then sends
+// what is left for up to 10 seconds
+func (q *Queue) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				select {
+				case e := <-q.events:
+					if time.Now().After(deadline) {
+						slog.Error("Dropping notifications left after shutdown", "count", len(q.events)+1)
+						return
+					}
+					q.send(e)
+				default:
+					return
+				}
+			}
+		case e := <-q.events:
+			q.send(e)
+		}
+	}
+}
+
+// send delivers one queued event; failures are logged
+func (q *Queue) send(e queuedEvent) {
+	if err := q.next.Notify(e.ctx, e.event); err != nil {
+		slog.Warn("Failed to send notification", "service", e.event.Service, "error", err)
+	}
+}
+
+// Digest batches routine events into one summarized notification per window.
+// Critical events bypass the batch and are delivered immediately.
+type Digest struct {
+	next    Notifier
+	window  time.Duration
+	mu      sync.Mutex
+	pending []Event
+}
+
+// NewDigest wraps a notifier so routine events are sent once per window
+func NewDigest(next Notifier, window time.Duration) *Digest {
+	return &Digest{
+		next:   next,
+		window: window,
+	}
+}
+
+// Notify queues routine events and forwards critical ones right away
+func (d *Digest) Notify(ctx context.Context, event Event) error {
+	if event.Critical {
+		return d.next.Notify(ctx, event)
+	}
+
+	d.mu.Lock()
+	d.pending = append(d.pending, event)
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Start flushes the digest every window until the context is cancelled
+func (d *Digest) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Send whatever is left before exiting
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := d.Flush(flushCtx); err != nil {
+				slog.Error("Failed to flush notification digest", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := d.Flush(ctx); err != nil {
+				slog.Error("Failed to flush notification digest", "error", err)
+			}
+		}
+	}
+}
+
+// Flush sends all queued events as a single summary notification
+func (d *Digest) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	events := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("ScaleBee digest: %d scaling events in the last %v\n", len(events), d.window))
+	for _, e := range events {
+		sb.WriteString(fmt.Sprintf("- %s %s\n", e.Time.Format(time.TimeOnly), e.Message))
+	}
+
+	return d.next.Notify(ctx, Event{
+		Message: strings.TrimSuffix(sb.String(), "\n"),
+		Time:    time.Now(),
+	})
+}
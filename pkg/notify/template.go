@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available in webhook templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {{ json .Message }} for a quoted string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// LoadTemplate parses a webhook body template from a file. Templates are
+// executed with the Event, so fields like {{ .Service }} and {{ .Reason }}
+// are available.
+func LoadTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook template: %w", err)
+	}
+
+	tmpl, err := template.New("webhook").Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook template %s: %w", path, err)
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,229 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// Probe statuses
+const (
+	StatusRunning = "running"
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+)
+
+// ErrRunning is returned when a probe is started while another one runs
+var ErrRunning = errors.New("a probe is already running")
+
+// Config configures the synthetic load probe
+type Config struct {
+	// Service is the designated test service load is generated in
+	Service string
+	// LoadDuration is how long CPU load is generated
+	LoadDuration time.Duration
+	// Timeout bounds the scale-down phase after the load has stopped. The
+	// scale-up has to happen while the load runs.
+	Timeout time.Duration
+	// PollInterval is how often the replica count is checked
+	PollInterval time.Duration
+}
+
+// Result is the outcome of a probe run
+type Result struct {
+	Service          string    `json:"service"`
+	Status           string    `json:"status"`
+	Phase            string    `json:"phase,omitempty"`
+	Message          string    `json:"message,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at,omitempty"`
+	BaselineReplicas uint64    `json:"baseline_replicas"`
+	PeakReplicas     uint64    `json:"peak_replicas"`
+	LoadedTasks      int       `json:"loaded_tasks"`
+}
+
+// Probe generates CPU load in a test service and verifies that it is scaled
+// up and back down
+type Probe struct {
+	config         Config
+	serviceManager *docker.ServiceManager
+	// lifetime is cancelled by Close, stopping a running probe
+	lifetime context.Context
+	stop     context.CancelFunc
+
+	mu     sync.Mutex
+	result *Result
+}
+
+// New creates a probe for the configured test service
+func New(config Config, serviceManager *docker.ServiceManager) *Probe {
+	if config.LoadDuration == 0 {
+		config.LoadDuration = 5 * time.Minute
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Minute
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = 10 * time.Second
+	}
+
+	p := &Probe{
+		config:         config,
+		serviceManager: serviceManager,
+	}
+	p.lifetime, p.stop = context.WithCancel(context.Background())
+	return p
+}
+
+// Close stops a running probe, e.g. on shutdown
+func (p *Probe) Close() {
+	p.stop()
+}
+
+// Result returns the current or last probe result, nil if none ran yet
+func (p *Probe) Result() *Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.result == nil {
+		return nil
+	}
+	result := *p.result
+	return &result
+}
+
+// Start runs a probe in the background until it finishes or the probe is
+// closed. It outlives ctx, e.g. the request that started it, but keeps its
+// values.
+func (p *Probe) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.result != nil && p.result.Status == StatusRunning {
+		return ErrRunning
+	}
+	p.result = &Result{
+		Service:   p.config.Service,
+		Status:    StatusRunning,
+		Phase:     "starting",
+		StartedAt: time.Now(),
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(p.lifetime, cancel)
+	go func() {
+		defer stop()
+		defer cancel()
+		p.run(runCtx)
+	}()
+	return nil
+}
+
+// run generates load, then waits for the service to scale up and back down
+func (p *Probe) run(ctx context.Context) {
+	slog.Info("Probe: starting load test", "service", p.config.Service)
+
+	config, err := p.serviceManager.GetServiceConfig(ctx, p.config.Service)
+	if err != nil {
+		p.finish(StatusFailed, err.Error())
+		return
+	}
+	if !config.AutoscaleEnabled {
+		p.finish(StatusFailed, fmt.Sprintf("service %s does not have autoscaling enabled", p.config.Service))
+		return
+	}
+	baseline := config.DesiredReplicas
+
+	// Busy-loop one CPU per task until the load duration has passed
+	seconds := strconv.Itoa(int(p.config.LoadDuration.Seconds()))
+	cmd := []string{"timeout", seconds, "sh", "-c", "while :; do :; done"}
+	loaded, err := p.serviceManager.ExecInServiceTasks(ctx, p.config.Service, cmd)
+	if err != nil {
+		p.finish(StatusFailed, err.Error())
+		return
+	}
+	if loaded == 0 {
+		p.finish(StatusFailed, "no local tasks to generate load in")
+		return
+	}
+
+	p.update(func(r *Result) {
+		r.Phase = "scale_up"
+		r.BaselineReplicas = baseline
+		r.PeakReplicas = baseline
+		r.LoadedTasks = loaded
+	})
+
+	if err := p.waitFor(ctx, p.config.LoadDuration, func(replicas uint64) bool { return replicas > baseline }); err != nil {
+		p.finish(StatusFailed, fmt.Sprintf("service did not scale up above %d replicas: %v", baseline, err))
+		return
+	}
+	slog.Info("Probe: service scaled up, waiting for scale-down", "service", p.config.Service)
+
+	p.update(func(r *Result) { r.Phase = "scale_down" })
+
+	// Scale-down can only start once the load has stopped
+	if err := p.waitFor(ctx, p.config.LoadDuration+p.config.Timeout, func(replicas uint64) bool { return replicas <= baseline }); err != nil {
+		p.finish(StatusFailed, fmt.Sprintf("service did not scale back down to %d replicas: %v", baseline, err))
+		return
+	}
+
+	p.finish(StatusPassed, "service scaled up under load and back down afterwards")
+}
+
+// waitFor polls the desired replica count until done reports true or the
+// timeout passes
+func (p *Probe) waitFor(ctx context.Context, timeout time.Duration, done func(replicas uint64) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		config, err := p.serviceManager.GetServiceConfig(ctx, p.config.Service)
+		if err != nil {
+			slog.Warn("Probe: failed to read replicas, retrying", "service", p.config.Service, "error", err)
+			continue
+		}
+
+		p.update(func(r *Result) {
+			if config.DesiredReplicas > r.PeakReplicas {
+				r.PeakReplicas = config.DesiredReplicas
+			}
+		})
+		if done(config.DesiredReplicas) {
+			return nil
+		}
+	}
+}
+
+// update applies fn to the current result under the lock
+func (p *Probe) update(fn func(r *Result)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p.result)
+}
+
+// finish records the final status of the current run
+func (p *Probe) finish(status, message string) {
+	slog.Info("Probe finished", "service", p.config.Service, "status", status, "message", message)
+	p.update(func(r *Result) {
+		r.Status = status
+		r.Phase = ""
+		r.Message = message
+		r.FinishedAt = time.Now()
+	})
+}
@@ -0,0 +1,121 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrCircuitOpen is returned by queries while the circuit breaker of a
+// client is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// maxCooldownFactor caps how far the cooldown grows while Prometheus keeps
+// failing
+const maxCooldownFactor = 8
+
+// CircuitStatus describes the circuit breaker of a Prometheus client
+type CircuitStatus struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"consecutive_failures"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+}
+
+// breaker stops queries to a failing Prometheus for a while
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state     string
+	failures  int
+	backoff   time.Duration
+	openUntil time.Time
+}
+
+// SetCircuitBreaker stops querying for the cooldown after the given number
+// of consecutive failed queries. Queries fail with ErrCircuitOpen meanwhile.
+// When the cooldown is over, the next query decides: a success closes the
+// circuit, a failure opens it again for twice as long. Zero failures
+// disables the breaker.
+func (c *Client) SetCircuitBreaker(failures int, cooldown time.Duration) {
+	c.breaker = breaker{threshold: failures, cooldown: cooldown, state: CircuitClosed}
+}
+
+// Circuit returns the status of the circuit breaker
+func (c *Client) Circuit() CircuitStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.breaker.state
+	if state == "" {
+		state = CircuitClosed
+	}
+	return CircuitStatus{State: state, Failures: c.breaker.failures, OpenUntil: c.breaker.openUntil}
+}
+
+// allow reports whether a query may be sent, moving an open circuit to
+// half-open once its cooldown is over
+func (c *Client) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.breaker
+	if b.state != CircuitOpen {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return fmt.Errorf("%w, retrying in %v", ErrCircuitOpen, wait.Round(time.Second))
+	}
+	b.state = CircuitHalfOpen
+	return nil
+}
+
+// trip records the result of a query, opening or closing the circuit
+func (c *Client) trip(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.breaker
+	if b.threshold <= 0 {
+		return
+	}
+
+	if err == nil {
+		if b.state != CircuitClosed {
+			slog.Info("Prometheus answered again, closing the circuit breaker", "url", c.URLs())
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		b.backoff = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == CircuitOpen:
+		// A concurrent query already opened it
+		return
+	case b.state == CircuitHalfOpen:
+		b.backoff *= 2
+		if limit := b.cooldown * maxCooldownFactor; b.backoff > limit {
+			b.backoff = limit
+		}
+	case b.failures >= b.threshold:
+		b.backoff = b.cooldown
+	default:
+		return
+	}
+	b.state = CircuitOpen
+	b.openUntil = time.Now().Add(b.backoff)
+	slog.Warn("Prometheus keeps failing, pausing queries",
+		"url", c.URLs(), "failures", b.failures, "backoff", b.backoff, "error", err)
+}
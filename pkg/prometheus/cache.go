@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// cachedResponse is a query result kept until it expires
+type cachedResponse struct {
+	vector  model.Vector
+	expires time.Time
+}
+
+// SetCacheTTL caches query results for the given time, keyed by query, so
+// evaluations in quick succession don't send duplicate queries. Zero
+// disables the cache.
+func (c *Client) SetCacheTTL(ttl time.Duration) {
+	c.cacheTTL = ttl
+	c.cache = make(map[string]cachedResponse)
+}
+
+// cached returns the unexpired result of a query
+func (c *Client) cached(query string) (model.Vector, bool) {
+	if c.cacheTTL <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[query]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.vector, true
+}
+
+// store caches a query result and drops expired ones
+func (c *Client) store(query string, vector model.Vector) {
+	if c.cacheTTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for q, entry := range c.cache {
+		if now.After(entry.expires) {
+			delete(c.cache, q)
+		}
+	}
+	c.cache[query] = cachedResponse{vector: vector, expires: now.Add(c.cacheTTL)}
+}
+
+// ClearCache drops all cached query results
+func (c *Client) ClearCache() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.cache)
+}
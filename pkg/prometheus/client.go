@@ -2,21 +2,39 @@ package prometheus
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
-	"strconv"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Client represents a Prometheus API client
+// Memory usage metrics
+const (
+	// MemoryWorkingSet excludes inactive page cache
+	MemoryWorkingSet = "container_memory_working_set_mb"
+	// MemoryUsage includes page cache, which inflates memory percentages
+	MemoryUsage = "container_memory_usage_mb"
+)
+
+// Client represents a Prometheus API client. With several URLs, e.g. an HA
+// pair, queries fail over to the next URL when the active one fails.
 type Client struct {
-	baseURL string
-	client  *http.Client
+	urls         []*backend
+	client       *http.Client
+	warmup       time.Duration
+	memoryMetric string
+	// matchers are added to every series selector
+	matchers string
+
+	// mu guards active, the cache and the breaker
+	mu       sync.Mutex
+	active   int
+	cacheTTL time.Duration
+	cache    map[string]cachedResponse
+	breaker  breaker
 }
 
 // ServiceMetric represents CPU and memory metrics for a Docker service
@@ -26,48 +44,78 @@ type ServiceMetric struct {
 	MemoryPercent float64
 }
 
-// PrometheusResponse represents the structure of Prometheus query API response
-type prometheusResponse struct {
-	Status string `json:"status"`
-	Data   struct {
-		ResultType string `json:"resultType"`
-		Result     []struct {
-			Metric map[string]string `json:"metric"`
-			Value  []interface{}     `json:"value"`
-		} `json:"result"`
-	} `json:"data"`
-}
-
-// NewClient creates a new Prometheus client
+// NewClient creates a new Prometheus client. baseURL may list several
+// Prometheus URLs separated by commas or "|", which are failed over in order.
 func NewClient(baseURL string) *Client {
 	return &Client{
-		baseURL: baseURL,
-		client:  &http.Client{Timeout: 10 * time.Second},
+		urls:         newBackends(baseURL),
+		client:       &http.Client{Timeout: DefaultTimeout, Transport: measured(http.DefaultTransport)},
+		memoryMetric: MemoryWorkingSet,
 	}
 }
 
-// WaitForPrometheus waits for Prometheus to be ready with exponential backoff
+// SetMemoryMetric selects the memory usage metric services are scaled on,
+// MemoryWorkingSet or MemoryUsage
+func (c *Client) SetMemoryMetric(metric string) {
+	c.memoryMetric = metric
+}
+
+// SetWarmup excludes containers younger than the given duration from the
+// service averages. It requires the container_start_time_seconds metric.
+func (c *Client) SetWarmup(warmup time.Duration) {
+	c.warmup = warmup
+}
+
+// matchersPattern matches a comma-separated list of PromQL label matchers
+var matchersPattern = regexp.MustCompile(`^\s*(?:[a-zA-Z_][a-zA-Z0-9_]*\s*(?:=|!=|=~|!~)\s*"(?:[^"\\]|\\.)*"\s*(?:,\s*|$))+$`)
+
+// SetMatchers adds label matchers such as `cluster="prod",env="eu"` to every
+// query, so a Prometheus shared by several clusters only returns this
+// cluster's series. Surrounding braces are optional.
+func (c *Client) SetMatchers(matchers string) error {
+	matchers = strings.TrimSpace(matchers)
+	matchers = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(matchers, "{"), "}"))
+	if matchers != "" && !matchersPattern.MatchString(matchers) {
+		return fmt.Errorf("invalid label matchers %q, expected e.g. cluster=\"prod\",env=~\"eu-.*\"", matchers)
+	}
+	c.matchers = strings.TrimSuffix(strings.TrimSpace(matchers), ",")
+	return nil
+}
+
+// selector returns the series selector of a metric with the configured
+// matchers
+func (c *Client) selector(metric string) string {
+	if c.matchers == "" {
+		return metric
+	}
+	return metric + "{" + c.matchers + "}"
+}
+
+// series returns the selector for a container metric, filtered to containers
+// past their warm-up period when one is configured
+func (c *Client) series(metric string) string {
+	if c.warmup <= 0 {
+		return c.selector(metric)
+	}
+	return fmt.Sprintf("(%s and on(container_id) (time() - %s > %d))",
+		c.selector(metric), c.selector("container_start_time_seconds"), int(c.warmup.Seconds()))
+}
+
+// WaitForPrometheus waits for Prometheus to be ready with exponential
+// backoff. With several URLs the first ready one becomes active.
 func (c *Client) WaitForPrometheus(ctx context.Context, maxRetries int) error {
-	log.Printf("Waiting for Prometheus at %s to be ready...", c.baseURL)
+	slog.Info("Waiting for Prometheus to be ready", "url", c.URLs())
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Try to query Prometheus
-		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/-/ready", c.baseURL), nil)
-		if err == nil {
-			resp, err := c.client.Do(req)
-			if err == nil {
-				resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
-					log.Printf("Prometheus is ready")
-					return nil
-				}
-			}
+		if c.ready(ctx) {
+			slog.Info("Prometheus is ready")
+			return nil
 		}
 
 		if attempt < maxRetries {
 			// Exponential backoff: 2, 4, 8, 16, 32 seconds (max 32s)
 			waitTime := time.Duration(min(1<<uint(attempt), 32)) * time.Second
-			log.Printf("Prometheus not ready (attempt %d/%d), retrying in %v...", attempt, maxRetries, waitTime)
+			slog.Info("Prometheus not ready, retrying", "attempt", attempt, "retries", maxRetries, "wait", waitTime)
 
 			select {
 			case <-ctx.Done():
@@ -91,69 +139,24 @@ func min(a, b int) int {
 func (c *Client) GetServiceCPUMetrics(ctx context.Context) ([]ServiceMetric, error) {
 	// Build Prometheus query to get CPU metrics per service
 	// Using the new metric format from ScaleBee metrics exporter
-	query := `avg(container_cpu_usage_percent) BY (service)`
-
-	// Build the URL
-	apiURL := fmt.Sprintf("%s/api/v1/query", c.baseURL)
-	params := url.Values{}
-	params.Add("query", query)
-
-	fullURL := fmt.Sprintf("%s?%s", apiURL, params.Encode())
+	query := fmt.Sprintf(`avg(%s) BY (service)`, c.series("container_cpu_usage_percent"))
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	vector, err := c.query(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Execute request
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("prometheus returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var promResp prometheusResponse
-	if err := json.NewDecoder(resp.Body).Decode(&promResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if promResp.Status != "success" {
-		return nil, fmt.Errorf("prometheus query failed with status: %s", promResp.Status)
+		return nil, err
 	}
 
 	// Extract metrics
 	metrics := make([]ServiceMetric, 0)
-	for _, result := range promResp.Data.Result {
-		serviceName, ok := result.Metric["service"]
-		if !ok {
-			continue
-		}
-
-		// The value is [timestamp, "value_as_string"]
-		if len(result.Value) < 2 {
-			continue
-		}
-
-		cpuStr, ok := result.Value[1].(string)
-		if !ok {
-			continue
-		}
-
-		cpuPercent, err := strconv.ParseFloat(cpuStr, 64)
-		if err != nil {
+	for _, sample := range vector {
+		serviceName := string(sample.Metric["service"])
+		if serviceName == "" {
 			continue
 		}
 
 		metrics = append(metrics, ServiceMetric{
 			ServiceName: serviceName,
-			CPUPercent:  cpuPercent,
+			CPUPercent:  float64(sample.Value),
 		})
 	}
 
@@ -164,62 +167,23 @@ func (c *Client) GetServiceCPUMetrics(ctx context.Context) ([]ServiceMetric, err
 func (c *Client) GetServiceMemoryMetrics(ctx context.Context) (map[string]float64, error) {
 	// Query for memory usage percentage per service
 	// Calculate as (memory_usage / memory_limit) * 100
-	query := `(avg(container_memory_usage_mb) BY (service) / avg(container_memory_limit_mb) BY (service)) * 100`
-
-	apiURL := fmt.Sprintf("%s/api/v1/query", c.baseURL)
-	params := url.Values{}
-	params.Add("query", query)
-
-	fullURL := fmt.Sprintf("%s?%s", apiURL, params.Encode())
+	query := fmt.Sprintf(`(avg(%s) BY (service) / avg(%s) BY (service)) * 100`,
+		c.series(c.memoryMetric), c.series("container_memory_limit_mb"))
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	vector, err := c.query(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("prometheus returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var promResp prometheusResponse
-	if err := json.NewDecoder(resp.Body).Decode(&promResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if promResp.Status != "success" {
-		return nil, fmt.Errorf("prometheus query failed with status: %s", promResp.Status)
+		return nil, err
 	}
 
 	// Extract memory metrics into a map
 	memoryMetrics := make(map[string]float64)
-	for _, result := range promResp.Data.Result {
-		serviceName, ok := result.Metric["service"]
-		if !ok {
-			continue
-		}
-
-		if len(result.Value) < 2 {
-			continue
-		}
-
-		memoryStr, ok := result.Value[1].(string)
-		if !ok {
-			continue
-		}
-
-		memoryPercent, err := strconv.ParseFloat(memoryStr, 64)
-		if err != nil {
+	for _, sample := range vector {
+		serviceName := string(sample.Metric["service"])
+		if serviceName == "" {
 			continue
 		}
 
-		memoryMetrics[serviceName] = memoryPercent
+		memoryMetrics[serviceName] = float64(sample.Value)
 	}
 
 	return memoryMetrics, nil
@@ -264,3 +228,19 @@ func (c *Client) GetServiceMetrics(ctx context.Context) ([]ServiceMetric, map[st
 
 	return cpuMetrics, memoryMetrics, nil
 }
+
+// QueryValue runs a query and returns the sum of its samples, e.g. the
+// length of a queue. An empty result is 0, since exporters often drop
+// series of empty queues.
+func (c *Client) QueryValue(ctx context.Context, query string) (float64, error) {
+	vector, err := c.query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for _, sample := range vector {
+		sum += float64(sample.Value)
+	}
+	return sum, nil
+}
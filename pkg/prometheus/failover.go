@@ -0,0 +1,259 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// URLHealth describes the health of one URL of a Prometheus endpoint
+type URLHealth struct {
+	URL                 string    `json:"url"`
+	Active              bool      `json:"active"`
+	Healthy             bool      `json:"healthy"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// backend is one URL of a client with its health
+type backend struct {
+	url    string
+	health URLHealth
+}
+
+// newBackends splits a list of URLs separated by commas or "|"
+func newBackends(list string) []*backend {
+	var backends []*backend
+	for _, u := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '|' }) {
+		u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		backends = append(backends, &backend{url: u, health: URLHealth{URL: u, Healthy: true}})
+	}
+	if len(backends) == 0 {
+		// Requests fail with a clear error instead of a panic
+		backends = append(backends, &backend{url: list, health: URLHealth{URL: list, Healthy: true}})
+	}
+	return backends
+}
+
+// URLs returns the configured URLs, separated by commas
+func (c *Client) URLs() string {
+	urls := make([]string, len(c.urls))
+	for i, b := range c.urls {
+		urls[i] = b.url
+	}
+	return strings.Join(urls, ",")
+}
+
+// ActiveURL returns the URL queries are currently sent to
+func (c *Client) ActiveURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.urls[c.active].url
+}
+
+// URLHealth returns the health of every URL of the client
+func (c *Client) URLHealth() []URLHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	health := make([]URLHealth, len(c.urls))
+	for i, b := range c.urls {
+		health[i] = b.health
+		health[i].Active = i == c.active
+	}
+	return health
+}
+
+// order returns the indexes of the URLs to try, the active one first
+func (c *Client) order() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	order := make([]int, 0, len(c.urls))
+	for i := range c.urls {
+		order = append(order, (c.active+i)%len(c.urls))
+	}
+	return order
+}
+
+// record updates the health of a URL. A successful URL becomes active and
+// stays active until it fails, so queries don't flap between HA replicas.
+func (c *Client) record(i int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := &c.urls[i].health
+	if err != nil {
+		h.Healthy = false
+		h.LastError = err.Error()
+		h.ConsecutiveFailures++
+		return
+	}
+
+	h.Healthy = true
+	h.LastError = ""
+	h.LastSuccess = time.Now()
+	h.ConsecutiveFailures = 0
+	if c.active != i {
+		slog.Warn("Prometheus failed over", "from", c.urls[c.active].url, "to", c.urls[i].url)
+		c.active = i
+	}
+}
+
+// query runs an instant query and returns its vector result. Results are
+// served from the cache while fresh.
+func (c *Client) query(ctx context.Context, query string) (model.Vector, error) {
+	if vector, ok := c.cached(query); ok {
+		return vector, nil
+	}
+
+	var vector model.Vector
+	err := c.do(ctx, func(api v1.API) error {
+		value, warnings, err := api.Query(ctx, query, time.Now())
+		if err != nil {
+			return fmt.Errorf("prometheus query failed: %w", err)
+		}
+		logWarnings(query, warnings)
+
+		var ok bool
+		if vector, ok = value.(model.Vector); !ok {
+			return fmt.Errorf("prometheus query returned %T instead of a vector", value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(query, vector)
+	return vector, nil
+}
+
+// QueryRange runs a range query, e.g. to graph or profile a service over
+// time. It fails over between URLs like all other queries but isn't cached.
+func (c *Client) QueryRange(ctx context.Context, query string, r v1.Range) (model.Matrix, error) {
+	var matrix model.Matrix
+	err := c.do(ctx, func(api v1.API) error {
+		value, warnings, err := api.QueryRange(ctx, query, r)
+		if err != nil {
+			return fmt.Errorf("prometheus range query failed: %w", err)
+		}
+		logWarnings(query, warnings)
+
+		var ok bool
+		if matrix, ok = value.(model.Matrix); !ok {
+			return fmt.Errorf("prometheus range query returned %T instead of a matrix", value)
+		}
+		return nil
+	})
+	return matrix, err
+}
+
+// do sends a request to the active URL, failing over to the next URL on
+// errors, unless the circuit breaker is open
+func (c *Client) do(ctx context.Context, request func(api v1.API) error) error {
+	if err := c.allow(); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, i := range c.order() {
+		api, err := c.api(c.urls[i].url)
+		if err == nil {
+			err = request(api)
+		}
+		if ctx.Err() != nil {
+			// A cancelled query says nothing about the URL
+			return err
+		}
+		c.record(i, err)
+		if err == nil {
+			c.trip(nil)
+			return nil
+		}
+		if len(c.urls) > 1 {
+			slog.Warn("Prometheus failed", "url", c.urls[i].url, "error", err)
+		}
+		lastErr = err
+	}
+	c.trip(lastErr)
+	return lastErr
+}
+
+// api returns an API client for one URL. Creating one is cheap, so every
+// request gets a new one using the current HTTP settings.
+func (c *Client) api(baseURL string) (v1.API, error) {
+	client, err := api.NewClient(api.Config{Address: baseURL, Client: c.client})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL %s: %w", baseURL, err)
+	}
+	return v1.NewAPI(client), nil
+}
+
+// logWarnings logs the warnings of a query, e.g. partial responses of
+// Thanos when a store is down
+func logWarnings(query string, warnings v1.Warnings) {
+	if len(warnings) > 0 {
+		slog.Warn("Prometheus query returned warnings", "query", query, "warnings", strings.Join(warnings, "; "))
+	}
+}
+
+// ready reports whether any URL is ready, making the first ready one active.
+// A ready Prometheus closes the circuit breaker.
+func (c *Client) ready(ctx context.Context) bool {
+	for _, i := range c.order() {
+		err := c.readyURL(ctx, c.urls[i].url)
+		if ctx.Err() != nil {
+			return false
+		}
+		c.record(i, err)
+		if err == nil {
+			c.trip(nil)
+			return true
+		}
+	}
+	return false
+}
+
+// Ready checks whether any URL is ready, starting with the active one. Unlike
+// the check while waiting for Prometheus, it leaves failover and the
+// circuit breaker alone.
+func (c *Client) Ready(ctx context.Context) error {
+	var err error
+	for _, i := range c.order() {
+		if err = c.readyURL(ctx, c.urls[i].url); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// readyURL checks the readiness endpoint of one Prometheus URL
+func (c *Client) readyURL(ctx context.Context, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/-/ready", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("not ready: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Defaults for Prometheus queries
+const (
+	// DefaultTimeout bounds a single query attempt
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetryBackoff is the base delay before the first retry; it
+	// doubles with every further retry
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// retryTransport retries idempotent requests that failed with a network
+// error or a transient status, waiting an exponential backoff with full
+// jitter in between. Queries are read-only, so POSTed queries are retried
+// too. Every attempt has its own timeout.
+type retryTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := t.retries
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && req.GetBody == nil {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req, attempt)
+		if attempt >= retries || req.Context().Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+
+		cause := err
+		if resp != nil {
+			cause = fmt.Errorf("status %s", resp.Status)
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		// Full jitter keeps ScaleBee instances from retrying in lockstep
+		wait := rand.N(t.backoff<<attempt + 1)
+		slog.Info("Prometheus request failed, retrying", "host", req.URL.Host, "error", cause,
+			"attempt", attempt+1, "retries", retries, "wait", wait.Round(time.Millisecond))
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt sends a request with the per-attempt timeout. The timeout stays
+// active until the response body is closed. Retries send a fresh copy of
+// the request body.
+func (t *retryTransport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	r := req.WithContext(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryable reports whether a failed attempt may succeed when repeated
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// cancelBody releases the attempt's context once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
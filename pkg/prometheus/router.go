@@ -0,0 +1,303 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEndpoint is the name of the endpoint configured by PROMETHEUS_URL
+const DefaultEndpoint = "default"
+
+// EndpointHealth describes the health of one Prometheus endpoint
+type EndpointHealth struct {
+	Name                string    `json:"name"`
+	URL                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	// URLs are the failover URLs of the endpoint; URL is the active one
+	URLs    []URLHealth   `json:"urls"`
+	Circuit CircuitStatus `json:"circuit"`
+}
+
+// endpoint is a named Prometheus server with its health
+type endpoint struct {
+	name   string
+	client *Client
+	health EndpointHealth
+}
+
+// Router routes service metric queries to per-stack Prometheus endpoints,
+// so stacks whose metrics live in different Prometheus servers (e.g. one per
+// team) can be autoscaled from a single instance
+type Router struct {
+	endpoints     []*endpoint
+	byName        map[string]*endpoint
+	stackRoutes   map[string]string
+	serviceRoutes map[string]string
+	// mu guards labelRoutes, stacks and the endpoint health
+	mu sync.Mutex
+	// labelRoutes are the routes set by service labels
+	labelRoutes map[string]string
+	// stacks maps service names to the stack namespace of their label
+	stacks map[string]string
+}
+
+// NewRouter creates a router with the default client and additional named
+// endpoints. stackRoutes maps stack namespaces and serviceRoutes individual
+// services to endpoint names.
+func NewRouter(defaultClient *Client, endpoints map[string]*Client, stackRoutes, serviceRoutes map[string]string) (*Router, error) {
+	r := &Router{
+		byName:        make(map[string]*endpoint),
+		stackRoutes:   stackRoutes,
+		serviceRoutes: serviceRoutes,
+	}
+
+	r.add(DefaultEndpoint, defaultClient)
+
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == DefaultEndpoint {
+			return nil, fmt.Errorf("endpoint name %q is reserved", DefaultEndpoint)
+		}
+		r.add(name, endpoints[name])
+	}
+
+	for stack, name := range stackRoutes {
+		if _, ok := r.byName[name]; !ok {
+			return nil, fmt.Errorf("stack %s is routed to unknown endpoint %s", stack, name)
+		}
+	}
+	for service, name := range serviceRoutes {
+		if _, ok := r.byName[name]; !ok {
+			return nil, fmt.Errorf("service %s is routed to unknown endpoint %s", service, name)
+		}
+	}
+
+	return r, nil
+}
+
+// add registers a named endpoint
+func (r *Router) add(name string, client *Client) {
+	ep := &endpoint{
+		name:   name,
+		client: client,
+		health: EndpointHealth{Name: name, URL: client.ActiveURL(), Healthy: true},
+	}
+	r.endpoints = append(r.endpoints, ep)
+	r.byName[name] = ep
+}
+
+// Routing reports whether endpoints besides the default one are configured
+func (r *Router) Routing() bool {
+	return len(r.endpoints) > 1
+}
+
+// SetLabelRoutes sets the endpoints services select with a label, by service
+// name. Routes to unknown endpoints are ignored with a warning.
+func (r *Router) SetLabelRoutes(routes map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for service, name := range routes {
+		if _, ok := r.byName[name]; !ok && r.labelRoutes[service] != name {
+			slog.Warn("Service is routed to an unknown Prometheus endpoint, ignoring its label", "service", service, "endpoint", name)
+		}
+	}
+	r.labelRoutes = routes
+}
+
+// SetStacks sets the stack namespaces of services, by service name, from
+// their com.docker.stack.namespace label
+func (r *Router) SetStacks(stacks map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stacks = stacks
+}
+
+// ClearCache drops the cached query results of all endpoints
+func (r *Router) ClearCache() {
+	for _, ep := range r.endpoints {
+		ep.client.ClearCache()
+	}
+}
+
+// EndpointFor returns the name of the endpoint that serves a service's
+// metrics: the endpoint of its label, of its service route, or of its stack
+// route, in that order. The stack is taken from the stack label; for
+// services not seen yet, from the name, which Swarm sets to
+// <stack>_<service>, preferring the longest stack when several match.
+func (r *Router) EndpointFor(serviceName string) string {
+	r.mu.Lock()
+	name, ok := r.labelRoutes[serviceName]
+	stack, labelled := r.stacks[serviceName]
+	r.mu.Unlock()
+	if _, known := r.byName[name]; ok && known {
+		return name
+	}
+	if name, ok := r.serviceRoutes[serviceName]; ok {
+		return name
+	}
+
+	if labelled {
+		if name, ok := r.stackRoutes[stack]; ok {
+			return name
+		}
+		return DefaultEndpoint
+	}
+	match := ""
+	for stack := range r.stackRoutes {
+		if strings.HasPrefix(serviceName, stack+"_") && len(stack) > len(match) {
+			match = stack
+		}
+	}
+	if match != "" {
+		return r.stackRoutes[match]
+	}
+	return DefaultEndpoint
+}
+
+// QueryValue runs a query of a service on the endpoint it is routed to
+func (r *Router) QueryValue(ctx context.Context, serviceName, query string) (float64, error) {
+	ep := r.byName[r.EndpointFor(serviceName)]
+	value, err := ep.client.QueryValue(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("query of endpoint %s failed: %w", ep.name, err)
+	}
+	return value, nil
+}
+
+// GetServiceUsage queries the usage of every service over the given window
+// from the endpoint each service is routed to
+func (r *Router) GetServiceUsage(ctx context.Context, window time.Duration) (map[string]*ServiceUsage, error) {
+	usage := make(map[string]*ServiceUsage)
+	for _, ep := range r.endpoints {
+		res, err := ep.client.GetServiceUsage(ctx, window)
+		if err != nil {
+			if ep.name == DefaultEndpoint {
+				return nil, err
+			}
+			if !errors.Is(err, ErrCircuitOpen) {
+				slog.Warn("Prometheus endpoint failed, skipping its services", "endpoint", ep.name, "error", err)
+			}
+			continue
+		}
+		for service, u := range res {
+			if r.EndpointFor(service) == ep.name {
+				usage[service] = u
+			}
+		}
+	}
+	return usage, nil
+}
+
+// GetServiceMetrics queries all endpoints concurrently and keeps each
+// service's metrics only from the endpoint it is routed to. A failure of the
+// default endpoint fails the whole query; failures of other endpoints only
+// drop the metrics of the stacks routed to them.
+func (r *Router) GetServiceMetrics(ctx context.Context) ([]ServiceMetric, map[string]float64, error) {
+	type result struct {
+		cpu    []ServiceMetric
+		memory map[string]float64
+		err    error
+	}
+
+	results := make([]result, len(r.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range r.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			cpu, memory, err := ep.client.GetServiceMetrics(ctx)
+			results[i] = result{cpu: cpu, memory: memory, err: err}
+		}(i, ep)
+	}
+	wg.Wait()
+
+	cpuMetrics := make([]ServiceMetric, 0)
+	memoryMetrics := make(map[string]float64)
+
+	for i, ep := range r.endpoints {
+		res := results[i]
+		r.recordHealth(ep, res.err)
+
+		if res.err != nil {
+			if ep.name == DefaultEndpoint {
+				return nil, nil, res.err
+			}
+			if !errors.Is(res.err, ErrCircuitOpen) {
+				slog.Warn("Prometheus endpoint failed, skipping its services", "endpoint", ep.name, "error", res.err)
+			}
+			continue
+		}
+
+		for _, m := range res.cpu {
+			if r.EndpointFor(m.ServiceName) == ep.name {
+				cpuMetrics = append(cpuMetrics, m)
+			}
+		}
+		for service, memory := range res.memory {
+			if r.EndpointFor(service) == ep.name {
+				memoryMetrics[service] = memory
+			}
+		}
+	}
+
+	return cpuMetrics, memoryMetrics, nil
+}
+
+// recordHealth updates the health of an endpoint after a query
+func (r *Router) recordHealth(ep *endpoint, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		ep.health.Healthy = false
+		ep.health.LastError = err.Error()
+		ep.health.ConsecutiveFailures++
+		return
+	}
+
+	ep.health.Healthy = true
+	ep.health.LastError = ""
+	ep.health.LastSuccess = time.Now()
+	ep.health.ConsecutiveFailures = 0
+}
+
+// Health returns the health of every endpoint
+func (r *Router) Health() []EndpointHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	health := make([]EndpointHealth, 0, len(r.endpoints))
+	for _, ep := range r.endpoints {
+		h := ep.health
+		h.URL = ep.client.ActiveURL()
+		h.URLs = ep.client.URLHealth()
+		h.Circuit = ep.client.Circuit()
+		health = append(health, h)
+	}
+	return health
+}
+
+// Ready checks whether every endpoint has a ready Prometheus
+func (r *Router) Ready(ctx context.Context) error {
+	var errs []error
+	for _, ep := range r.endpoints {
+		if err := ep.client.Ready(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("prometheus endpoint %s: %w", ep.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
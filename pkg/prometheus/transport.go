@@ -0,0 +1,151 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/instrument"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// HTTPConfig configures how the client connects to Prometheus
+type HTTPConfig struct {
+	// Username and Password set basic auth; PasswordFile is read on every
+	// request instead of Password, e.g. from a Docker secret
+	Username     string
+	Password     string
+	PasswordFile string
+	// BearerToken is sent as Authorization header; BearerTokenFile is read
+	// on every request instead, so rotated tokens are picked up
+	BearerToken     string
+	BearerTokenFile string
+	// CertFile and KeyFile are a client certificate for mutual TLS
+	CertFile string
+	KeyFile  string
+	// CAFile adds PEM certificates to the system roots, e.g. an internal CA
+	CAFile string
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool
+
+	// Timeout bounds every attempt of a query (DefaultTimeout if 0).
+	// Retries is how often queries failing with a network error or a 5xx
+	// or 429 status are repeated, after RetryBackoff doubled per retry.
+	Timeout      time.Duration
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// SetHTTPConfig applies authentication, TLS, timeout and retry settings to
+// the client
+func (c *Client) SetHTTPConfig(cfg HTTPConfig) error {
+	if cfg.Username != "" && (cfg.BearerToken != "" || cfg.BearerTokenFile != "") {
+		return fmt.Errorf("basic auth and bearer token are mutually exclusive")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+
+	// Timeouts apply per attempt in the retry transport; credentials are
+	// added to every attempt, so rotated token files are picked up
+	c.client.Timeout = 0
+	c.client.Transport = &retryTransport{
+		next:    &authTransport{config: cfg, next: measured(transport)},
+		timeout: cfg.Timeout,
+		retries: cfg.Retries,
+		backoff: cfg.RetryBackoff,
+	}
+	return nil
+}
+
+// measured wraps a transport with request metrics and a trace span per
+// request
+func measured(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(instrument.Transport(instrument.Prometheus, "", nil, next),
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return req.Method + " " + req.URL.Path
+		}))
+}
+
+// authTransport adds credentials to every request
+type authTransport struct {
+	config HTTPConfig
+	next   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := t.config
+	if cfg.Username == "" && cfg.BearerToken == "" && cfg.BearerTokenFile == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	switch {
+	case cfg.Username != "":
+		password := cfg.Password
+		if cfg.PasswordFile != "" {
+			p, err := readSecret(cfg.PasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			password = p
+		}
+		req.SetBasicAuth(cfg.Username, password)
+	default:
+		token := cfg.BearerToken
+		if cfg.BearerTokenFile != "" {
+			fileToken, err := readSecret(cfg.BearerTokenFile)
+			if err != nil {
+				return nil, err
+			}
+			token = fileToken
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// readSecret reads a credential from a file, ignoring surrounding whitespace
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ServiceUsage summarizes the resource usage of a service over a window
+type ServiceUsage struct {
+	ServiceName string
+	// TaskCPUP95 is the 95th percentile of the average per-task CPU
+	// percentage (100 = one core)
+	TaskCPUP95 float64
+	// TaskMemoryP95MB and TaskMemoryMaxMB are the 95th percentile and the
+	// maximum of per-task memory usage
+	TaskMemoryP95MB float64
+	TaskMemoryMaxMB float64
+	// TotalCPULow and TotalCPUMax are the 5th percentile and maximum of the
+	// CPU percentage summed over all tasks
+	TotalCPULow float64
+	TotalCPUMax float64
+	// CPUReservation (cores) and MemoryReservationMB are the current
+	// reservations, when the exporter publishes service resource metrics
+	CPUReservation      float64
+	MemoryReservationMB float64
+}
+
+// GetServiceUsage queries the usage of every service over the given window
+// using subqueries, so services are profiled from the history already in
+// Prometheus rather than by observing them first
+func (c *Client) GetServiceUsage(ctx context.Context, window time.Duration) (map[string]*ServiceUsage, error) {
+	rng := fmt.Sprintf("[%ds:1m]", int(window.Seconds()))
+	cpu := c.series("container_cpu_usage_percent")
+	memory := c.series(c.memoryMetric)
+
+	queries := []struct {
+		query string
+		set   func(u *ServiceUsage, v float64)
+	}{
+		{
+			fmt.Sprintf(`quantile_over_time(0.95, avg(%s) BY (service)%s)`, cpu, rng),
+			func(u *ServiceUsage, v float64) { u.TaskCPUP95 = v },
+		},
+		{
+			fmt.Sprintf(`quantile_over_time(0.95, avg(%s) BY (service)%s)`, memory, rng),
+			func(u *ServiceUsage, v float64) { u.TaskMemoryP95MB = v },
+		},
+		{
+			fmt.Sprintf(`max_over_time(max(%s) BY (service)%s)`, memory, rng),
+			func(u *ServiceUsage, v float64) { u.TaskMemoryMaxMB = v },
+		},
+		{
+			fmt.Sprintf(`quantile_over_time(0.05, sum(%s) BY (service)%s)`, cpu, rng),
+			func(u *ServiceUsage, v float64) { u.TotalCPULow = v },
+		},
+		{
+			fmt.Sprintf(`max_over_time(sum(%s) BY (service)%s)`, cpu, rng),
+			func(u *ServiceUsage, v float64) { u.TotalCPUMax = v },
+		},
+	}
+
+	usage := make(map[string]*ServiceUsage)
+	for _, q := range queries {
+		values, err := c.queryVector(ctx, q.query)
+		if err != nil {
+			return nil, err
+		}
+		for service, v := range values {
+			u, ok := usage[service]
+			if !ok {
+				u = &ServiceUsage{ServiceName: service}
+				usage[service] = u
+			}
+			q.set(u, v)
+		}
+	}
+
+	// Current reservations are only added to services with usage. They are
+	// missing unless the exporter publishes service resource metrics.
+	reservations := []struct {
+		query string
+		set   func(u *ServiceUsage, v float64)
+	}{
+		{
+			fmt.Sprintf(`max(%s) BY (service)`, c.selector("swarm_service_cpu_reservation_cores")),
+			func(u *ServiceUsage, v float64) { u.CPUReservation = v },
+		},
+		{
+			fmt.Sprintf(`max(%s) BY (service) / 1024 / 1024`, c.selector("swarm_service_memory_reservation_bytes")),
+			func(u *ServiceUsage, v float64) { u.MemoryReservationMB = v },
+		},
+	}
+	for _, q := range reservations {
+		values, err := c.queryVector(ctx, q.query)
+		if err != nil {
+			return nil, err
+		}
+		for service, v := range values {
+			if u, ok := usage[service]; ok {
+				q.set(u, v)
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+// queryVector runs an instant query and returns its values by service label
+func (c *Client) queryVector(ctx context.Context, query string) (map[string]float64, error) {
+	vector, err := c.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	for _, sample := range vector {
+		if serviceName := string(sample.Metric["service"]); serviceName != "" {
+			values[serviceName] = float64(sample.Value)
+		}
+	}
+
+	return values, nil
+}
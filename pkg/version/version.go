@@ -0,0 +1,82 @@
+// Package version reports which build of ScaleBee is running.
+package version
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version, Commit and BuildDate are set at build time, e.g. with
+// -ldflags "-X github.com/dxas90/scalebee/pkg/version.Version=1.2.0".
+// Commit and BuildDate fall back to the VCS information Go embeds.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// Collector returns the scalebee_build_info gauge, which is always 1 and
+// labelled with the build information
+func Collector() prometheus.Collector {
+	info := Get()
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "scalebee_build_info",
+		Help: "Build information of the running ScaleBee",
+		ConstLabels: prometheus.Labels{
+			"version":    info.Version,
+			"commit":     info.Commit,
+			"build_date": info.BuildDate,
+			"go_version": info.GoVersion,
+		},
+	}, func() float64 { return 1 })
+}
+
+// Handler serves the build information as JSON
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Get()); err != nil {
+			slog.Error("Failed to write version response", "error", err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/systemd"
+)
+
+// readyCheckTimeout bounds the dependency checks of a readiness probe
+const readyCheckTimeout = 5 * time.Second
+
+// probes serves the health, readiness and liveness endpoints. Health
+// checks that runs keep succeeding, readiness the dependencies of every
+// cluster, and liveness that the reconcile loop keeps completing runs.
+type probes struct {
+	// timeout is how long the loop may go without completing a run
+	timeout time.Duration
+
+	mu       sync.Mutex
+	clusters []cluster
+	// started is when the loop started, zero until then
+	started time.Time
+}
+
+// setClusters sets the clusters whose dependencies are checked
+func (p *probes) setClusters(clusters []cluster) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clusters = clusters
+}
+
+// start begins watching the progress of the loop. Before, e.g. while
+// waiting for Prometheus, ScaleBee counts as live.
+func (p *probes) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = time.Now()
+}
+
+// health responds 503 when a cluster had no successful run for
+// STALE_RUN_INTERVALS intervals, e.g. because Docker keeps failing, and
+// 200 otherwise
+func (p *probes) health(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	clusters := p.clusters
+	p.mu.Unlock()
+
+	var stale []string
+	for _, c := range clusters {
+		if ok, age := c.scaler.Stale(); ok {
+			stale = append(stale, fmt.Sprintf("%sno successful run for %v", clusterPrefix(c), age.Round(time.Second)))
+		}
+	}
+	if len(stale) > 0 {
+		http.Error(w, strings.Join(stale, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// ready responds 200 once Docker and the Prometheus endpoints of every
+// cluster respond, and 503 with the failures otherwise
+func (p *probes) ready(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	clusters := p.clusters
+	p.mu.Unlock()
+	if clusters == nil {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	var failures []string
+	for _, c := range clusters {
+		if err := c.scaler.Ready(ctx); err != nil {
+			failures = append(failures, clusterPrefix(c)+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// live responds 503 when the loop of a cluster has not completed a run
+// within the timeout, so the orchestrator restarts a stuck ScaleBee
+func (p *probes) live(w http.ResponseWriter, r *http.Request) {
+	if stalled := p.stalled(); len(stalled) > 0 {
+		http.Error(w, strings.Join(stalled, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// stalled returns a message for every cluster whose loop has not completed
+// a run within the timeout
+func (p *probes) stalled() []string {
+	p.mu.Lock()
+	clusters, started := p.clusters, p.started
+	p.mu.Unlock()
+
+	var stalled []string
+	if started.IsZero() {
+		return nil
+	}
+	for _, c := range clusters {
+		last := c.scaler.LastRun()
+		if last.Before(started) {
+			last = started
+		}
+		if since := time.Since(last); since > p.timeout {
+			stalled = append(stalled, fmt.Sprintf("%sno run completed for %v", clusterPrefix(c), since.Round(time.Second)))
+		}
+	}
+	return stalled
+}
+
+// watchdog sends systemd a watchdog notification every half interval while
+// the loop is live. A stuck loop stops them, so systemd restarts ScaleBee.
+func (p *probes) watchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if stalled := p.stalled(); len(stalled) > 0 {
+				slog.Warn("Loop stalled, withholding the systemd watchdog notification", "stalled", strings.Join(stalled, "; "))
+				continue
+			}
+			notifySystemd(systemd.Watchdog)
+		}
+	}
+}
+
+// notifySystemd sends a state to systemd, if ScaleBee runs under it
+func notifySystemd(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		slog.Warn("Failed to notify systemd", "state", state, "error", err)
+	}
+}
+
+// clusterPrefix prefixes probe failures with the cluster name, if any
+func clusterPrefix(c cluster) string {
+	if c.name == "" {
+		return ""
+	}
+	return c.name + ": "
+}
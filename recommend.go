@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/autoscaler"
+)
+
+// runRecommend prints the recommendations of a running ScaleBee instance as
+// a table and returns the process exit code
+func runRecommend(args []string) int {
+	fs := flag.NewFlagSet("recommend", flag.ExitOnError)
+	apiURL := fs.String("url", getEnv("SCALEBEE_URL", "http://localhost:9090"), "ScaleBee API base URL")
+	window := fs.Duration("window", 24*time.Hour, "observation window")
+	fs.Parse(args)
+
+	params := url.Values{}
+	params.Set("window", window.String())
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/api/v1/recommendations?%s", strings.TrimRight(*apiURL, "/"), params.Encode()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fetch recommendations: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		fmt.Fprintf(os.Stderr, "ScaleBee returned status %d: %s\n", resp.StatusCode, apiErr.Error)
+		return 1
+	}
+
+	var body struct {
+		Recommendations []autoscaler.Recommendation `json:"recommendations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decode recommendations: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Recommendations over the last %s (not applied)\n\n", *window)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tCPU RESERVATION\tMEMORY RESERVATION\tMEMORY LIMIT\tREPLICAS\tCURRENT RESERVATIONS\tCURRENT REPLICAS")
+	for _, rec := range body.Recommendations {
+		currentReservations := "-"
+		if rec.CurrentCPUReservation > 0 || rec.CurrentMemoryReservationMB > 0 {
+			currentReservations = fmt.Sprintf("%.2f / %.0fM", rec.CurrentCPUReservation, rec.CurrentMemoryReservationMB)
+		}
+		currentReplicas := "-"
+		if rec.Autoscaled {
+			currentReplicas = fmt.Sprintf("%d-%d", rec.CurrentMinReplicas, rec.CurrentMaxReplicas)
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.0fM\t%.0fM\t%d-%d\t%s\t%s\n",
+			rec.Service, rec.CPUReservation, rec.MemoryReservationMB, rec.MemoryLimitMB,
+			rec.MinReplicas, rec.MaxReplicas, currentReservations, currentReplicas)
+	}
+	tw.Flush()
+
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/autoscaler"
+	"github.com/dxas90/scalebee/pkg/docker"
+)
+
+// runRestore scales every autoscaled service to its configured minimum, for
+// returning a cluster to its baseline after ScaleBee has been removed, and
+// returns the process exit code. It honours the service scope and restores
+// every cluster in CLUSTERS.
+func runRestore(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: scalebee restore")
+		return 2
+	}
+
+	base := &autoscaler.Config{
+		PrometheusURL:          getEnv("PROMETHEUS_URL", "http://prometheus:9090"),
+		ContainerLabelFallback: getEnv("CONTAINER_LABEL_FALLBACK", "no") == "yes",
+		ClusterName:            getEnv("CLUSTER_NAME", ""),
+		Docker:                 dockerConnection("", docker.Connection{}),
+	}
+	if err := scopeConfig(base); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid service scope: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	for _, config := range clusterConfigs(base) {
+		if err := restoreCluster(config); err != nil {
+			if config.ClusterName != "" {
+				err = fmt.Errorf("cluster %s: %w", config.ClusterName, err)
+			}
+			fmt.Fprintf(os.Stderr, "Failed to restore services: %v\n", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// restoreCluster scales the autoscaled services of one cluster to their
+// minimum
+func restoreCluster(config *autoscaler.Config) error {
+	scaler, err := autoscaler.NewAutoscaler(config)
+	if err != nil {
+		return fmt.Errorf("failed to create autoscaler: %w", err)
+	}
+	defer scaler.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	return scaler.Restore(ctx, autoscaler.RestoreMinimum)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dxas90/scalebee/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// setupTracing exports spans of reconcile runs over OTLP when OTLP_TRACES is
+// grpc or http, configured like OTLP_METRICS with the standard
+// OTEL_EXPORTER_OTLP_* and OTEL_TRACES_SAMPLER variables. It returns a
+// function that sends the buffered spans on shutdown.
+func setupTracing(ctx context.Context) func() {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch protocol := getEnv("OTLP_TRACES", metrics.OTLPNone); protocol {
+	case metrics.OTLPNone:
+		return func() {}
+	case metrics.OTLPGRPC:
+		exporter, err = otlptracegrpc.New(ctx)
+	case metrics.OTLPHTTP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		fatal("Invalid OTLP_TRACES: must be none, grpc, or http", "value", protocol)
+	}
+	if err != nil {
+		fatal("Failed to create OTLP trace exporter", "error", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(metrics.OTLPResource(ctx)),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Exporting traces over OTLP")
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down OTLP trace export", "error", err)
+		}
+	}
+}